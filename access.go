@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// publicHelp is the help of non masters when -public is on
+const publicHelp = `
+	*speed* or *ss*
+	Shows the upload and download speeds.
+
+	*count* or *co*
+	Shows the torrents counts per status.
+
+	*stats* or *sa*
+	Shows Transmission's stats.
+
+	*status*
+	Sends a one line summary of the speeds and torrents, at most once a minute.
+
+	*request*
+	Asks the admins for access.
+
+	*whoami*
+	Shows your user ID, username, the chat's ID and whether you're a master.
+`
+
+// roles of the masters, admins can approve access requests
+const (
+	roleAdmin  = "admin"
+	roleMaster = "master"
+)
+
+var (
+	// pendingRequests keeps track of the users who are waiting for approval, so they can't flood the admins
+	pendingRequests   = make(map[string]bool)
+	pendingRequestsMu sync.Mutex
+)
+
+// roleOf returns the role of username, or an empty string if it's not a master
+func roleOf(username string) string {
+	username = strings.ToLower(username)
+	if username == "" {
+		return ""
+	}
+
+	// masters passed through the flags or the config are admins
+	configMu.RLock()
+	admin := Masters.Contains(username)
+	configMu.RUnlock()
+	if admin {
+		return roleAdmin
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return state.Masters[username]
+}
+
+// isMaster returns true if username is allowed to control the bot
+func isMaster(username string) bool {
+	return roleOf(username) != ""
+}
+
+// isAdmin returns true if username can manage other masters
+func isAdmin(username string) bool {
+	return roleOf(username) == roleAdmin
+}
+
+// requestAccess sends an access request from a non master to the notification chats
+func requestAccess(ud tgbotapi.Update) {
+	username := strings.ToLower(ud.Message.From.UserName)
+	if username == "" {
+		send("*request:* you need to set a Telegram username first", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(notifyChats()) == 0 {
+		send("*request:* no admin is around right now, try again later", ud.Message.Chat.ID, false)
+		return
+	}
+
+	pendingRequestsMu.Lock()
+	if pendingRequests[username] {
+		pendingRequestsMu.Unlock()
+		send("*request:* your request is still waiting for approval", ud.Message.Chat.ID, false)
+		return
+	}
+	pendingRequests[username] = true
+	pendingRequestsMu.Unlock()
+
+	// callback data looks like: "access:<role or deny>:<chat id>:<username>"
+	data := func(action string) string {
+		return fmt.Sprintf("access:%s:%d:%s", action, ud.Message.Chat.ID, username)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Approve", data(roleMaster)),
+			tgbotapi.NewInlineKeyboardButtonData("Approve as admin", data(roleAdmin)),
+			tgbotapi.NewInlineKeyboardButtonData("Deny", data("deny")),
+		),
+	)
+
+	notifyWithMarkup(fmt.Sprintf("%s is requesting access", ud.Message.From.String()), keyboard)
+
+	send("*request:* your request has been sent to the admins", ud.Message.Chat.ID, false)
+}
+
+// accessCallback handles the buttons of an access request
+func accessCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isAdmin(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only admins can do that"))
+		return
+	}
+
+	if len(args) != 3 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	action, username := args[0], args[2]
+	requester, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	pendingRequestsMu.Lock()
+	delete(pendingRequests, username)
+	pendingRequestsMu.Unlock()
+
+	var result string
+	switch action {
+	case roleMaster, roleAdmin:
+		stateMu.Lock()
+		state.Masters[username] = action
+		err := saveState()
+		stateMu.Unlock()
+		if err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+
+		result = fmt.Sprintf("Approved @%s as %s", username, action)
+		send(fmt.Sprintf("*request:* you've been approved as %s, try /help", action), requester, false)
+	default:
+		result = fmt.Sprintf("Denied @%s", username)
+		send("*request:* your request has been denied", requester, false)
+	}
+
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, result))
+	botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, result))
+}
+
+// masters lists the masters and their roles
+func masters(ud tgbotapi.Update) {
+	buf := new(bytes.Buffer)
+	configMu.RLock()
+	for _, master := range Masters {
+		buf.WriteString(fmt.Sprintf("@%s - %s (config)\n", master, roleAdmin))
+	}
+	configMu.RUnlock()
+
+	stateMu.Lock()
+	for master, role := range state.Masters {
+		buf.WriteString(fmt.Sprintf("@%s - %s\n", master, role))
+	}
+	stateMu.Unlock()
+
+	send(buf.String(), ud.Message.Chat.ID, false)
+}
+
+// revoke takes one or more usernames and removes them from the approved masters
+func revoke(ud tgbotapi.Update, tokens []string) {
+	if !isAdmin(ud.Message.From.UserName) {
+		send("*revoke:* only admins can revoke access", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) == 0 {
+		send("*revoke:* needs a username", ud.Message.Chat.ID, false)
+		return
+	}
+
+	for _, username := range tokens {
+		username = strings.ToLower(strings.TrimPrefix(username, "@"))
+
+		configMu.RLock()
+		configured := Masters.Contains(username)
+		configMu.RUnlock()
+		if configured {
+			send(fmt.Sprintf("*revoke:* @%s is set through the config, can't revoke", username), ud.Message.Chat.ID, false)
+			continue
+		}
+
+		stateMu.Lock()
+		_, ok := state.Masters[username]
+		delete(state.Masters, username)
+		err := saveState()
+		stateMu.Unlock()
+		if err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+
+		if !ok {
+			send(fmt.Sprintf("*revoke:* @%s is not a master", username), ud.Message.Chat.ID, false)
+			continue
+		}
+		send(fmt.Sprintf("*revoke:* @%s", username), ud.Message.Chat.ID, false)
+	}
+}
+
+// whoami tells the user their telegram IDs and role, for setting up -notify-chat, -channel and
+// groups. anyone can use it. the telegram library doesn't know about topics, so no thread ID.
+func whoami(ud tgbotapi.Update) {
+	from := ud.Message.From
+	role := roleOf(from.UserName)
+	if role == "" {
+		role = "not a master, send 'request' to ask for access"
+	}
+
+	username := "none, masters are recognized by it so set one"
+	if from.UserName != "" {
+		username = "@" + from.UserName
+	}
+
+	chat := ud.Message.Chat
+	chatType := chat.Type
+	if chat.Title != "" {
+		chatType += ", " + chat.Title
+	}
+
+	// the general topic and the chats without topics have none
+	thread := "none"
+	if id := messageThread(chat.ID, ud.Message.MessageID); id != 0 {
+		thread = strconv.Itoa(id)
+	}
+
+	send(fmt.Sprintf("User ID: %d\nUsername: %s\nChat ID: %d (%s)\nThread ID: %s\nRole: %s",
+		from.ID, username, chat.ID, chatType, thread, role), chat.ID, false)
+}
+
+// publicCommand runs the message of a non master if it's one of the read only
+// commands and the public mode is on, it returns false if the message wasn't handled.
+func publicCommand(ud tgbotapi.Update) bool {
+	configMu.RLock()
+	public := Public
+	configMu.RUnlock()
+	if !public {
+		return false
+	}
+
+	// stickers, photos and joins have no text
+	fields := strings.Fields(ud.Message.Text)
+	if len(fields) == 0 {
+		return false
+	}
+
+	command := strings.ToLower(fields[0])
+	command = strings.TrimSuffix(command, "@"+strings.ToLower(Bot.Self.UserName))
+
+	switch command {
+	case "speed", "/speed", "ss", "/ss":
+		go speed(ud)
+	case "count", "/count", "co", "/co":
+		go count(ud, nil)
+	case "stats", "/stats", "sa", "/sa":
+		go stats(ud)
+	case "status", "/status":
+		go status(ud)
+	case "help", "/help", "/start":
+		go send(publicHelp, ud.Message.Chat.ID, true)
+	default:
+		return false
+	}
+
+	logger.Printf("[INFO] Public %s from: %s", command, ud.Message.From.String())
+	return true
+}
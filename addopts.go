@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pyed/transmission"
+)
+
+// addOptions are the options add takes before the URLs, e.g. "add -paused -dir /data/tv -label tv <magnet>"
+type addOptions struct {
+	Paused bool
+	Dir    string
+	Labels []string
+}
+
+// set returns true if any of the options is set
+func (o addOptions) set() bool {
+	return o.Paused || o.Dir != "" || len(o.Labels) > 0
+}
+
+// parseAddOptions takes the options off the start of tokens, it returns the rest of them
+func parseAddOptions(tokens []string) (addOptions, []string, error) {
+	var opts addOptions
+	for len(tokens) > 0 {
+		token := strings.ToLower(tokens[0])
+		switch {
+		case token == "":
+		case token == "-paused":
+			opts.Paused = true
+		case token == "-dir" || token == "-label":
+			if len(tokens) < 2 || tokens[1] == "" {
+				return opts, nil, fmt.Errorf("%s needs a value", token)
+			}
+			if token == "-dir" {
+				opts.Dir = tokens[1]
+			} else {
+				opts.Labels = append(opts.Labels, tokens[1])
+			}
+			tokens = tokens[1:]
+		case strings.HasPrefix(token, "-"):
+			return opts, nil, fmt.Errorf("unknown option %s, takes -paused, -dir and -label", tokens[0])
+		default:
+			return opts, tokens, nil
+		}
+		tokens = tokens[1:]
+	}
+	return opts, tokens, nil
+}
+
+// parseCaption parses the options in the caption of a .torrent, e.g. "dir=/data/movies paused label=4k",
+// the options of add work too. a caption that isn't all options, e.g. the text of a forwarded
+// post, is ignored.
+func parseCaption(caption string) (addOptions, error) {
+	fields := strings.Fields(caption)
+	for _, token := range fields {
+		if !captionOption(token) {
+			return addOptions{}, nil
+		}
+	}
+
+	var tokens []string
+	for _, token := range fields {
+		if !strings.HasPrefix(token, "-") {
+			if i := strings.Index(token, "="); i > 0 {
+				tokens = append(tokens, "-"+token[:i], token[i+1:])
+				continue
+			}
+			token = "-" + token
+		}
+		tokens = append(tokens, token)
+	}
+
+	opts, rest, err := parseAddOptions(tokens)
+	if err != nil {
+		return opts, err
+	}
+	if len(rest) > 0 {
+		return opts, fmt.Errorf("unknown option %s, takes dir=, label= and paused", strings.TrimPrefix(rest[0], "-"))
+	}
+	return opts, nil
+}
+
+// captionOption returns true if token looks like an option, e.g. "-dir", "paused" or "label=4k"
+func captionOption(token string) bool {
+	if len(token) > 1 && strings.HasPrefix(token, "-") || strings.EqualFold(token, "paused") {
+		return true
+	}
+	i := strings.Index(token, "=")
+	if i <= 0 {
+		return false
+	}
+	for _, c := range strings.ToLower(token[:i]) {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// addOne adds url, through addURLWith if any of opts are set, then applies the defaults of its
+// tracker. when transmission fails to add a web URL it's checked from here, so a web page gets
+// a clear error instead of "invalid or corrupt torrent file". only transmission might be able to
+// reach it, e.g. through a VPN, so it's not checked before.
+func addOne(url string, opts addOptions) (transmission.TorrentAdded, error) {
+	add := addURL
+	if opts.set() {
+		add = func(url string) (transmission.TorrentAdded, error) { return addURLWith(url, opts) }
+	}
+
+	torrent, err := add(url)
+	if err != nil {
+		// the files sent to the bot have its token in their links
+		web := strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+		if web && !strings.Contains(url, BotToken) {
+			if checkErr := checkURL(url); checkErr != nil {
+				return torrent, fmt.Errorf("%s (%s)", checkErr, err)
+			}
+		}
+		return torrent, err
+	}
+	recordSource(torrent, url)
+
+	if err := applyTrackerDefaults(torrent.ID, opts); err != nil {
+		return torrent, fmt.Errorf("added %s, but %s", torrent.Name, err)
+	}
+	return torrent, nil
+}
+
+// addURLWith adds url with opts, the transmission package can't add paused so this goes
+// through the RPC directly. the labels are set after the add.
+func addURLWith(url string, opts addOptions) (transmission.TorrentAdded, error) {
+	args := map[string]interface{}{"filename": url, "paused": opts.Paused}
+	if opts.Dir != "" {
+		args["download-dir"] = opts.Dir
+	}
+
+	var out struct {
+		Added     *transmission.TorrentAdded `json:"torrent-added"`
+		Duplicate *transmission.TorrentAdded `json:"torrent-duplicate"`
+	}
+	if err := rpcCall("torrent-add", args, &out); err != nil {
+		return transmission.TorrentAdded{}, err
+	}
+	if out.Duplicate != nil {
+		return *out.Duplicate, fmt.Errorf("%s is already added", out.Duplicate.Name)
+	}
+	if out.Added == nil || out.Added.Name == "" {
+		return transmission.TorrentAdded{}, fmt.Errorf("error adding %s", url)
+	}
+
+	if len(opts.Labels) > 0 {
+		if err := torrentSet([]int{out.Added.ID}, map[string]interface{}{"labels": opts.Labels}); err != nil {
+			return *out.Added, fmt.Errorf("added %s, but couldn't label it: %s", out.Added.Name, err)
+		}
+	}
+	return *out.Added, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// albumWait is how long to wait for more documents of an album after the last one
+const albumWait = 2 * time.Second
+
+// album is a group of documents sent together, telegram delivers them as separate messages
+type album struct {
+	chat    int64
+	caption string
+	files   []albumFile
+	timer   *time.Timer
+}
+
+// albumFile is a document of an album
+type albumFile struct {
+	name string
+	link string
+}
+
+var (
+	// albums are the albums still coming in, by media group ID
+	albums   = make(map[string]*album)
+	albumsMu sync.Mutex
+)
+
+// collectAlbum adds the document of ud to its album, which gets added once no more come for albumWait
+func collectAlbum(ud tgbotapi.Update, link string) {
+	id := ud.Message.MediaGroupID
+
+	albumsMu.Lock()
+	defer albumsMu.Unlock()
+
+	a := albums[id]
+	if a == nil {
+		a = &album{chat: ud.Message.Chat.ID}
+		a.timer = time.AfterFunc(albumWait, func() { addAlbum(id) })
+		albums[id] = a
+	} else {
+		a.timer.Reset(albumWait)
+	}
+
+	// only one of the documents usually has the caption, it applies to all of them
+	if a.caption == "" {
+		a.caption = ud.Message.Caption
+	}
+	a.files = append(a.files, albumFile{name: ud.Message.Document.FileName, link: link})
+}
+
+// addAlbum adds the documents of an album and reports how they went
+func addAlbum(id string) {
+	albumsMu.Lock()
+	a := albums[id]
+	delete(albums, id)
+	albumsMu.Unlock()
+
+	if a == nil {
+		return
+	}
+
+	opts, err := parseCaption(a.caption)
+	if err != nil {
+		sendErr("receiver", err, a.chat)
+		return
+	}
+
+	// one at a time, spread out like any other batch
+	groups := make([][]string, len(a.files))
+	names := make([]string, len(a.files))
+	for i, file := range a.files {
+		groups[i] = []string{file.link}
+		names[i] = file.name
+	}
+	addBatch(a.chat, groups, names, opts)
+}
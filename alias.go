@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	gosort "sort"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+var (
+	// aliasNameRegex is what an alias can be named
+	aliasNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+	// helpCommandRegex matches the commands in HELP, e.g. "*list* or *li* or *ls*"
+	helpCommandRegex = regexp.MustCompile(`\*([a-z]+)\*`)
+)
+
+// alias saves a command under a name, e.g. _alias purge "deldata status=seeding ratio>5"_, then
+// "purge" runs it. it lists the aliases without arguments.
+func alias(ud tgbotapi.Update, tokens []string) {
+	stateMu.Lock()
+	aliases := make(map[string]string, len(state.Aliases))
+	for name, command := range state.Aliases {
+		aliases[name] = command
+	}
+	stateMu.Unlock()
+
+	if len(tokens) == 0 {
+		if len(aliases) == 0 {
+			send("*alias:* no aliases, e.g. _alias seedbox \"list tracker:myprivate\"_", ud.Message.Chat.ID, true)
+			return
+		}
+
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		gosort.Strings(names)
+
+		buf := new(bytes.Buffer)
+		for _, name := range names {
+			buf.WriteString(fmt.Sprintf("%s: %s\n", name, aliases[name]))
+		}
+		send(buf.String(), ud.Message.Chat.ID, false)
+		return
+	}
+
+	name := strings.ToLower(tokens[0])
+	if len(tokens) == 1 {
+		command, ok := aliases[name]
+		if !ok {
+			send(fmt.Sprintf("*alias:* no alias named %s", name), ud.Message.Chat.ID, false)
+			return
+		}
+		send(fmt.Sprintf("%s: %s", name, command), ud.Message.Chat.ID, false)
+		return
+	}
+
+	if !aliasNameRegex.MatchString(name) {
+		send("*alias:* a name takes letters, digits, - and _", ud.Message.Chat.ID, false)
+		return
+	}
+	if isCommand(name) {
+		send(fmt.Sprintf("*alias:* %s is a command already", name), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// phones like to turn the quotes into curly ones
+	command := strings.Join(tokens[1:], " ")
+	command = strings.TrimSpace(strings.Trim(command, "\"“”"))
+	if command == "" {
+		send("*alias:* needs a command, e.g. _alias seedbox \"list tracker:myprivate\"_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	stateMu.Lock()
+	if state.Aliases == nil {
+		state.Aliases = make(map[string]string)
+	}
+	state.Aliases[name] = command
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+	stateMu.Unlock()
+
+	send(fmt.Sprintf("*alias:* %s runs %s", name, mdReplacer.Replace(command)), ud.Message.Chat.ID, true)
+}
+
+// unalias removes the aliases with the given names
+func unalias(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*unalias:* needs an alias' name", ud.Message.Chat.ID, false)
+		return
+	}
+
+	stateMu.Lock()
+	var removed []string
+	for _, name := range tokens {
+		name = strings.ToLower(name)
+		if _, ok := state.Aliases[name]; ok {
+			delete(state.Aliases, name)
+			removed = append(removed, name)
+		}
+	}
+	if len(removed) > 0 {
+		if err := saveState(); err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+	}
+	stateMu.Unlock()
+
+	if len(removed) == 0 {
+		send("*unalias:* no such alias", ud.Message.Chat.ID, false)
+		return
+	}
+	send("*unalias:* removed "+strings.Join(removed, ", "), ud.Message.Chat.ID, false)
+}
+
+// expandAlias replaces the first token with its alias' command, the rest of the tokens are
+// added after it, e.g. "purge json". aliases aren't expanded in aliases.
+func expandAlias(tokens []string) []string {
+	name := strings.TrimPrefix(strings.ToLower(tokens[0]), "/")
+	name = strings.TrimSuffix(name, "@"+strings.ToLower(Bot.Self.UserName))
+
+	stateMu.Lock()
+	command, ok := state.Aliases[name]
+	stateMu.Unlock()
+
+	expanded := strings.Fields(command)
+	if !ok || len(expanded) == 0 {
+		return tokens
+	}
+	return append(expanded, tokens[1:]...)
+}
+
+// isCommand returns true if name is one of the commands in HELP, or their short forms
+func isCommand(name string) bool {
+	for _, line := range strings.Split(HELP, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "*") {
+			continue
+		}
+		for _, sm := range helpCommandRegex.FindAllStringSubmatch(line, -1) {
+			if sm[1] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	gosort "sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// apiMaxBody is the biggest request body the API reads
+const apiMaxBody = 1 << 20
+
+// apiMux routes the REST API, see startAPI
+var (
+	apiMux  = http.NewServeMux()
+	apiOnce sync.Once
+)
+
+func init() {
+	apiMux.HandleFunc("/api/torrents/", apiTorrentFields)
+}
+
+// startAPI serves the REST API on APIListen if it's set, only once. it needs APIToken,
+// anyone who can reach APIListen could use it otherwise.
+func startAPI() {
+	if APIListen == "" {
+		return
+	}
+
+	if APIToken == "" {
+		logger.Printf("[ERROR] API: not listening on %s, -api-token is not set", APIListen)
+		return
+	}
+
+	apiOnce.Do(func() {
+		go func() {
+			logger.Printf("[INFO] API: listening on %s", APIListen)
+			if err := http.ListenAndServe(APIListen, apiAuth(apiMux)); err != nil {
+				logger.Printf("[ERROR] API: %s", err)
+			}
+		}()
+	})
+}
+
+// apiAuth rejects the requests without APIToken, as "Authorization: Bearer <token>" or "?token=<token>"
+func apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if APIToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(APIToken)) != 1 {
+			apiError(w, http.StatusUnauthorized, "bad token")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, apiMaxBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiError replies with {"error": msg}
+func apiError(w http.ResponseWriter, code int, msg string) {
+	apiReply(w, code, map[string]string{"error": msg})
+}
+
+// apiReply replies with v as JSON
+func apiReply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiTorrentFields handles /api/torrents/<id or hash>/fields, which holds the custom fields
+// of a torrent, e.g. {"requested_by": "Alice"}. GET returns them, PUT merges the given
+// fields in (an empty value removes a field) and DELETE removes all of them.
+func apiTorrentFields(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/torrents/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "fields" {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	hash, err := torrentHash(parts[0])
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT", "POST":
+		var fields map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := fields[""]; ok {
+			apiError(w, http.StatusBadRequest, "a field needs a name")
+			return
+		}
+		if err := setFields(hash, fields); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case "DELETE":
+		if err := setFields(hash, nil); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	default:
+		apiError(w, http.StatusMethodNotAllowed, "use GET, PUT or DELETE")
+		return
+	}
+
+	// copied, the reply is written without holding stateMu
+	fields := make(map[string]string)
+	stateMu.Lock()
+	for name, value := range state.Fields[hash] {
+		fields[name] = value
+	}
+	stateMu.Unlock()
+	apiReply(w, http.StatusOK, fields)
+}
+
+// torrentHash returns the info hash of the torrent with the given ID or hash
+func torrentHash(idOrHash string) (string, error) {
+	torrents, err := getTorrentFields(nil, "id", "hashString")
+	if err != nil {
+		return "", err
+	}
+
+	id, _ := strconv.Atoi(idOrHash)
+	for _, torrent := range torrents {
+		if torrent.ID == id || strings.EqualFold(torrent.HashString, idOrHash) {
+			return strings.ToLower(torrent.HashString), nil
+		}
+	}
+	return "", fmt.Errorf("no torrent %s", idOrHash)
+}
+
+// setFields merges fields into the custom fields of the torrent with hash, nil removes them all
+func setFields(hash string, fields map[string]string) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if state.Fields == nil {
+		state.Fields = make(map[string]map[string]string)
+	}
+
+	if fields == nil {
+		delete(state.Fields, hash)
+		return saveState()
+	}
+
+	merged := state.Fields[hash]
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	for k, v := range fields {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+
+	if len(merged) == 0 {
+		delete(state.Fields, hash)
+	} else {
+		state.Fields[hash] = merged
+	}
+	return saveState()
+}
+
+// customFields formats the custom fields of the torrent with id, one per line,
+// e.g. "Requested by: Alice" for requested_by.
+func customFields(id int) string {
+	stateMu.Lock()
+	stored := len(state.Fields) > 0
+	stateMu.Unlock()
+	if !stored {
+		return ""
+	}
+
+	torrent, err := getTorrentExtra(id, "hashString")
+	if err != nil {
+		return ""
+	}
+
+	stateMu.Lock()
+	fields := state.Fields[strings.ToLower(torrent.HashString)]
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	gosort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		// older states might have one without a name
+		if k == "" {
+			continue
+		}
+		name := strings.Replace(k, "_", " ", -1)
+		name = strings.ToUpper(name[:1]) + name[1:]
+		lines = append(lines, fmt.Sprintf("%s: %s", name, fields[k]))
+	}
+	stateMu.Unlock()
+
+	return strings.Join(lines, "\n")
+}
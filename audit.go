@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	gosort "sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// auditMaxSize is how big the audit log gets before it's moved to "<file>.1", the
+// previous "<file>.1" is dropped then
+const auditMaxSize = 10 << 20
+
+// auditEntry is a line of the audit log, one per command
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Chat     int64     `json:"chat"`
+	Command  string    `json:"command"`
+	Failed   bool      `json:"failed"`
+	Duration float64   `json:"duration"` // seconds the command took
+}
+
+// auditMu keeps the lines of the audit log from interleaving
+var auditMu sync.Mutex
+
+// audit appends entry to AuditLog, if there's one
+func audit(entry auditEntry) {
+	configMu.RLock()
+	file := AuditLog
+	configMu.RUnlock()
+
+	if file == "" {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.Printf("[ERROR] Audit: %s", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if info, err := os.Stat(file); err == nil && info.Size() > auditMaxSize {
+		if err := os.Rename(file, file+".1"); err != nil {
+			logger.Printf("[ERROR] Audit: %s", err)
+		}
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Printf("[ERROR] Audit: %s", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		logger.Printf("[ERROR] Audit: %s", err)
+	}
+}
+
+// readAudit returns the entries of the audit log since since, the rotated one included
+func readAudit(since time.Time) ([]auditEntry, error) {
+	configMu.RLock()
+	file := AuditLog
+	configMu.RUnlock()
+
+	if file == "" {
+		return nil, fmt.Errorf("there's no audit log, set one with -audit-log")
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	var entries []auditEntry
+	for _, name := range []string{file + ".1", file} {
+		read, err := readAuditFile(name, since)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, read...)
+	}
+	return entries, nil
+}
+
+// readAuditFile returns the entries of the audit log file since since
+func readAuditFile(file string, since time.Time) ([]auditEntry, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // a line cut short by a crash
+		}
+		if entry.Time.After(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// botstats sums up the audit log: how often each command is used and how it does,
+// and who uses the bot, e.g. "botstats 7d".
+func botstats(ud tgbotapi.Update, tokens []string) {
+	if !isAdmin(ud.Message.From.UserName) {
+		send("*botstats:* only admins can see the bot's stats", ud.Message.Chat.ID, false)
+		return
+	}
+
+	days := 30
+	if len(tokens) > 0 {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(tokens[0]), "d"))
+		if err != nil || n < 1 {
+			send(fmt.Sprintf("*botstats:* %s is not a number of days, e.g. 7d", tokens[0]), ud.Message.Chat.ID, false)
+			return
+		}
+		days = n
+	}
+
+	entries, err := readAudit(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		sendErr("botstats", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if len(entries) == 0 {
+		send(fmt.Sprintf("*botstats:* no commands in the last %d days", days), ud.Message.Chat.ID, false)
+		return
+	}
+
+	type usage struct {
+		name     string
+		count    int
+		failed   int
+		duration float64
+	}
+
+	commands := make(map[string]*usage)
+	users := make(map[string]*usage)
+	weeks := make(map[string]int)
+	for _, entry := range entries {
+		for _, u := range []struct {
+			m    map[string]*usage
+			name string
+		}{{commands, entry.Command}, {users, entry.User}} {
+			if u.m[u.name] == nil {
+				u.m[u.name] = &usage{name: u.name}
+			}
+			u.m[u.name].count++
+			u.m[u.name].duration += entry.Duration
+			if entry.Failed {
+				u.m[u.name].failed++
+			}
+		}
+
+		year, week := entry.Time.ISOWeek()
+		weeks[fmt.Sprintf("%d-W%02d", year, week)]++
+	}
+
+	sorted := func(m map[string]*usage) []*usage {
+		list := make([]*usage, 0, len(m))
+		for _, u := range m {
+			list = append(list, u)
+		}
+		gosort.Slice(list, func(i, j int) bool {
+			if list[i].count != list[j].count {
+				return list[i].count > list[j].count
+			}
+			return list[i].name < list[j].name
+		})
+		return list
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("*%d commands in the last %d days*\n\n", len(entries), days))
+	for _, u := range sorted(commands) {
+		buf.WriteString(fmt.Sprintf("%s: *%d*, %.1fs, %d%% errors\n", mdReplacer.Replace(u.name), u.count,
+			u.duration/float64(u.count), u.failed*100/u.count))
+	}
+
+	buf.WriteString("\n*Users*\n")
+	for _, u := range sorted(users) {
+		buf.WriteString(fmt.Sprintf("%s: *%d*\n", mdReplacer.Replace(u.name), u.count))
+	}
+
+	names := make([]string, 0, len(weeks))
+	for week := range weeks {
+		names = append(names, week)
+	}
+	gosort.Strings(names)
+
+	buf.WriteString("\n*Weeks*\n")
+	for _, week := range names {
+		buf.WriteString(fmt.Sprintf("%s: *%d*\n", week, weeks[week]))
+	}
+
+	send(buf.String(), ud.Message.Chat.ID, true)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// resultsPage is how many cached results are shown at once
+const resultsPage = 30
+
+// searchResult is a single result of search (or find)
+type searchResult struct {
+	ID   int    // torrent ID, for results that are already in transmission
+	Name string // name of the torrent
+	Link string // magnet or URL, for results that can be added
+	Info string // extra line shown under the name, e.g. size and seeders
+}
+
+// searchCache holds the last results of a chat, so they can be paged and refined without querying again
+type searchCache struct {
+	chat    int64
+	command string
+	results []searchResult
+	shown   int
+}
+
+var (
+	searchCaches   = make(map[int64]*searchCache)
+	searchCachesMu sync.Mutex
+)
+
+// cacheResults replaces the cached results of chat, and returns the first page of them
+func cacheResults(chat int64, command string, results []searchResult) string {
+	searchCachesMu.Lock()
+	defer searchCachesMu.Unlock()
+
+	cache := &searchCache{chat: chat, command: command, results: results}
+	searchCaches[chat] = cache
+	return cache.nextPage()
+}
+
+// moreResults returns the next page of the cached results of chat
+func moreResults(chat int64) (string, error) {
+	searchCachesMu.Lock()
+	defer searchCachesMu.Unlock()
+
+	cache, ok := searchCaches[chat]
+	if !ok {
+		return "", fmt.Errorf("no previous results")
+	}
+	if cache.shown >= len(cache.results) {
+		return "", fmt.Errorf("no more results")
+	}
+	return cache.nextPage(), nil
+}
+
+// filterResults narrows the cached results of chat to the ones with names matching regx
+func filterResults(chat int64, regx *regexp.Regexp) (string, error) {
+	searchCachesMu.Lock()
+	defer searchCachesMu.Unlock()
+
+	cache, ok := searchCaches[chat]
+	if !ok {
+		return "", fmt.Errorf("no previous results")
+	}
+
+	var results []searchResult
+	for _, result := range cache.results {
+		if regx.MatchString(result.Name) {
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("no matches")
+	}
+
+	cache.results = results
+	cache.shown = 0
+	return cache.nextPage(), nil
+}
+
+// cachedResult returns the nth (1 based) cached result of chat
+func cachedResult(chat int64, n string) (searchResult, error) {
+	searchCachesMu.Lock()
+	defer searchCachesMu.Unlock()
+
+	cache, ok := searchCaches[chat]
+	if !ok {
+		return searchResult{}, fmt.Errorf("no previous results")
+	}
+
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(cache.results) {
+		return searchResult{}, fmt.Errorf("no result number %s", n)
+	}
+	return cache.results[i-1], nil
+}
+
+// nextPage formats the next page of results, callers must hold searchCachesMu
+func (cache *searchCache) nextPage() string {
+	end := cache.shown + resultsPage
+	if end > len(cache.results) {
+		end = len(cache.results)
+	}
+
+	buf := new(bytes.Buffer)
+	for i := cache.shown; i < end; i++ {
+		result := cache.results[i]
+		if result.Link == "" {
+			buf.WriteString(torrentLine(cache.chat, result.ID, result.Name))
+		} else {
+			buf.WriteString(fmt.Sprintf("*%d.* %s\n", i+1, mdReplacer.Replace(displayName(cache.chat, result.Name))))
+		}
+		if result.Info != "" {
+			buf.WriteString(mdReplacer.Replace(result.Info) + "\n")
+		}
+	}
+	cache.shown = end
+
+	if left := len(cache.results) - end; left > 0 {
+		buf.WriteString(fmt.Sprintf("\n_%d more, send \"%s more\"_", left, cache.command))
+	}
+	return buf.String()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// chain starts a torrent once another completes, it's kept by hash since the IDs
+// change when transmission restarts.
+type chain struct {
+	After     string `json:"after"`
+	AfterName string `json:"after_name"`
+	Start     string `json:"start"`
+	StartName string `json:"start_name"`
+}
+
+func init() {
+	onPoll(runChains)
+}
+
+// after chains torrents: "after <b> start <a>" stops a until b completes, "after <b> clear"
+// removes the chains waiting on b, and "after" alone lists the chains.
+func after(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		listChains(ud)
+		return
+	}
+
+	if len(tokens) == 2 && strings.ToLower(tokens[1]) == "clear" {
+		hash, err := torrentHash(tokens[0])
+		if err != nil {
+			sendErr("after", err, ud.Message.Chat.ID)
+			return
+		}
+
+		stateMu.Lock()
+		var kept []chain
+		for _, c := range state.Chains {
+			if c.After != hash {
+				kept = append(kept, c)
+			}
+		}
+		n := len(state.Chains) - len(kept)
+		state.Chains = kept
+		err = saveState()
+		stateMu.Unlock()
+
+		if err != nil {
+			sendErr("after", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("*after:* removed %d chains", n), ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) != 3 || strings.ToLower(tokens[1]) != "start" {
+		send("*after:* use _after <id> start <id>_, _after <id> clear_, or _after_ to list", ud.Message.Chat.ID, true)
+		return
+	}
+
+	afterID, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*after:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+	startID, err := strconv.Atoi(tokens[2])
+	if err != nil {
+		send(fmt.Sprintf("*after:* %s is not a number", tokens[2]), ud.Message.Chat.ID, false)
+		return
+	}
+	if afterID == startID {
+		send("*after:* a torrent can't wait for itself", ud.Message.Chat.ID, false)
+		return
+	}
+
+	first, err := rpcClient().GetTorrent(afterID)
+	if err != nil {
+		send(fmt.Sprintf("*after:* Can't find a torrent with an ID of %d", afterID), ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrents, err := getTorrentFields([]int{afterID, startID}, "id", "name", "hashString")
+	if err != nil || len(torrents) != 2 {
+		send(fmt.Sprintf("*after:* Can't find a torrent with an ID of %d", startID), ud.Message.Chat.ID, false)
+		return
+	}
+
+	c := chain{}
+	for _, torrent := range torrents {
+		if torrent.ID == afterID {
+			c.After, c.AfterName = strings.ToLower(torrent.HashString), torrent.Name
+		} else {
+			c.Start, c.StartName = strings.ToLower(torrent.HashString), torrent.Name
+		}
+	}
+
+	// already done, nothing to wait for
+	if first.PercentDone >= 1 {
+		if _, err := rpcClient().StartTorrent(startID); err != nil {
+			sendErr("after", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("%s is already complete, started %s", c.AfterName, c.StartName), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// nothing would start it again
+	if !watcherRunning() {
+		send("*after:* needs the watcher, it's off with -watch-interval 0", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if _, err := rpcClient().StopTorrent(startID); err != nil {
+		sendErr("after", err, ud.Message.Chat.ID)
+		return
+	}
+
+	stateMu.Lock()
+	state.Chains = append(state.Chains, c)
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		sendErr("after", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("Stopped %s, it will start once %s completes", c.StartName, c.AfterName), ud.Message.Chat.ID, false)
+}
+
+// listChains lists the torrents waiting for others to complete
+func listChains(ud tgbotapi.Update) {
+	stateMu.Lock()
+	buf := new(bytes.Buffer)
+	for _, c := range state.Chains {
+		buf.WriteString(fmt.Sprintf("%s\n  → %s\n", c.AfterName, c.StartName))
+	}
+	stateMu.Unlock()
+
+	if buf.Len() == 0 {
+		send("*after:* no torrent is waiting for another", ud.Message.Chat.ID, false)
+		return
+	}
+	send(buf.String(), ud.Message.Chat.ID, false)
+}
+
+// runChains starts the torrents whose chain is done waiting, it's checked on every poll so
+// the torrents that completed while the bot was down count too.
+func runChains(transmission.Torrents) {
+	stateMu.Lock()
+	pending := len(state.Chains)
+	stateMu.Unlock()
+	if pending == 0 {
+		return
+	}
+
+	torrents, err := getTorrentFields(nil, "id", "hashString", "percentDone")
+	if err != nil {
+		logger.Printf("[ERROR] Chains: %s", err)
+		return
+	}
+	ids := make(map[string]int)
+	done := make(map[string]bool)
+	for _, torrent := range torrents {
+		hash := strings.ToLower(torrent.HashString)
+		ids[hash] = torrent.ID
+		done[hash] = torrent.PercentDone >= 1
+	}
+
+	stateMu.Lock()
+	var (
+		kept  []chain
+		ready []chain
+		gone  []chain
+	)
+	for _, c := range state.Chains {
+		_, exists := ids[c.After]
+		switch {
+		case !exists:
+			gone = append(gone, c)
+		case done[c.After]:
+			ready = append(ready, c)
+		default:
+			kept = append(kept, c)
+		}
+	}
+	if len(ready) > 0 || len(gone) > 0 {
+		state.Chains = kept
+		if err := saveState(); err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+	}
+	stateMu.Unlock()
+
+	for _, c := range gone {
+		notify(fmt.Sprintf("%s was removed before completing, %s stays stopped", c.AfterName, c.StartName), false)
+	}
+	for _, c := range ready {
+		id, ok := ids[c.Start]
+		if !ok {
+			notify(fmt.Sprintf("%s completed, but %s is gone", c.AfterName, c.StartName), false)
+			continue
+		}
+		if _, err := rpcClient().StartTorrent(id); err != nil {
+			notify(fmt.Sprintf("%s completed, but starting %s failed: %s", c.AfterName, c.StartName, err), false)
+			continue
+		}
+		notify(fmt.Sprintf("%s completed, started <%d> %s", c.AfterName, id, c.StartName), false)
+	}
+}
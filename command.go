@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// commandRun is a command being run, for the audit log
+type commandRun struct {
+	failed bool
+}
+
+var (
+	// runs are the commands running in each chat, chat id => runs
+	runs   = make(map[int64][]*commandRun)
+	runsMu sync.Mutex
+
+	// ops are the running bulk operations of each chat, chat id => op number => cancel
+	ops   = make(map[int64]map[int]context.CancelFunc)
+	opsN  int
+	opsMu sync.Mutex
+)
+
+// runCommand runs fn, the handler of command, and records in the audit log how long it
+// took and whether it failed, see sendErr.
+func runCommand(ud tgbotapi.Update, command string, fn func()) {
+	chat := ud.Message.Chat.ID
+	run := new(commandRun)
+
+	runsMu.Lock()
+	runs[chat] = append(runs[chat], run)
+	runsMu.Unlock()
+
+	start := time.Now()
+	fn()
+
+	runsMu.Lock()
+	for i, r := range runs[chat] {
+		if r == run {
+			runs[chat] = append(runs[chat][:i], runs[chat][i+1:]...)
+			break
+		}
+	}
+	if len(runs[chat]) == 0 {
+		delete(runs, chat)
+	}
+	failed := run.failed
+	runsMu.Unlock()
+
+	audit(auditEntry{
+		Time:     start,
+		User:     ud.Message.From.UserName,
+		Chat:     chat,
+		Command:  command,
+		Failed:   failed,
+		Duration: time.Since(start).Seconds(),
+	})
+}
+
+// sendErr sends "*cmd:* err" to chat, and marks the commands running in it as failed
+func sendErr(cmd string, err error, chat int64) int {
+	runsMu.Lock()
+	for _, run := range runs[chat] {
+		run.failed = true
+	}
+	runsMu.Unlock()
+
+	return sendErr(cmd, err, chat)
+}
+
+// startOp registers a bulk operation in chat, it should stop once ctx is done.
+// finish must be called when the operation is over.
+func startOp(chat int64) (ctx context.Context, finish func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	opsMu.Lock()
+	defer opsMu.Unlock()
+
+	opsN++
+	n := opsN
+	if ops[chat] == nil {
+		ops[chat] = make(map[int]context.CancelFunc)
+	}
+	ops[chat][n] = cancel
+
+	return ctx, func() {
+		opsMu.Lock()
+		defer opsMu.Unlock()
+
+		cancel()
+		delete(ops[chat], n)
+		if len(ops[chat]) == 0 {
+			delete(ops, chat)
+		}
+	}
+}
+
+// cancelOps aborts the running bulk operations of the chat, e.g. a big delete or import
+func cancelOps(ud tgbotapi.Update) {
+	opsMu.Lock()
+	n := len(ops[ud.Message.Chat.ID])
+	for _, cancel := range ops[ud.Message.Chat.ID] {
+		cancel()
+	}
+	opsMu.Unlock()
+
+	if n == 0 {
+		send("*cancel:* nothing to cancel", ud.Message.Chat.ID, false)
+		return
+	}
+	send(fmt.Sprintf("*cancel:* cancelling %d operations", n), ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config is the content of the file passed with -config, flags that are set
+// explicitly take precedence over it.
+type config struct {
+	// these are only read on startup
+	Token     string   `yaml:"token"`
+	URL       string   `yaml:"url"`
+	Fallbacks []string `yaml:"fallback_urls"`
+	Username  string   `yaml:"username"`
+	Password  string   `yaml:"password"`
+	LogFile   string   `yaml:"logfile"`
+	StateFile string   `yaml:"statefile"`
+	HistoryDB string   `yaml:"history_db"`
+	NoLive    bool     `yaml:"no_live"`
+	APIListen string   `yaml:"api_listen"`
+	APIToken  string   `yaml:"api_token"`
+
+	// Live controls the live updates, seconds between updates and how many updates
+	Live struct {
+		Interval int `yaml:"interval"`
+		Duration int `yaml:"duration"`
+	} `yaml:"live"`
+
+	// NotifyChat receives the notifications, instead of the chat of the last message
+	NotifyChat int64 `yaml:"notify_chat"`
+
+	// Channel also gets the completed torrents, as an archive
+	Channel int64 `yaml:"channel"`
+
+	// Public lets anyone use the read only commands
+	Public bool `yaml:"public"`
+
+	// DefaultTrackers are given to the torrents added by their info hash
+	DefaultTrackers []string `yaml:"default_trackers"`
+
+	// AutoAdd adds the links found in messages without asking
+	AutoAdd bool `yaml:"auto_add"`
+
+	// WatchInterval is the seconds between checks for completed torrents
+	WatchInterval int `yaml:"watch_interval"`
+
+	// UploadOnlyAfter is how long torrents get to complete before they only seed, e.g. "720h"
+	UploadOnlyAfter string `yaml:"upload_only_after"`
+
+	// VerifyAlert is how long a torrent can be verifying before alerting about it, e.g. "6h"
+	VerifyAlert string `yaml:"verify_alert"`
+
+	// TransDir is transmission's config dir, PruneInterval is how often to prune it, e.g. "168h"
+	TransDir      string `yaml:"transmission_dir"`
+	PruneInterval string `yaml:"prune_interval"`
+
+	// LowDisk is the free space on the download dir to alert below, e.g. "20GB"
+	LowDisk string `yaml:"low_disk"`
+
+	// AuditLog is the file every command gets logged to, for 'botstats'
+	AuditLog string `yaml:"audit_log"`
+
+	// Locale formats numbers and dates for users whose language telegram doesn't give, e.g. "de"
+	Locale string `yaml:"locale"`
+
+	// ConfirmSize is the size to ask about before starting added torrents, e.g. "20GB"
+	ConfirmSize string `yaml:"confirm_size"`
+
+	// PreallocWarn is the size to ask about before starting torrents while files are fully preallocated, e.g. "50GB"
+	PreallocWarn string `yaml:"prealloc_warn"`
+
+	// Report is when to send the summary report, e.g. "daily 09:00" or "weekly 09:00"
+	Report string `yaml:"report"`
+
+	// Timeout is how long transmission gets to answer a call, e.g. "30s"
+	Timeout string `yaml:"timeout"`
+
+	Masters  []string `yaml:"masters"`
+	AddRetry string   `yaml:"add_retry"`
+	LiveCap  *int     `yaml:"live_cap"`
+
+	// ErrorAlerts notifies about the torrents that get an error
+	ErrorAlerts *bool `yaml:"error_alerts"`
+
+	// IdleHints is how long without a command before the big notifications come with hints,
+	// e.g. "336h", IdleGreeting comes before them
+	IdleHints    string `yaml:"idle_hints"`
+	IdleGreeting string `yaml:"idle_greeting"`
+
+	// AddStagger is how long a batch of adds is spread over, e.g. "10m"
+	AddStagger string `yaml:"add_stagger"`
+
+	// MaxMessages is how many messages a listing may take before it gets compacted
+	MaxMessages *int `yaml:"max_messages"`
+
+	ConfirmDel      *bool  `yaml:"confirm_del"`
+	ConfirmDelSize  string `yaml:"confirm_del_size"`
+	ConfirmDelCount int    `yaml:"confirm_del_count"`
+
+	Presets map[string]preset `yaml:"presets"`
+
+	// Webhooks are sent when a torrent completes
+	Webhooks []webhook `yaml:"webhooks"`
+
+	// TrackerDefaults are the add options of each tracker host
+	TrackerDefaults map[string]trackerDefault `yaml:"tracker_defaults"`
+
+	// ListingFields are the fields each listing shows, by command, e.g. list: [status, percent]
+	ListingFields map[string][]string `yaml:"listing_fields"`
+
+	// SeedGoals are the ratio or seed time each private tracker wants, for 'goals'
+	SeedGoals map[string]seedGoal `yaml:"seed_goals"`
+
+	// Indexers are the Torznab endpoints 'find' searches
+	Indexers []torznabIndexer `yaml:"torznab"`
+
+	// Hooks are scripts to run on events, event => script
+	Hooks map[string]string `yaml:"hooks"`
+
+	// Reactions are the commands that reacting to an info card runs, emoji => command
+	Reactions map[string]string `yaml:"reactions"`
+
+	// Daemon has the commands that restart transmission-daemon and show its status
+	Daemon struct {
+		Restart string `yaml:"restart"`
+		Status  string `yaml:"status"`
+	} `yaml:"daemon"`
+
+	// Docker is transmission's container, for 'container'
+	Docker struct {
+		Socket    string `yaml:"socket"`
+		Container string `yaml:"container"`
+	} `yaml:"docker"`
+
+	// Donor caps the upload during Hours, unless Probe answers faster than Latency
+	Donor struct {
+		Upload  string `yaml:"upload"`
+		Hours   string `yaml:"hours"`
+		Probe   string `yaml:"probe"`
+		Latency string `yaml:"latency"`
+	} `yaml:"donor"`
+
+	Turtle struct {
+		Ping      string `yaml:"ping"`
+		Plex      string `yaml:"plex"`
+		PlexToken string `yaml:"plex_token"`
+		Interval  int    `yaml:"interval"`
+	} `yaml:"turtle"`
+}
+
+var (
+	// configMu guards the settings that can change on reload
+	configMu sync.RWMutex
+
+	// flagMasters are the masters passed with -master, they survive reloads
+	flagMasters masterSlice
+
+	// setFlags holds the names of the flags that were passed explicitly
+	setFlags = make(map[string]bool)
+
+	// configLoaded is set after the first load, the startup only settings are ignored after it
+	configLoaded bool
+)
+
+// loadConfig reads ConfigFile and applies it on top of the flags
+func loadConfig() error {
+	if ConfigFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	var conf config
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return fmt.Errorf("%s: %s", ConfigFile, err)
+	}
+
+	var addRetry time.Duration
+	if conf.AddRetry != "" {
+		if addRetry, err = time.ParseDuration(conf.AddRetry); err != nil {
+			return fmt.Errorf("%s: add_retry: %s", ConfigFile, err)
+		}
+	}
+
+	var verifyAlert time.Duration
+	if conf.VerifyAlert != "" {
+		if verifyAlert, err = time.ParseDuration(conf.VerifyAlert); err != nil {
+			return fmt.Errorf("%s: verify_alert: %s", ConfigFile, err)
+		}
+	}
+
+	var idleHints time.Duration
+	if conf.IdleHints != "" {
+		if idleHints, err = time.ParseDuration(conf.IdleHints); err != nil {
+			return fmt.Errorf("%s: idle_hints: %s", ConfigFile, err)
+		}
+	}
+
+	var uploadOnlyAfter time.Duration
+	if conf.UploadOnlyAfter != "" {
+		if uploadOnlyAfter, err = time.ParseDuration(conf.UploadOnlyAfter); err != nil {
+			return fmt.Errorf("%s: upload_only_after: %s", ConfigFile, err)
+		}
+	}
+
+	var pruneInterval time.Duration
+	if conf.PruneInterval != "" {
+		if pruneInterval, err = time.ParseDuration(conf.PruneInterval); err != nil {
+			return fmt.Errorf("%s: prune_interval: %s", ConfigFile, err)
+		}
+	}
+
+	var lowDisk uint64
+	if conf.LowDisk != "" {
+		if lowDisk, err = humanize.ParseBytes(conf.LowDisk); err != nil {
+			return fmt.Errorf("%s: low_disk: %s", ConfigFile, err)
+		}
+	}
+
+	var confirmSize uint64
+	if conf.ConfirmSize != "" {
+		if confirmSize, err = humanize.ParseBytes(conf.ConfirmSize); err != nil {
+			return fmt.Errorf("%s: confirm_size: %s", ConfigFile, err)
+		}
+	}
+
+	var preallocWarn uint64
+	if conf.PreallocWarn != "" {
+		if preallocWarn, err = humanize.ParseBytes(conf.PreallocWarn); err != nil {
+			return fmt.Errorf("%s: prealloc_warn: %s", ConfigFile, err)
+		}
+	}
+
+	var timeout time.Duration
+	if conf.Timeout != "" {
+		if timeout, err = time.ParseDuration(conf.Timeout); err != nil {
+			return fmt.Errorf("%s: timeout: %s", ConfigFile, err)
+		}
+	}
+
+	var donorUpload uint64
+	if conf.Donor.Upload != "" {
+		if donorUpload, err = humanize.ParseBytes(conf.Donor.Upload); err != nil {
+			return fmt.Errorf("%s: donor.upload: %s", ConfigFile, err)
+		}
+	}
+
+	var donorLatency time.Duration
+	if conf.Donor.Latency != "" {
+		if donorLatency, err = time.ParseDuration(conf.Donor.Latency); err != nil {
+			return fmt.Errorf("%s: donor.latency: %s", ConfigFile, err)
+		}
+	}
+
+	if _, err := parseReportSchedule(conf.Report); err != nil {
+		return fmt.Errorf("%s: report: %s", ConfigFile, err)
+	}
+
+	seedGoals := make(map[string]seedGoal)
+	for name, goal := range conf.SeedGoals {
+		if goal.SeedTime != "" {
+			if goal.seedTime, err = time.ParseDuration(goal.SeedTime); err != nil {
+				return fmt.Errorf("%s: seed_goals: %s: %s", ConfigFile, name, err)
+			}
+		}
+		seedGoals[name] = goal
+	}
+
+	var addStagger time.Duration
+	if conf.AddStagger != "" {
+		if addStagger, err = time.ParseDuration(conf.AddStagger); err != nil {
+			return fmt.Errorf("%s: add_stagger: %s", ConfigFile, err)
+		}
+	}
+
+	if err := checkListingFields(conf.ListingFields); err != nil {
+		return fmt.Errorf("%s: listing_fields: %s", ConfigFile, err)
+	}
+
+	var confirmDelSize uint64
+	if conf.ConfirmDelSize != "" {
+		if confirmDelSize, err = humanize.ParseBytes(conf.ConfirmDelSize); err != nil {
+			return fmt.Errorf("%s: confirm_del_size: %s", ConfigFile, err)
+		}
+	}
+
+	// the settings that can't change while running
+	if !configLoaded {
+		configLoaded = true
+
+		setString := func(name string, value string, dst *string) {
+			if !setFlags[name] && value != "" {
+				*dst = value
+			}
+		}
+		setString("token", conf.Token, &BotToken)
+		setString("url", conf.URL, &RPCURL)
+		if !setFlags["fallback-url"] && len(conf.Fallbacks) > 0 {
+			FallbackURLs = conf.Fallbacks
+		}
+		setString("username", conf.Username, &Username)
+		setString("password", conf.Password, &Password)
+		setString("logfile", conf.LogFile, &LogFile)
+		setString("statefile", conf.StateFile, &StateFile)
+		setString("history-db", conf.HistoryDB, &HistoryDB)
+		setString("api-listen", conf.APIListen, &APIListen)
+		setString("api-token", conf.APIToken, &APIToken)
+
+		if !setFlags["no-live"] && conf.NoLive {
+			NoLive = true
+		}
+		if conf.Live.Interval > 0 {
+			interval = time.Duration(conf.Live.Interval)
+		}
+		if conf.Live.Duration > 0 {
+			duration = conf.Live.Duration
+		}
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	if !setFlags["notify-chat"] {
+		NotifyChat = conf.NotifyChat
+	}
+	if !setFlags["channel"] {
+		Channel = conf.Channel
+	}
+	if !setFlags["public"] {
+		Public = conf.Public
+	}
+	if !setFlags["tracker"] {
+		DefaultTrackers = conf.DefaultTrackers
+	}
+	if !setFlags["auto-add"] {
+		AutoAdd = conf.AutoAdd
+	}
+	if !setFlags["watch-interval"] && conf.WatchInterval > 0 {
+		WatchInterval = conf.WatchInterval
+	}
+
+	Masters = append(masterSlice{}, flagMasters...)
+	for _, master := range conf.Masters {
+		Masters.Set(strings.Replace(master, "@", "", -1))
+	}
+
+	Webhooks = conf.Webhooks
+	Hooks = conf.Hooks
+	Reactions = conf.Reactions
+	Indexers = conf.Indexers
+	TrackerDefaults = conf.TrackerDefaults
+	SeedGoals = seedGoals
+	ListingFields = conf.ListingFields
+
+	Presets = make(map[string]preset)
+	for name, p := range conf.Presets {
+		Presets[strings.ToLower(name)] = p
+	}
+
+	if !setFlags["verify-alert"] && conf.VerifyAlert != "" {
+		VerifyAlert = verifyAlert
+	}
+	if !setFlags["upload-only-after"] {
+		UploadOnlyAfter = uploadOnlyAfter
+	}
+	if !setFlags["transmission-dir"] {
+		TransDir = conf.TransDir
+	}
+	if !setFlags["prune-interval"] && conf.PruneInterval != "" {
+		PruneInterval = pruneInterval
+	}
+	if !setFlags["low-disk"] {
+		LowDisk = lowDisk
+	}
+	if !setFlags["audit-log"] {
+		AuditLog = conf.AuditLog
+	}
+	if !setFlags["report"] {
+		Report = conf.Report
+	}
+	if !setFlags["locale"] && conf.Locale != "" {
+		Locale = conf.Locale
+	}
+	if !setFlags["confirm-size"] {
+		ConfirmSize = confirmSize
+	}
+	if !setFlags["prealloc-warn"] && conf.PreallocWarn != "" {
+		PreallocWarn = preallocWarn
+	}
+	if !setFlags["timeout"] && conf.Timeout != "" {
+		CommandTimeout = timeout
+	}
+	if !setFlags["add-retry"] && conf.AddRetry != "" {
+		AddRetry = addRetry
+	}
+	if !setFlags["add-stagger"] {
+		AddStagger = addStagger
+	}
+	if !setFlags["live-cap"] && conf.LiveCap != nil {
+		LiveCap = *conf.LiveCap
+	}
+	if !setFlags["max-messages"] && conf.MaxMessages != nil {
+		MaxMessages = *conf.MaxMessages
+	}
+	if !setFlags["confirm-del"] && conf.ConfirmDel != nil {
+		ConfirmDel = *conf.ConfirmDel
+	}
+	if !setFlags["error-alerts"] && conf.ErrorAlerts != nil {
+		ErrorAlerts = *conf.ErrorAlerts
+	}
+	if !setFlags["idle-hints"] && conf.IdleHints != "" {
+		IdleHints = idleHints
+	}
+	if !setFlags["idle-greeting"] && conf.IdleGreeting != "" {
+		IdleGreeting = conf.IdleGreeting
+	}
+	if !setFlags["confirm-del-size"] && conf.ConfirmDelSize != "" {
+		ConfirmDelSize = confirmDelSize
+	}
+	if !setFlags["confirm-del-count"] && conf.ConfirmDelCount > 0 {
+		ConfirmDelCount = conf.ConfirmDelCount
+	}
+	if !setFlags["turtle-ping"] {
+		TurtlePing = conf.Turtle.Ping
+	}
+	if !setFlags["turtle-plex"] {
+		TurtlePlexURL = conf.Turtle.Plex
+	}
+	if !setFlags["turtle-plex-token"] {
+		TurtlePlexToken = conf.Turtle.PlexToken
+	}
+	if !setFlags["turtle-interval"] && conf.Turtle.Interval > 0 {
+		TurtleInterval = conf.Turtle.Interval
+	}
+	if !setFlags["daemon-restart"] {
+		DaemonRestart = conf.Daemon.Restart
+	}
+	if !setFlags["daemon-status"] {
+		DaemonStatus = conf.Daemon.Status
+	}
+	if !setFlags["docker-socket"] && conf.Docker.Socket != "" {
+		DockerSocket = conf.Docker.Socket
+	}
+	if !setFlags["docker-container"] {
+		DockerContainer = conf.Docker.Container
+	}
+	if !setFlags["donor-upload"] {
+		DonorUpload = donorUpload
+	}
+	if !setFlags["donor-hours"] {
+		DonorHours = conf.Donor.Hours
+	}
+	if !setFlags["donor-probe"] {
+		DonorProbe = conf.Donor.Probe
+	}
+	if !setFlags["donor-latency"] && conf.Donor.Latency != "" {
+		DonorLatency = donorLatency
+	}
+
+	return nil
+}
+
+// recordFlags remembers the explicitly passed flags, must be called after flag.Parse
+func recordFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	flagMasters = append(masterSlice{}, Masters...)
+}
+
+// reloadConfig re-reads the config file, and starts whatever got newly enabled. the token,
+// transmission's URL and credentials, and the log files need a restart to change. the state
+// is the bot's own and isn't touched.
+func reloadConfig() error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	// still waiting for the setup to connect, they start after it
+	if rpcClient() == nil {
+		return nil
+	}
+
+	startTurtleAuto()
+	startDonor()
+	startWatcher()
+	startPrune()
+	startDiskWatch()
+	return nil
+}
+
+// reload re-reads the config file at runtime
+func reload(ud tgbotapi.Update) {
+	if !isAdmin(ud.Message.From.UserName) {
+		send("*reload:* only admins can reload", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if err := reloadConfig(); err != nil {
+		sendErr("reload", err, ud.Message.Chat.ID)
+		return
+	}
+
+	configMu.RLock()
+	n := len(Masters)
+	configMu.RUnlock()
+
+	send(fmt.Sprintf("*reload:* done, %d masters from flags and config", n), ud.Message.Chat.ID, false)
+}
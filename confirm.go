@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// deleteTTL is how long a delete waits for its confirmation, the buttons do nothing after it
+const deleteTTL = 10 * time.Minute
+
+// pendingDelete is a delete that is waiting for confirmation
+type pendingDelete struct {
+	ids       []int
+	cmd       string
+	withData  bool
+	afterSeed bool // delete them once they reach their seed target, see deleteAfterSeed
+}
+
+var (
+	// pendingDeletes are kept in memory and referenced by a number in the buttons' data,
+	// since the IDs might not fit in telegram's 64 bytes of callback data.
+	pendingDeletes   = make(map[int]pendingDelete)
+	pendingDeletesN  int
+	pendingDeletesMu sync.Mutex
+)
+
+// confirmDelete asks for confirmation with Confirm/Cancel buttons before deleting ids, it returns
+// false if no confirmation is needed. with ConfirmDelSize or ConfirmDelCount set, only the deletes
+// above them need confirmation. the ones matched by a filter, e.g. "del name:ubuntu*", always
+// need it, to see what matched. with afterSeed the confirmed delete waits for the seed target.
+func confirmDelete(chat int64, ids []int, cmd string, withData, matched, afterSeed bool) bool {
+	configMu.RLock()
+	enabled, maxSize, maxCount := ConfirmDel, ConfirmDelSize, ConfirmDelCount
+	configMu.RUnlock()
+
+	if !enabled && !matched {
+		return false
+	}
+
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr(cmd, err, chat)
+		return true
+	}
+
+	wanted := make(map[int]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var size uint64
+	buf := new(bytes.Buffer)
+	for i := range torrents {
+		if wanted[torrents[i].ID] {
+			size += torrents[i].SizeWhenDone
+			buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+		}
+	}
+
+	thresholds := maxSize > 0 || maxCount > 0
+	if !matched && thresholds && (maxSize == 0 || size <= maxSize) && (maxCount == 0 || len(ids) <= maxCount) {
+		return false
+	}
+
+	pendingDeletesMu.Lock()
+	pendingDeletesN++
+	n := pendingDeletesN
+	pendingDeletes[n] = pendingDelete{ids: ids, cmd: cmd, withData: withData, afterSeed: afterSeed}
+	pendingDeletesMu.Unlock()
+
+	what := "Delete"
+	if withData {
+		what = "Delete with data"
+	}
+
+	if afterSeed {
+		what += " once they reach their seed target"
+	}
+
+	text := fmt.Sprintf("%s %d torrents (%s)?\n\n%s", what, len(ids), chatLocale(chat).bytes(size), buf.String())
+	if runes := []rune(text); len(runes) > 4000 {
+		text = string(runes[:4000]) + "…"
+	}
+
+	msg := tgbotapi.NewMessage(chat, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Confirm", fmt.Sprintf("del:confirm:%d", n)),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", fmt.Sprintf("del:cancel:%d", n)),
+		),
+	)
+	sent, err := botSend(msg)
+	if err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+
+	// a confirmation from long ago shouldn't delete anything
+	time.AfterFunc(deleteTTL, func() {
+		pendingDeletesMu.Lock()
+		_, ok := pendingDeletes[n]
+		delete(pendingDeletes, n)
+		pendingDeletesMu.Unlock()
+
+		if ok && err == nil {
+			botSend(tgbotapi.NewEditMessageText(chat, sent.MessageID, "Expired"))
+		}
+	})
+	return true
+}
+
+// deleteCallback handles the Confirm/Cancel buttons of a delete
+func deleteCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	pendingDeletesMu.Lock()
+	pd, ok := pendingDeletes[n]
+	delete(pendingDeletes, n)
+	pendingDeletesMu.Unlock()
+
+	if !ok {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "This delete has expired"))
+		botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, "Expired"))
+		return
+	}
+
+	if args[0] != "confirm" {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Cancelled"))
+		botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, "Cancelled"))
+		return
+	}
+
+	botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, "Confirmed"))
+	if pd.afterSeed {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Waiting for the seed target"))
+		deleteAfterSeed(cq.Message.Chat.ID, pd.ids, pd.cmd, pd.withData)
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Deleting"))
+	removeTorrents(cq.Message.Chat.ID, pd.ids, pd.cmd, pd.withData)
+}
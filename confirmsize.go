@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// confirmSizeWait is how long to wait for the metadata of a magnet before giving up on its size
+	confirmSizeWait = time.Hour
+
+	// confirmSizeCheck is how often the metadata is checked for
+	confirmSizeCheck = 10 * time.Second
+)
+
+// confirmSize waits for the size of a torrent that was just added in chat, if it's bigger
+// than ConfirmSize it pauses it and asks whether to start or remove it.
+func confirmSize(chat int64, id int) {
+	configMu.RLock()
+	limit := ConfirmSize
+	configMu.RUnlock()
+
+	if limit == 0 {
+		return
+	}
+
+	// magnets get their size once the metadata is downloaded
+	var torrent *rpcTorrent
+	for start := time.Now(); time.Since(start) < confirmSizeWait; time.Sleep(confirmSizeCheck) {
+		var err error
+		torrent, err = getTorrentExtra(id, "name", "totalSize", "metadataPercentComplete", "hashString")
+		if err != nil {
+			return // removed
+		}
+		if torrent.MetadataPercentComplete == 1 {
+			break
+		}
+	}
+	if torrent.MetadataPercentComplete < 1 || torrent.TotalSize <= limit {
+		return
+	}
+
+	if err := rpcCall("torrent-stop", map[string]interface{}{"ids": []int{id}}, nil); err != nil {
+		sendErr("add", err, chat)
+		return
+	}
+
+	loc := chatLocale(chat)
+	msg := tgbotapi.NewMessage(chat, fmt.Sprintf("%s is %s, more than %s. It's paused until you confirm.",
+		torrent.Name, loc.bytes(torrent.TotalSize), loc.bytes(limit)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Start", "size:start:"+strings.ToLower(torrent.HashString)),
+			tgbotapi.NewInlineKeyboardButtonData("Remove", "size:remove:"+strings.ToLower(torrent.HashString)),
+		),
+	)
+	if _, err := botSend(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// sizeCallback handles the Start/Remove buttons of confirmSize
+func sizeCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	// the button may be from before a restart, the hash makes sure it's still the same torrent
+	torrent, err := getTorrentByHash(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+
+	method, answer := "torrent-start", "Started"
+	rpcArgs := map[string]interface{}{"ids": []int{torrent.ID}}
+	if args[0] == "remove" {
+		// it didn't get far, the partial data goes too
+		method, answer = "torrent-remove", "Removed"
+		rpcArgs["delete-local-data"] = true
+	}
+
+	if err := rpcCall(method, rpcArgs, nil); err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, answer))
+	botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, answer))
+}
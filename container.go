@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// containerLogLines is how many lines of logs "container logs" shows by default
+const containerLogLines = 30
+
+// dockerContainer is the part of docker's container inspect that's shown
+type dockerContainer struct {
+	Name  string `json:"Name"`
+	State struct {
+		Status     string `json:"Status"`
+		StartedAt  string `json:"StartedAt"`
+		ExitCode   int    `json:"ExitCode"`
+		Error      string `json:"Error"`
+		Restarting bool   `json:"Restarting"`
+		Health     *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	RestartCount int `json:"RestartCount"`
+	Config       struct {
+		Image string `json:"Image"`
+		Tty   bool   `json:"Tty"`
+	} `json:"Config"`
+}
+
+// dockerCall calls docker's API on DockerSocket, out is filled from the JSON answer if it's given
+func dockerCall(method, path string, out interface{}) ([]byte, error) {
+	configMu.RLock()
+	socket := DockerSocket
+	configMu.RUnlock()
+
+	client := &http.Client{
+		Timeout: 2 * time.Minute, // a restart waits for the container to stop
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	req, err := http.NewRequest(method, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("docker: %s", apiErr.Message)
+		}
+		return nil, fmt.Errorf("docker: %s", resp.Status)
+	}
+
+	if out != nil {
+		return body, json.Unmarshal(body, out)
+	}
+	return body, nil
+}
+
+// container shows the status or the logs of transmission's docker container, or restarts it,
+// "container status", "container restart" and "container logs [lines]". admins only, since
+// the docker socket can do anything on the host.
+func container(ud tgbotapi.Update, tokens []string) {
+	if !isAdmin(ud.Message.From.UserName) {
+		send("*container:* only admins can manage the container", ud.Message.Chat.ID, false)
+		return
+	}
+
+	configMu.RLock()
+	name := DockerContainer
+	configMu.RUnlock()
+
+	if name == "" {
+		send("*container:* no container, set one with -docker-container", ud.Message.Chat.ID, false)
+		return
+	}
+	if len(tokens) == 0 {
+		send("*container:* takes status, restart or logs", ud.Message.Chat.ID, false)
+		return
+	}
+
+	path := "/containers/" + url.PathEscape(name)
+	switch strings.ToLower(tokens[0]) {
+	case "status":
+		var c dockerContainer
+		if _, err := dockerCall("GET", path+"/json", &c); err != nil {
+			sendErr("container", err, ud.Message.Chat.ID)
+			return
+		}
+
+		text := fmt.Sprintf("*%s* (%s)\nState: *%s*", mdReplacer.Replace(strings.TrimPrefix(c.Name, "/")),
+			mdReplacer.Replace(c.Config.Image), c.State.Status)
+		if c.State.Health != nil {
+			text += fmt.Sprintf(", %s", c.State.Health.Status)
+		}
+		if started, err := time.Parse(time.RFC3339Nano, c.State.StartedAt); err == nil && c.State.Status == "running" {
+			text += fmt.Sprintf("\nUp for: *%s*", time.Since(started).Round(time.Second))
+		}
+		if c.State.Status == "exited" {
+			text += fmt.Sprintf("\nExit code: *%d*", c.State.ExitCode)
+		}
+		if c.State.Error != "" {
+			text += "\nError: " + mdReplacer.Replace(c.State.Error)
+		}
+		text += fmt.Sprintf("\nRestarts: *%d*", c.RestartCount)
+		send(text, ud.Message.Chat.ID, true)
+
+	case "restart":
+		send("*container:* restarting "+name, ud.Message.Chat.ID, false)
+		if _, err := dockerCall("POST", path+"/restart", nil); err != nil {
+			sendErr("container", err, ud.Message.Chat.ID)
+			return
+		}
+
+		took, err := waitRPC(daemonWait)
+		if err != nil {
+			send(fmt.Sprintf("*container:* restarted, but transmission isn't answering after %s: %s", daemonWait, err), ud.Message.Chat.ID, false)
+			return
+		}
+		send(fmt.Sprintf("*container:* restarted, transmission answers again after %s", took.Round(time.Second)), ud.Message.Chat.ID, false)
+
+	case "logs":
+		lines := containerLogLines
+		if len(tokens) > 1 {
+			n, err := strconv.Atoi(tokens[1])
+			if err != nil || n < 1 {
+				send(fmt.Sprintf("*container:* %s is not a number of lines", tokens[1]), ud.Message.Chat.ID, false)
+				return
+			}
+			lines = n
+		}
+
+		var c dockerContainer
+		if _, err := dockerCall("GET", path+"/json", &c); err != nil {
+			sendErr("container", err, ud.Message.Chat.ID)
+			return
+		}
+
+		raw, err := dockerCall("GET", fmt.Sprintf("%s/logs?stdout=1&stderr=1&tail=%d", path, lines), nil)
+		if err != nil {
+			sendErr("container", err, ud.Message.Chat.ID)
+			return
+		}
+
+		logs := string(raw)
+		if !c.Config.Tty {
+			logs = demuxDockerLogs(raw)
+		}
+		logs = strings.TrimSpace(logs)
+		if logs == "" {
+			send("*container:* no logs", ud.Message.Chat.ID, false)
+			return
+		}
+
+		// keep the end, it's the interesting part
+		if runes := []rune(logs); len(runes) > 4000 {
+			logs = "…" + string(runes[len(runes)-4000:])
+		}
+		send("```\n"+strings.Replace(logs, "`", "'", -1)+"\n```", ud.Message.Chat.ID, true)
+
+	default:
+		send("*container:* takes status, restart or logs", ud.Message.Chat.ID, false)
+	}
+}
+
+// demuxDockerLogs joins the frames docker sends the logs of containers without a TTY in,
+// each has an 8 byte header with the stream and the length of the frame.
+func demuxDockerLogs(raw []byte) string {
+	var buf bytes.Buffer
+	for len(raw) >= 8 {
+		size := int(binary.BigEndian.Uint32(raw[4:8]))
+		raw = raw[8:]
+		if size > len(raw) {
+			size = len(raw)
+		}
+		buf.Write(raw[:size])
+		raw = raw[size:]
+	}
+	return buf.String()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// daemonWait is how long to wait for transmission to answer again after a restart
+	daemonWait = 2 * time.Minute
+
+	// daemonCommandTimeout is how long the restart and status commands can run
+	daemonCommandTimeout = time.Minute
+)
+
+// daemon restarts transmission-daemon or shows its status, through the commands given with
+// -daemon-restart and -daemon-status, e.g. "systemctl restart transmission-daemon" or an ssh.
+func daemon(ud tgbotapi.Update, tokens []string) {
+	if !isAdmin(ud.Message.From.UserName) {
+		send("*daemon:* only admins can manage the daemon", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) == 0 {
+		send("*daemon:* takes restart or status", ud.Message.Chat.ID, false)
+		return
+	}
+
+	configMu.RLock()
+	restart, status := DaemonRestart, DaemonStatus
+	configMu.RUnlock()
+
+	switch strings.ToLower(tokens[0]) {
+	case "restart":
+		if restart == "" {
+			send("*daemon:* no restart command, set one with -daemon-restart", ud.Message.Chat.ID, false)
+			return
+		}
+
+		send("*daemon:* restarting", ud.Message.Chat.ID, false)
+		if out, err := runDaemonCommand(restart); err != nil {
+			send(fmt.Sprintf("*daemon:* %s\n%s", err, out), ud.Message.Chat.ID, false)
+			return
+		}
+
+		took, err := waitRPC(daemonWait)
+		if err != nil {
+			send(fmt.Sprintf("*daemon:* restarted, but transmission isn't answering after %s: %s", daemonWait, err), ud.Message.Chat.ID, false)
+			return
+		}
+		send(fmt.Sprintf("*daemon:* restarted, transmission answers again after %s", took.Round(time.Second)), ud.Message.Chat.ID, false)
+
+	case "status":
+		var buf strings.Builder
+		if status != "" {
+			out, err := runDaemonCommand(status)
+			if err != nil {
+				buf.WriteString(err.Error() + "\n")
+			}
+			if out != "" {
+				buf.WriteString(out + "\n")
+			}
+		}
+
+		if _, err := sessionGet(); err != nil {
+			buf.WriteString("RPC: " + err.Error())
+		} else {
+			buf.WriteString("RPC: reachable, Transmission " + rpcClient().Version())
+		}
+		send(buf.String(), ud.Message.Chat.ID, false)
+
+	default:
+		send("*daemon:* takes restart or status", ud.Message.Chat.ID, false)
+	}
+}
+
+// runDaemonCommand runs command through sh, it returns its output
+func runDaemonCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), daemonCommandTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// waitRPC waits until transmission answers, for at most limit, it returns how long that took
+func waitRPC(limit time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	// the daemon might still be going down
+	time.Sleep(2 * time.Second)
+
+	var err error
+	for time.Since(start) < limit {
+		if _, err = sessionGet(); err == nil {
+			return time.Since(start), nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return 0, err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// dashboardTop is how many of the most active torrents the dashboard shows
+const dashboardTop = 5
+
+func init() {
+	onPoll(updateDashboards)
+}
+
+// dashboard pins a message that's kept up to date with the speeds, the counts, the most
+// active torrents and the free space, "dashboard on" and "dashboard off". it's updated on
+// every poll of the watcher.
+func dashboard(ud tgbotapi.Update, tokens []string) {
+	chat := ud.Message.Chat.ID
+
+	stateMu.Lock()
+	msgID, on := state.Dashboards[chat]
+	stateMu.Unlock()
+
+	if len(tokens) == 0 {
+		if on {
+			send("The dashboard is on, _dashboard off_ stops it", chat, true)
+			return
+		}
+		send("The dashboard is off, _dashboard on_ pins one", chat, true)
+		return
+	}
+
+	switch strings.ToLower(tokens[0]) {
+	case "on":
+		configMu.RLock()
+		watching := WatchInterval > 0
+		configMu.RUnlock()
+		if !watching {
+			send("*dashboard:* it's updated by the watcher, set -watch-interval", chat, false)
+			return
+		}
+
+		torrents, err := getTorrents(statsFields...)
+		if err != nil {
+			sendErr("dashboard", err, chat)
+			return
+		}
+
+		// the old one stays where it is, but stops updating
+		if on {
+			editMarkdown(tgbotapi.NewEditMessageText(chat, msgID, "Dashboard moved to a new message"))
+		}
+
+		newID := pinDashboard(chat, dashboardText(chat, torrents, dashboardFree()))
+		if newID == 0 {
+			return
+		}
+		setDashboard(chat, newID)
+
+	case "off":
+		if !on {
+			send("*dashboard:* it's not on", chat, false)
+			return
+		}
+
+		stateMu.Lock()
+		delete(state.Dashboards, chat)
+		if err := saveState(); err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+		stateMu.Unlock()
+
+		editMarkdown(tgbotapi.NewEditMessageText(chat, msgID, "Dashboard stopped, dashboard on starts a new one"))
+		send("Stopped the dashboard", chat, false)
+
+	default:
+		send("*dashboard:* takes on or off", chat, false)
+	}
+}
+
+// setDashboard records msgID as the dashboard of chat
+func setDashboard(chat int64, msgID int) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if state.Dashboards == nil {
+		state.Dashboards = make(map[int64]int)
+	}
+	state.Dashboards[chat] = msgID
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
+
+// pinDashboard sends text and pins it quietly, it returns the id of the message, 0 if it
+// couldn't be sent. in groups the bot needs to be allowed to pin.
+func pinDashboard(chat int64, text string) int {
+	msgID := send(text, chat, true)
+	if msgID == 0 {
+		return 0
+	}
+
+	pin := tgbotapi.PinChatMessageConfig{ChatID: chat, MessageID: msgID, DisableNotification: true}
+	if _, err := Bot.PinChatMessage(pin); err != nil {
+		send("*dashboard:* couldn't pin it, it's updated anyway: "+err.Error(), chat, false)
+	}
+	return msgID
+}
+
+// updateDashboards edits the dashboards with the torrents of the poll
+func updateDashboards(torrents transmission.Torrents) {
+	stateMu.Lock()
+	dashboards := make(map[int64]int, len(state.Dashboards))
+	for chat, msgID := range state.Dashboards {
+		dashboards[chat] = msgID
+	}
+	stateMu.Unlock()
+
+	if len(dashboards) == 0 {
+		return
+	}
+
+	free := dashboardFree()
+	for chat, msgID := range dashboards {
+		edit := tgbotapi.NewEditMessageText(chat, msgID, dashboardText(chat, torrents, free))
+		edit.ParseMode = tgbotapi.ModeMarkdown
+		_, err := editMarkdown(edit)
+		if err == nil || strings.Contains(err.Error(), "message is not modified") {
+			continue
+		}
+
+		// deleted, that's as good as dashboard off
+		if messageGone(err) {
+			stateMu.Lock()
+			if state.Dashboards[chat] == msgID {
+				delete(state.Dashboards, chat)
+				if err := saveState(); err != nil {
+					logger.Printf("[ERROR] State: %s", err)
+				}
+			}
+			stateMu.Unlock()
+			continue
+		}
+		if !tooOldToEdit(err) {
+			logger.Printf("[ERROR] Dashboard: %s", err)
+			continue
+		}
+
+		// too old to edit, it takes a new message
+		if newID := pinDashboard(chat, edit.Text); newID != 0 {
+			setDashboard(chat, newID)
+		}
+	}
+}
+
+// dashboardFree returns the free space on the download dir, -1 if transmission doesn't say
+func dashboardFree() int64 {
+	session, err := sessionGet()
+	if err != nil {
+		return -1
+	}
+	free, err := freeSpace(session.DownloadDir)
+	if err != nil {
+		return -1
+	}
+	return int64(free)
+}
+
+// dashboardText formats the dashboard of chat
+func dashboardText(chat int64, torrents transmission.Torrents, free int64) string {
+	loc := chatLocale(chat)
+
+	var down, up uint64
+	var downloading, seeding, paused, errored int
+	var active transmission.Torrents
+	for _, t := range torrents {
+		down += t.RateDownload
+		up += t.RateUpload
+		switch {
+		case hasError(t):
+			errored++
+		case isDownloading(t):
+			downloading++
+		case isSeeding(t):
+			seeding++
+		case isPaused(t):
+			paused++
+		}
+		if isActive(t) {
+			active = append(active, t)
+		}
+	}
+	gosort.Slice(active, func(i, j int) bool {
+		return active[i].RateDownload+active[i].RateUpload > active[j].RateDownload+active[j].RateUpload
+	})
+	if len(active) > dashboardTop {
+		active = active[:dashboardTop]
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("📊 ↓ *%s*  ↑ *%s*\n", loc.bytes(down), loc.bytes(up)))
+	buf.WriteString(fmt.Sprintf("Downloading: *%d*  Seeding: *%d*  Paused: *%d*  Errors: *%d*\n",
+		downloading, seeding, paused, errored))
+	if free >= 0 {
+		buf.WriteString(fmt.Sprintf("Free: *%s*\n", loc.bytes(uint64(free))))
+	}
+
+	if len(active) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, t := range active {
+		buf.WriteString(fmt.Sprintf("`<%d>` %s\n↓ %s  ↑ %s  %s%%\n", t.ID, mdReplacer.Replace(displayName(chat, t.Name)),
+			loc.bytes(t.RateDownload), loc.bytes(t.RateUpload), loc.float(t.PercentDone*100, 1)))
+	}
+
+	buf.WriteString(fmt.Sprintf("\n_Updated %s_", loc.time(time.Now())))
+	return buf.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// detail shows what info leaves out of a torrent: its hash, the metadata of the .torrent
+// and where it's downloaded to.
+func detail(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*detail:* needs a torrent ID number", ud.Message.Chat.ID, false)
+		return
+	}
+
+	for _, token := range tokens {
+		id, err := strconv.Atoi(token)
+		if err != nil {
+			send(fmt.Sprintf("*detail:* %s is not a number", token), ud.Message.Chat.ID, false)
+			continue
+		}
+
+		torrent, err := getTorrentExtra(id, "name", "hashString", "comment", "creator", "dateCreated",
+			"pieceSize", "pieceCount", "isPrivate", "downloadDir")
+		if err != nil {
+			sendErr("detail", err, ud.Message.Chat.ID)
+			continue
+		}
+
+		created := "unknown"
+		if torrent.DateCreated > 0 {
+			created = chatLocale(ud.Message.Chat.ID).time(time.Unix(torrent.DateCreated, 0))
+		}
+
+		private := "no"
+		if torrent.IsPrivate {
+			private = "yes"
+		}
+
+		buf := new(bytes.Buffer)
+		buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n\n", torrent.ID, mdReplacer.Replace(displayName(ud.Message.Chat.ID, torrent.Name))))
+		buf.WriteString(fmt.Sprintf("Hash: `%s`\n", torrent.HashString))
+		buf.WriteString(fmt.Sprintf("Pieces: *%d* of *%s*\n", torrent.PieceCount, chatLocale(ud.Message.Chat.ID).bytes(torrent.PieceSize)))
+		buf.WriteString(fmt.Sprintf("Private: *%s*\n", private))
+		buf.WriteString(fmt.Sprintf("Created: *%s*", created))
+		if torrent.Creator != "" {
+			buf.WriteString(fmt.Sprintf(" by *%s*", mdReplacer.Replace(torrent.Creator)))
+		}
+		buf.WriteString(fmt.Sprintf("\nDirectory: `%s`\n", torrent.DownloadDir))
+		if torrent.Comment != "" {
+			buf.WriteString("\n" + mdReplacer.Replace(torrent.Comment) + "\n")
+		}
+
+		send(buf.String(), ud.Message.Chat.ID, true)
+	}
+}
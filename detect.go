@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// linkRegex matches the magnets and the .torrent URLs in a message
+var linkRegex = regexp.MustCompile(`magnet:\?[^\s<>"]+|https?://[^\s<>"]+?\.torrent\b[^\s<>"]*`)
+
+var (
+	// pendingLinks are the detected links waiting for the Add button, by number
+	pendingLinks   = make(map[int][]string)
+	pendingLinksN  int
+	pendingLinksMu sync.Mutex
+)
+
+// detectLinks finds the magnets and the .torrent URLs in msg, in its text or caption
+// and behind its text links, e.g. in a post forwarded from a channel.
+func detectLinks(msg *tgbotapi.Message) []string {
+	seen := make(map[string]bool)
+	var links []string
+	found := func(link string) {
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, text := range []string{msg.Text, msg.Caption} {
+		for _, link := range linkRegex.FindAllString(text, -1) {
+			found(link)
+		}
+	}
+
+	for _, entities := range []*[]tgbotapi.MessageEntity{msg.Entities, msg.CaptionEntities} {
+		if entities == nil {
+			continue
+		}
+		for _, entity := range *entities {
+			if entity.Type == "text_link" && linkRegex.MatchString(entity.URL) {
+				found(entity.URL)
+			}
+		}
+	}
+	return links
+}
+
+// offerLinks adds the detected links right away with -auto-add, otherwise it asks first
+func offerLinks(ud tgbotapi.Update, links []string) {
+	configMu.RLock()
+	auto := AutoAdd
+	configMu.RUnlock()
+
+	if auto {
+		for _, link := range links {
+			go addWithRetry(ud, []string{link}, addOptions{})
+		}
+		return
+	}
+
+	pendingLinksMu.Lock()
+	pendingLinksN++
+	n := pendingLinksN
+	pendingLinks[n] = links
+	pendingLinksMu.Unlock()
+
+	text := "Found a torrent link, add it?"
+	if len(links) > 1 {
+		text = fmt.Sprintf("Found %d torrent links, add them?", len(links))
+	}
+
+	msg := tgbotapi.NewMessage(ud.Message.Chat.ID, text)
+	msg.ReplyToMessageID = ud.Message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Add", fmt.Sprintf("links:add:%d", n)),
+			tgbotapi.NewInlineKeyboardButtonData("Ignore", fmt.Sprintf("links:ignore:%d", n)),
+		),
+	)
+	if _, err := botSend(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// linksCallback handles the Add/Ignore buttons of offerLinks
+func linksCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	pendingLinksMu.Lock()
+	links, ok := pendingLinks[n]
+	delete(pendingLinks, n)
+	pendingLinksMu.Unlock()
+
+	if !ok {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Already answered"))
+		return
+	}
+
+	if args[0] != "add" {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Ignored"))
+		botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, "Ignored"))
+		return
+	}
+
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Adding"))
+	botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID,
+		fmt.Sprintf("Adding %s", strings.Join(linkNames(links), ", "))))
+
+	// addWithRetry answers in the chat of the update
+	ud := tgbotapi.Update{Message: cq.Message}
+	for _, link := range links {
+		go addWithRetry(ud, []string{link}, addOptions{})
+	}
+}
+
+// linkNames are short names for links, the dn of magnets or the file of URLs
+func linkNames(links []string) []string {
+	names := make([]string, 0, len(links))
+	for _, link := range links {
+		name := link
+		if u, err := url.Parse(link); err == nil {
+			if dn := u.Query().Get("dn"); dn != "" {
+				name = dn
+			} else if u.Scheme != "magnet" {
+				name = path.Base(u.Path)
+			}
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// diskCheck is how often the free space is checked when LowDisk is set
+const diskCheck = 10 * time.Minute
+
+// freespace shows the free space of the download dir, or of the given path
+func freespace(ud tgbotapi.Update, tokens []string) {
+	path := strings.Join(tokens, " ")
+	if path == "" {
+		session, err := sessionGet()
+		if err != nil {
+			sendErr("freespace", err, ud.Message.Chat.ID)
+			return
+		}
+		path = session.DownloadDir
+	}
+
+	free, err := freeSpace(path)
+	if err != nil {
+		sendErr("freespace", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("%s free on %s", chatLocale(ud.Message.Chat.ID).bytes(free), path), ud.Message.Chat.ID, false)
+}
+
+var diskOnce sync.Once
+
+// startDiskWatch starts watchDisk if LowDisk is set, only once
+func startDiskWatch() {
+	configMu.RLock()
+	enabled := LowDisk > 0
+	configMu.RUnlock()
+
+	if enabled {
+		diskOnce.Do(func() { go watchDisk() })
+	}
+}
+
+// watchDisk alerts when the free space on the download dir drops below LowDisk,
+// and again after it went back above it and dropped again.
+func watchDisk() {
+	var low bool
+
+	runLoop("disk", func() time.Duration { return diskCheck }, func() error {
+		configMu.RLock()
+		threshold := LowDisk
+		configMu.RUnlock()
+
+		// disabled by a reload
+		if threshold == 0 {
+			return nil
+		}
+
+		session, err := sessionGet()
+		if err != nil {
+			return err
+		}
+		free, err := freeSpace(session.DownloadDir)
+		if err != nil {
+			return err
+		}
+
+		if free >= threshold {
+			low = false
+			return nil
+		}
+		if !low {
+			low = true
+			notify(fmt.Sprintf("💾 Only %s free on %s", chatLocale(0).bytes(free), session.DownloadDir), false)
+			go runHook(eventLowDisk, map[string]string{
+				"TT_DIR":  session.DownloadDir,
+				"TT_FREE": fmt.Sprint(free),
+			})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// rttRegex finds the average of ping's summary, "rtt min/avg/max/mdev = 9.1/12.3/15.2/2.1 ms"
+var rttRegex = regexp.MustCompile(`= [\d.]+/([\d.]+)/`)
+
+var donorOnce sync.Once
+
+// donorLimit is transmission's upload limit from before donor capped it, and the cap, in KB/s
+type donorLimit struct {
+	Limit   int  `json:"limit"`
+	Enabled bool `json:"enabled"`
+	Cap     int  `json:"cap"`
+}
+
+// startDonor starts donor if an upload cap is set, only once
+func startDonor() {
+	configMu.RLock()
+	enabled := DonorUpload > 0
+	configMu.RUnlock()
+
+	if enabled {
+		donorOnce.Do(func() { go donor() })
+	}
+}
+
+// donor caps the upload at DonorUpload during DonorHours, unless the line is idle, which
+// is when DonorProbe answers pings faster than DonorLatency; then the upload can burst.
+// bursting puts back the limit that was there before the cap.
+func donor() {
+	// the mode that was last set: "" (untouched), "capped" or "burst". a cap from before a
+	// restart is still ours to lift.
+	var mode string
+	stateMu.Lock()
+	if state.DonorPrev != nil {
+		mode = "capped"
+	}
+	stateMu.Unlock()
+
+	runLoop("donor", turtleCheck, func() error {
+		configMu.RLock()
+		limit, hours, probe, latency := DonorUpload, DonorHours, DonorProbe, DonorLatency
+		configMu.RUnlock()
+
+		in, err := inHours(hours, time.Now())
+		if err != nil {
+			return err
+		}
+
+		// disabled by a reload, only undo our cap
+		if limit == 0 {
+			if mode != "capped" {
+				return nil
+			}
+			in = false
+		}
+
+		var want, reason string
+		switch {
+		case !in:
+			want, reason = "burst", "outside the donor hours"
+		case probe == "":
+			want, reason = "capped", "in the donor hours"
+		default:
+			rtt, err := pingLatency(probe)
+			if err != nil {
+				// can't tell if the line is idle, be nice to it
+				want, reason = "capped", err.Error()
+			} else if rtt > latency {
+				want, reason = "capped", fmt.Sprintf("%s latency to %s", rtt.Round(time.Millisecond), probe)
+			} else {
+				want, reason = "burst", fmt.Sprintf("the line is idle, %s latency to %s", rtt.Round(time.Millisecond), probe)
+			}
+		}
+
+		if want == mode {
+			return nil
+		}
+
+		// there's no cap of ours to lift
+		if want == "burst" && mode != "capped" {
+			mode = want
+			return nil
+		}
+
+		if want == "capped" {
+			if err := donorCap(limit); err != nil {
+				return err
+			}
+			logger.Printf("[INFO] Donor: capped the upload at %s/s, %s", humanize.Bytes(limit), reason)
+		} else {
+			if err := donorLift(); err != nil {
+				return err
+			}
+			logger.Printf("[INFO] Donor: lifted the upload cap, %s", reason)
+		}
+		mode = want
+		return nil
+	})
+}
+
+// donorCap remembers the upload limit and caps it at limit
+func donorCap(limit uint64) error {
+	session, err := sessionGet()
+	if err != nil {
+		return err
+	}
+
+	stateMu.Lock()
+	if state.DonorPrev == nil {
+		state.DonorPrev = &donorLimit{Limit: session.SpeedLimitUp, Enabled: session.SpeedLimitUpEnabled}
+	}
+	state.DonorPrev.Cap = int(limit / 1000) // KB/s
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+	stateMu.Unlock()
+
+	return sessionSet(map[string]interface{}{
+		"speed-limit-up-enabled": true,
+		"speed-limit-up":         limit / 1000, // KB/s
+	})
+}
+
+// donorLift puts back the upload limit from before donorCap, unless it got changed since
+// the cap, e.g. by 'speed' or a preset; then the change stays.
+func donorLift() error {
+	stateMu.Lock()
+	prev := state.DonorPrev
+	stateMu.Unlock()
+
+	if prev != nil {
+		session, err := sessionGet()
+		if err != nil {
+			return err
+		}
+
+		if session.SpeedLimitUpEnabled && session.SpeedLimitUp == prev.Cap {
+			if err := sessionSet(map[string]interface{}{
+				"speed-limit-up-enabled": prev.Enabled,
+				"speed-limit-up":         prev.Limit,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	stateMu.Lock()
+	state.DonorPrev = nil
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+	stateMu.Unlock()
+	return nil
+}
+
+// inHours returns true if t is within hours, e.g. "09:00-23:00" or "22:00-06:00", empty means all day
+func inHours(hours string, t time.Time) (bool, error) {
+	if hours == "" {
+		return true, nil
+	}
+
+	parts := strings.Split(hours, "-")
+	if len(parts) != 2 {
+		return false, fmt.Errorf("donor hours %q should look like 09:00-23:00", hours)
+	}
+	begin, err := parseClock(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return false, err
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	if begin <= end {
+		return now >= begin && now < end, nil
+	}
+	// wraps around midnight
+	return now >= begin || now < end, nil
+}
+
+// pingLatency returns the average round trip time of a few pings to host
+func pingLatency(host string) (time.Duration, error) {
+	out, err := exec.Command("ping", "-c", "3", "-W", "2", host).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ping %s: %s", host, err)
+	}
+
+	match := rttRegex.FindSubmatch(out)
+	if match == nil {
+		return 0, fmt.Errorf("ping %s: no round trip time in the output", host)
+	}
+
+	ms, err := strconv.ParseFloat(string(match[1]), 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// digestGroups is how many kinds of errors the digest shows
+	digestGroups = 20
+	// digestPage is how many torrents a page of a drill down shows
+	digestPage = 20
+	// digestTTL is how long the buttons of a digest work, the IDs in it get stale anyway
+	digestTTL = time.Hour
+)
+
+// errorGroup are the torrents with the same error on the same tracker
+type errorGroup struct {
+	err, tracker string
+	ids          []int
+	names        []string
+}
+
+var (
+	// pendingDigests are the groups of the digests whose buttons can still be used, by number
+	pendingDigests   = make(map[int][]errorGroup)
+	pendingDigestsN  int
+	pendingDigestsMu sync.Mutex
+)
+
+// groupErrors groups torrents by their error and the host of their first tracker, biggest first
+func groupErrors(torrents transmission.Torrents) []errorGroup {
+	index := make(map[string]int)
+	var groups []errorGroup
+	for _, t := range torrents {
+		var tracker string
+		if len(t.Trackers) > 0 {
+			if sm := trackerRegex.FindStringSubmatch(t.Trackers[0].Announce); len(sm) > 1 {
+				tracker = sm[1]
+			}
+		}
+
+		key := t.ErrorString + "\x00" + tracker
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, errorGroup{err: t.ErrorString, tracker: tracker})
+		}
+		groups[i].ids = append(groups[i].ids, t.ID)
+		groups[i].names = append(groups[i].names, t.Name)
+	}
+
+	gosort.SliceStable(groups, func(i, j int) bool { return len(groups[i].ids) > len(groups[j].ids) })
+	return groups
+}
+
+// sendErrorDigest sends one line per kind of error instead of one per torrent, with buttons to
+// list the torrents of each kind
+func sendErrorDigest(chat int64, groups []errorGroup) {
+	pendingDigestsMu.Lock()
+	pendingDigestsN++
+	n := pendingDigestsN
+	pendingDigests[n] = groups
+	pendingDigestsMu.Unlock()
+
+	time.AfterFunc(digestTTL, func() {
+		pendingDigestsMu.Lock()
+		delete(pendingDigests, n)
+		pendingDigestsMu.Unlock()
+	})
+
+	text, markup := digestMessage(n, groups)
+	msg := tgbotapi.NewMessage(chat, text)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = markup
+	if _, err := sendMarkdown(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// digestMessage is the digest n of groups, with a button for each kind of error
+func digestMessage(n int, groups []errorGroup) (string, *tgbotapi.InlineKeyboardMarkup) {
+	var total int
+	for _, g := range groups {
+		total += len(g.ids)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("*%d torrents with errors*\n\n", total))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i, g := range groups {
+		if i == digestGroups {
+			buf.WriteString(fmt.Sprintf("\n_…and %d more kinds, see errors all_\n", len(groups)-digestGroups))
+			break
+		}
+
+		buf.WriteString(fmt.Sprintf("%d. '%s' ×%d", i+1, mdReplacer.Replace(g.err), len(g.ids)))
+		if g.tracker != "" {
+			buf.WriteString(" on " + mdReplacer.Replace(g.tracker))
+		}
+		buf.WriteString("\n")
+
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(i+1), fmt.Sprintf("errdigest:%d:%d:0", n, i)))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return buf.String(), &markup
+}
+
+// digestPageMessage is a page of the torrents of group g of digest n
+func digestPageMessage(chat int64, n, g, page int, group errorGroup) (string, *tgbotapi.InlineKeyboardMarkup) {
+	pages := (len(group.ids) + digestPage - 1) / digestPage
+	if page >= pages {
+		page = pages - 1
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("*'%s'*", mdReplacer.Replace(group.err)))
+	if group.tracker != "" {
+		buf.WriteString(" on " + mdReplacer.Replace(group.tracker))
+	}
+	buf.WriteString(fmt.Sprintf(", page %d/%d\n\n", page+1, pages))
+
+	end := (page + 1) * digestPage
+	if end > len(group.ids) {
+		end = len(group.ids)
+	}
+	for i := page * digestPage; i < end; i++ {
+		buf.WriteString(torrentLine(chat, group.ids[i], group.names[i]))
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("‹ Prev", fmt.Sprintf("errdigest:%d:%d:%d", n, g, page-1)))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData("Back", fmt.Sprintf("errdigest:%d:-1:0", n)))
+	if page+1 < pages {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Next ›", fmt.Sprintf("errdigest:%d:%d:%d", n, g, page+1)))
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(row)
+	return buf.String(), &markup
+}
+
+// errorDigestCallback handles the buttons of the digest and its pages, "errdigest:n:group:page",
+// group -1 goes back to the digest
+func errorDigestCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 3 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	var nums [3]int
+	for i := range args {
+		num, err := strconv.Atoi(args[i])
+		if err != nil {
+			Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+			return
+		}
+		nums[i] = num
+	}
+	n, g, page := nums[0], nums[1], nums[2]
+
+	pendingDigestsMu.Lock()
+	groups, ok := pendingDigests[n]
+	pendingDigestsMu.Unlock()
+
+	if !ok || g >= len(groups) || page < 0 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "This digest has expired, send errors again"))
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, ""))
+
+	var text string
+	var markup *tgbotapi.InlineKeyboardMarkup
+	if g < 0 {
+		text, markup = digestMessage(n, groups)
+	} else {
+		text, markup = digestPageMessage(cq.Message.Chat.ID, n, g, page, groups[g])
+	}
+
+	edit := tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, text)
+	edit.ParseMode = tgbotapi.ModeMarkdown
+	edit.ReplyMarkup = markup
+	editMarkdown(edit)
+}
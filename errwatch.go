@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// errorAlertMax is how many new errors in one poll get a message each, more than that
+// get a single message, e.g. when a tracker goes down
+const errorAlertMax = 5
+
+func init() {
+	onError(watchErrors)
+}
+
+// watchErrors notifies about the torrents that got an error since the last poll, with
+// buttons to verify or remove them. the errors that are there on startup don't count.
+func watchErrors(errored transmission.Torrents) {
+	configMu.RLock()
+	enabled := ErrorAlerts
+	configMu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	if len(errored) > errorAlertMax {
+		notifyHinted(fmt.Sprintf("⚠️ %d torrents got an error, e.g. %s: %s\nSee errors",
+			len(errored), errored[0].Name, errored[0].ErrorString), "errors")
+		return
+	}
+
+	for _, t := range errored {
+		extra, err := getTorrentExtra(t.ID, "hashString")
+		if err != nil {
+			continue // removed already
+		}
+		hash := strings.ToLower(extra.HashString)
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Verify", "errored:verify:"+hash),
+				tgbotapi.NewInlineKeyboardButtonData("Remove", "errored:remove:"+hash),
+			),
+		)
+		notifyWithMarkup(fmt.Sprintf("⚠️ <%d> %s\n%s", t.ID, t.Name, t.ErrorString), keyboard)
+	}
+}
+
+// erroredCallback handles the Verify/Remove buttons of watchErrors, removing keeps the data
+func erroredCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	// the button may be from before a restart, the hash makes sure it's still the same torrent
+	torrent, err := getTorrentByHash(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+
+	method, answer := "torrent-verify", "Verifying"
+	if args[0] == "remove" {
+		method, answer = "torrent-remove", "Removed"
+	}
+
+	if err := rpcCall(method, map[string]interface{}{"ids": []int{torrent.ID}}, nil); err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, answer))
+	botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID,
+		fmt.Sprintf("%s\n\n%s", cq.Message.Text, answer)))
+}
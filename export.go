@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// export sends the .torrent files of torrents, "export 42 43" sends them one by one
+// and "export all" sends all of them in a zip.
+func export(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*export:* needs torrent IDs or _all_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	if strings.ToLower(tokens[0]) == "all" {
+		exportAll(ud)
+		return
+	}
+
+	ids, err := parseIDs(tokens)
+	if err != nil {
+		sendErr("export", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrentFields(ids, "id", "name", "hashString", "torrentFile")
+	if err != nil {
+		sendErr("export", err, ud.Message.Chat.ID)
+		return
+	}
+	if len(torrents) == 0 {
+		send("*export:* no torrents with those IDs", ud.Message.Chat.ID, false)
+		return
+	}
+
+	for i := range torrents {
+		data, err := torrentFile(&torrents[i])
+		if err != nil {
+			send(fmt.Sprintf("*export:* %s: %s", torrents[i].Name, err), ud.Message.Chat.ID, false)
+			continue
+		}
+
+		doc := tgbotapi.NewDocumentUpload(ud.Message.Chat.ID, tgbotapi.FileBytes{
+			Name:  safeFileName(torrents[i].Name) + ".torrent",
+			Bytes: data,
+		})
+		if _, err := botSend(doc); err != nil {
+			logger.Printf("[ERROR] Send: %s", err)
+		}
+	}
+}
+
+// exportAll sends the .torrent files of all the torrents in a zip
+func exportAll(ud tgbotapi.Update) {
+	torrents, err := getTorrentFields(nil, "id", "name", "hashString", "torrentFile")
+	if err != nil {
+		sendErr("export", err, ud.Message.Chat.ID)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	var added, failed int
+	for i := range torrents {
+		data, err := torrentFile(&torrents[i])
+		if err != nil {
+			logger.Printf("[ERROR] Export: %s: %s", torrents[i].Name, err)
+			failed++
+			continue
+		}
+
+		// the hash keeps the names unique
+		name := fmt.Sprintf("%s.%s.torrent", safeFileName(torrents[i].Name), torrents[i].HashString[:8])
+		w, err := archive.Create(name)
+		if err != nil {
+			sendErr("export", err, ud.Message.Chat.ID)
+			return
+		}
+		w.Write(data)
+		added++
+	}
+	if err := archive.Close(); err != nil {
+		sendErr("export", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if added == 0 {
+		send("*export:* couldn't read any .torrent file, is -transmission-dir right?", ud.Message.Chat.ID, false)
+		return
+	}
+
+	doc := tgbotapi.NewDocumentUpload(ud.Message.Chat.ID, tgbotapi.FileBytes{
+		Name:  "torrents.zip",
+		Bytes: buf.Bytes(),
+	})
+	if _, err := botSend(doc); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+
+	if failed > 0 {
+		send(fmt.Sprintf("*export:* %d torrents are missing their .torrent file", failed), ud.Message.Chat.ID, false)
+	}
+}
+
+// torrentFile reads the .torrent file of torrent, where transmission says it is if it's
+// on this machine, otherwise from the torrents folder of TransDir.
+func torrentFile(torrent *rpcTorrent) ([]byte, error) {
+	if torrent.File != "" {
+		if data, err := ioutil.ReadFile(torrent.File); err == nil {
+			return data, nil
+		}
+	}
+
+	configMu.RLock()
+	dir := TransDir
+	configMu.RUnlock()
+	if dir == "" {
+		return nil, fmt.Errorf("can't read %s, set -transmission-dir if transmission runs elsewhere", torrent.File)
+	}
+
+	hash := strings.ToLower(torrent.HashString)
+	// "<hash>.torrent" since 4.0, "<name>.<hash[:16]>.torrent" before it
+	candidates := []string{filepath.Join(dir, "torrents", hash+".torrent")}
+	if matches, err := filepath.Glob(filepath.Join(dir, "torrents", "*."+hash[:16]+".torrent")); err == nil {
+		candidates = append(candidates, matches...)
+	}
+
+	for _, path := range candidates {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no .torrent file in %s", filepath.Join(dir, "torrents"))
+}
+
+// safeFileName replaces the characters that aren't allowed in file names
+func safeFileName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_",
+		"\"", "_", "<", "_", ">", "_", "|", "_").Replace(name)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// endpointCheck is how often the active RPC URL is checked, and the primary one retried
+const endpointCheck = 30 * time.Second
+
+// urlSlice lets the flag package collect a repeated flag, e.g. -fallback-url
+type urlSlice []string
+
+// String is mandatory functions for the flag package
+func (urls *urlSlice) String() string {
+	return strings.Join(*urls, ",")
+}
+
+// Set is mandatory functions for the flag package
+func (urls *urlSlice) Set(url string) error {
+	*urls = append(*urls, url)
+	return nil
+}
+
+var (
+	// endpoint is the RPC URL in use, RPCURL or one of FallbackURLs
+	endpoint   string
+	endpointMu sync.Mutex
+)
+
+// rpcURLs returns the primary RPC URL followed by the fallbacks
+func rpcURLs() []string {
+	return append([]string{RPCURL}, FallbackURLs...)
+}
+
+// activeEndpoint returns the RPC URL in use
+func activeEndpoint() string {
+	endpointMu.Lock()
+	defer endpointMu.Unlock()
+	return endpoint
+}
+
+// rpcClient returns the client of the RPC URL in use
+func rpcClient() *transmission.TransmissionClient {
+	endpointMu.Lock()
+	defer endpointMu.Unlock()
+	return transmissionClient
+}
+
+// probe returns a client for url if transmission answers on it
+func probe(url string) (*transmission.TransmissionClient, error) {
+	client, err := transmission.New(url, Username, Password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.GetStats(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// connect makes rpcClient use the first of the RPC URLs that answers, earlier URLs are preferred
+func connect() error {
+	var errs []string
+	for _, url := range rpcURLs() {
+		client, err := probe(url)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", url, err))
+			continue
+		}
+
+		endpointMu.Lock()
+		if endpoint != url {
+			if endpoint != "" {
+				logger.Printf("[INFO] Transmission: switching from %s to %s", endpoint, url)
+			}
+			endpoint = url
+			client.SetSort(currentSort())
+			transmissionClient = client
+		}
+		endpointMu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("no RPC URL answers, %s", strings.Join(errs, "; "))
+}
+
+// watchEndpoint keeps rpcClient on a working RPC URL, it switches to a fallback when
+// the active one stops answering and back to the primary once it answers again.
+func watchEndpoint() {
+	if len(FallbackURLs) == 0 {
+		return
+	}
+
+	runLoop("endpoint", func() time.Duration { return endpointCheck }, func() error {
+		// on the primary and it's fine, nothing to do
+		if activeEndpoint() == RPCURL {
+			if _, err := rpcClient().GetStats(); err == nil {
+				return nil
+			}
+		}
+		return connect()
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	gosort "sort"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// listingField formats one field of a torrent for the listings
+type listingField func(loc locale, t *transmission.Torrent) string
+
+// fieldCatalog are the fields the listings can show, see ListingFields
+var fieldCatalog = map[string]listingField{
+	"status":     func(loc locale, t *transmission.Torrent) string { return t.TorrentStatus() },
+	"percent":    func(loc locale, t *transmission.Torrent) string { return loc.float(t.PercentDone*100, 1) + "%" },
+	"have":       func(loc locale, t *transmission.Torrent) string { return loc.bytes(t.Have()) },
+	"size":       func(loc locale, t *transmission.Torrent) string { return loc.bytes(t.SizeWhenDone) },
+	"down":       func(loc locale, t *transmission.Torrent) string { return "↓ " + loc.bytes(t.RateDownload) },
+	"up":         func(loc locale, t *transmission.Torrent) string { return "↑ " + loc.bytes(t.RateUpload) },
+	"ratio":      func(loc locale, t *transmission.Torrent) string { return "R: " + loc.number(t.Ratio()) },
+	"eta":        func(loc locale, t *transmission.Torrent) string { return "ETA: " + t.ETA() },
+	"downloaded": func(loc locale, t *transmission.Torrent) string { return "DL: " + loc.bytes(t.DownloadedEver) },
+	"uploaded":   func(loc locale, t *transmission.Torrent) string { return "UL: " + loc.bytes(t.UploadedEver) },
+	"added":      func(loc locale, t *transmission.Torrent) string { return loc.time(time.Unix(t.AddedDate, 0)) },
+	"error":      func(loc locale, t *transmission.Torrent) string { return mdReplacer.Replace(t.ErrorString) },
+}
+
+// fieldCommands are the listings whose fields can be configured
+var fieldCommands = []string{"list", "downs", "seeding", "paused", "checking", "errors", "latest"}
+
+// ListingFields are the fields each listing shows under the torrents' names instead of its
+// own, by command, loaded from the config file
+var ListingFields map[string][]string
+
+// checkListingFields returns an error for the commands and fields that don't exist
+func checkListingFields(fields map[string][]string) error {
+	for command, names := range fields {
+		known := false
+		for _, c := range fieldCommands {
+			known = known || c == command
+		}
+		if !known {
+			return fmt.Errorf("%s is not one of %s", command, strings.Join(fieldCommands, ", "))
+		}
+
+		for _, name := range names {
+			if _, ok := fieldCatalog[name]; !ok {
+				return fmt.Errorf("%s: %s is not one of %s", command, name, strings.Join(fieldNames(), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// fieldNames are the names in fieldCatalog, sorted
+func fieldNames() []string {
+	names := make([]string, 0, len(fieldCatalog))
+	for name := range fieldCatalog {
+		names = append(names, name)
+	}
+	gosort.Strings(names)
+	return names
+}
+
+// customLine is the torrentLine of t followed by the fields configured for command, it's
+// empty if command has none.
+func customLine(chat int64, command string, t *transmission.Torrent) string {
+	configMu.RLock()
+	names := ListingFields[command]
+	configMu.RUnlock()
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	loc := chatLocale(chat)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = fieldCatalog[name](loc, t)
+	}
+	return torrentLine(chat, t.ID, t.Name) + strings.Join(values, "  ") + "\n\n"
+}
+
+// listingLine is customLine, or just the torrentLine when command has no fields configured
+func listingLine(chat int64, command string, t *transmission.Torrent) string {
+	if line := customLine(chat, command, t); line != "" {
+		return line
+	}
+	return torrentLine(chat, t.ID, t.Name)
+}
+
+// listingFields are the fields getTorrents needs for the listing of command, the names are
+// enough unless it has fields configured
+func listingFields(command string, extra ...string) []string {
+	configMu.RLock()
+	custom := len(ListingFields[command]) > 0
+	configMu.RUnlock()
+
+	fields := nameFields
+	if custom {
+		fields = statsFields
+	}
+
+	have := make(map[string]bool)
+	var all []string
+	for _, f := range append(append([]string{}, fields...), extra...) {
+		if !have[f] {
+			have[f] = true
+			all = append(all, f)
+		}
+	}
+	return all
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// filesButtons is the most files that get a toggle button, more won't fit on a phone
+const filesButtons = 20
+
+// files lists the files of a torrent, "files <id> want 3 5-9" and "files <id> unwant 1"
+// change which of them get downloaded.
+func files(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*files:* needs a torrent ID", ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*files:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) > 1 {
+		var field string
+		switch strings.ToLower(tokens[1]) {
+		case "want":
+			field = "files-wanted"
+		case "unwant", "skip":
+			field = "files-unwanted"
+		default:
+			send("*files:* unknown subcommand "+tokens[1], ud.Message.Chat.ID, false)
+			return
+		}
+
+		torrent, err := getTorrentExtra(id, "files")
+		if err != nil {
+			sendErr("files", err, ud.Message.Chat.ID)
+			return
+		}
+
+		indexes, err := parseFileNumbers(tokens[2:], len(torrent.Files))
+		if err != nil {
+			sendErr("files", err, ud.Message.Chat.ID)
+			return
+		}
+
+		if err := torrentSet([]int{id}, map[string]interface{}{field: indexes}); err != nil {
+			sendErr("files", err, ud.Message.Chat.ID)
+			return
+		}
+	}
+
+	text, markup, err := filesMessage(ud.Message.Chat.ID, id)
+	if err != nil {
+		sendErr("files", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if markup == nil {
+		send(text, ud.Message.Chat.ID, false)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(ud.Message.Chat.ID, text)
+	msg.ReplyMarkup = markup
+	if _, err := botSend(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// parseFileNumbers turns the file numbers as shown by files, e.g. "3 5-9", into transmission's file
+// indexes. count is how many files the torrent has, the ranges stop there.
+func parseFileNumbers(tokens []string, count int) ([]int, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("needs file numbers, e.g. 3 5-9")
+	}
+
+	var indexes []int
+	for _, token := range tokens {
+		from, to := token, token
+		if i := strings.Index(token, "-"); i > 0 {
+			from, to = token[:i], token[i+1:]
+		}
+
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", from)
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", to)
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("%s is not a valid range", token)
+		}
+		if start > count {
+			return nil, fmt.Errorf("there's no file %d, the torrent has %d", start, count)
+		}
+		if end > count {
+			end = count
+		}
+
+		for n := start; n <= end; n++ {
+			indexes = append(indexes, n-1)
+		}
+	}
+	return indexes, nil
+}
+
+// filesMessage formats the files of the torrent with id for chat, with a toggle button for
+// each file when there are no more than filesButtons of them.
+func filesMessage(chat int64, id int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	loc := chatLocale(chat)
+
+	torrent, err := getTorrentExtra(id, "name", "files", "fileStats")
+	if err != nil {
+		return "", nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("<%d> %s\n\n", torrent.ID, torrent.Name))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, file := range torrent.Files {
+		wanted := true
+		if i < len(torrent.FileStats) {
+			wanted = torrent.FileStats[i].Wanted
+		}
+
+		mark := "✓"
+		if !wanted {
+			mark = "✗"
+		}
+
+		var percent float64
+		if file.Length > 0 {
+			percent = float64(file.BytesCompleted) / float64(file.Length) * 100
+		}
+
+		buf.WriteString(fmt.Sprintf("%d. %s %s\n    %s (%s%%)\n", i+1, mark, file.Name,
+			loc.bytes(file.Length), loc.float(percent, 1)))
+
+		if len(torrent.Files) <= filesButtons {
+			name := file.Name
+			if i := strings.LastIndex(name, "/"); i >= 0 {
+				name = name[i+1:]
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s %d. %s", mark, i+1, name),
+					fmt.Sprintf("files:%d:%d", torrent.ID, i)),
+			))
+		}
+	}
+
+	if len(rows) == 0 {
+		return buf.String(), nil, nil
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return buf.String(), &markup, nil
+}
+
+// filesCallback handles the toggle buttons of files, it flips the file between wanted and unwanted
+func filesCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	torrent, err := getTorrentExtra(id, "fileStats")
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+	if index < 0 || index >= len(torrent.FileStats) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "No such file"))
+		return
+	}
+
+	field, answer := "files-unwanted", "Skipping"
+	if !torrent.FileStats[index].Wanted {
+		field, answer = "files-wanted", "Downloading"
+	}
+	if err := torrentSet([]int{id}, map[string]interface{}{field: []int{index}}); err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, answer))
+
+	text, markup, err := filesMessage(cq.Message.Chat.ID, id)
+	if err != nil || markup == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, text)
+	edit.ReplyMarkup = markup
+	botSend(edit)
+}
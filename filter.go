@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pyed/transmission"
+)
+
+// a torrentFilter returns true for the torrents a command is interested in
+type torrentFilter func(t *transmission.Torrent) bool
+
+// Downloading or in queue to download
+func isDownloading(t *transmission.Torrent) bool {
+	return t.Status == transmission.StatusDownloading ||
+		t.Status == transmission.StatusDownloadPending
+}
+
+// Seeding or in queue to seed
+func isSeeding(t *transmission.Torrent) bool {
+	return t.Status == transmission.StatusSeeding ||
+		t.Status == transmission.StatusSeedPending
+}
+
+func isPaused(t *transmission.Torrent) bool {
+	return t.Status == transmission.StatusStopped
+}
+
+// Verifying or in queue to verify
+func isChecking(t *transmission.Torrent) bool {
+	return t.Status == transmission.StatusChecking ||
+		t.Status == transmission.StatusCheckPending
+}
+
+// actively downloading or uploading
+func isActive(t *transmission.Torrent) bool {
+	return t.RateDownload > 0 || t.RateUpload > 0
+}
+
+func hasError(t *transmission.Torrent) bool {
+	return t.Error != 0
+}
+
+// filterTorrents returns the torrents that match filter
+func filterTorrents(torrents transmission.Torrents, filter torrentFilter) transmission.Torrents {
+	var matched transmission.Torrents
+	for i := range torrents {
+		if filter(torrents[i]) {
+			matched = append(matched, torrents[i])
+		}
+	}
+	return matched
+}
+
+// labelFilter narrows filter down to the torrents that have all the labels given
+// as "label:tv" tokens, it returns the rest of the tokens.
+func labelFilter(filter torrentFilter, tokens []string) (torrentFilter, []string, error) {
+	var wanted, rest []string
+	for _, token := range tokens {
+		if strings.HasPrefix(strings.ToLower(token), "label:") {
+			wanted = append(wanted, strings.ToLower(token[len("label:"):]))
+			continue
+		}
+		rest = append(rest, token)
+	}
+
+	if len(wanted) == 0 {
+		return filter, tokens, nil
+	}
+
+	// the transmission package doesn't know about labels
+	torrents, err := getTorrentFields(nil, "id", "labels")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	labeled := make(map[int]bool)
+	for _, torrent := range torrents {
+		has := make(map[string]bool)
+		for _, l := range torrent.Labels {
+			has[strings.ToLower(l)] = true
+		}
+
+		all := true
+		for _, l := range wanted {
+			all = all && has[l]
+		}
+		labeled[torrent.ID] = all
+	}
+
+	return func(t *transmission.Torrent) bool {
+		return labeled[t.ID] && filter(t)
+	}, rest, nil
+}
+
+// anyTorrent matches every torrent
+func anyTorrent(t *transmission.Torrent) bool {
+	return true
+}
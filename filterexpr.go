@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pyed/transmission"
+)
+
+// filterExprRegex matches the expressions of the filters, e.g. "ratio>2" or "tracker~private",
+// ":" is the same as "=" so "label:tv" keeps working
+var filterExprRegex = regexp.MustCompile(`^([a-zA-Z]+)(>=|<=|!=|=|:|>|<|~)(.+)$`)
+
+// statusFilters are the values of "status=", the filters of downs, seeding and the rest
+var statusFilters = map[string]torrentFilter{
+	"downloading": isDownloading,
+	"seeding":     isSeeding,
+	"paused":      isPaused,
+	"stopped":     isPaused,
+	"checking":    isChecking,
+	"verifying":   isChecking,
+	"active":      isActive,
+	"error":       hasError,
+	"complete":    func(t *transmission.Torrent) bool { return t.PercentDone >= 1 },
+}
+
+// numberKeys are the keys compared as numbers, the value of the torrent and how to parse
+// what's given, e.g. "size>10GB" or "added<30d" for the ones added in the last 30 days
+var numberKeys = map[string]struct {
+	value func(t *transmission.Torrent) float64
+	parse func(s string) (float64, error)
+}{
+	"ratio":    {torrentRatio, parseFloat},
+	"size":     {func(t *transmission.Torrent) float64 { return float64(t.SizeWhenDone) }, parseBytes},
+	"progress": {func(t *transmission.Torrent) float64 { return t.PercentDone * 100 }, parsePercent},
+	"down":     {func(t *transmission.Torrent) float64 { return float64(t.RateDownload) }, parseBytes},
+	"up":       {func(t *transmission.Torrent) float64 { return float64(t.RateUpload) }, parseBytes},
+	"added": {
+		func(t *transmission.Torrent) float64 { return time.Since(time.Unix(t.AddedDate, 0)).Seconds() },
+		func(s string) (float64, error) {
+			age, err := parseAge(s)
+			return age.Seconds(), err
+		},
+	},
+}
+
+// filterExpr is one expression of a filter
+type filterExpr struct {
+	key, op, value string
+}
+
+// splitFilter separates the expressions in tokens from the rest, the rest are left to the
+// commands, e.g. the tracker query of list
+func splitFilter(tokens []string) (exprs []filterExpr, rest []string) {
+	for _, token := range joinQuoted(tokens) {
+		// "~S02E0[1-3]" is a query on the names
+		if strings.HasPrefix(token, "~") && len(token) > 1 {
+			exprs = append(exprs, filterExpr{"name", "~", unquote(token[1:])})
+			continue
+		}
+
+		sm := filterExprRegex.FindStringSubmatch(token)
+		if sm == nil || !isFilterKey(strings.ToLower(sm[1])) {
+			rest = append(rest, token)
+			continue
+		}
+		op := sm[2]
+		if op == ":" {
+			op = "="
+		}
+		exprs = append(exprs, filterExpr{strings.ToLower(sm[1]), op, unquote(sm[3])})
+	}
+	return exprs, rest
+}
+
+// joinQuoted joins the tokens of the quoted values back, e.g. name:"the wire" or ~"S02 E0[1-3]"
+func joinQuoted(tokens []string) []string {
+	var joined []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if strings.Count(token, `"`) == 1 {
+			for i+1 < len(tokens) {
+				i++
+				token += " " + tokens[i]
+				if strings.Contains(tokens[i], `"`) {
+					break
+				}
+			}
+		}
+		joined = append(joined, token)
+	}
+	return joined
+}
+
+// unquote drops the quotes around value
+func unquote(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// isFilterKey returns true if key is one of the keys of the expressions
+func isFilterKey(key string) bool {
+	if _, ok := numberKeys[key]; ok {
+		return true
+	}
+	switch key {
+	case "status", "name", "tracker", "error", "label":
+		return true
+	}
+	return false
+}
+
+// filterFields returns the fields getTorrents needs for the expressions in tokens, none if
+// there aren't any
+func filterFields(tokens []string) []string {
+	if exprs, _ := splitFilter(tokens); len(exprs) > 0 {
+		return statsFields
+	}
+	return nil
+}
+
+// filteredIDs returns the IDs of the torrents that match the expressions in tokens, for the
+// commands that take IDs, e.g. "stop status=seeding ratio>2". it returns false if there are
+// no expressions.
+func filteredIDs(tokens []string) ([]int, bool, error) {
+	filter, rest, err := queryFilter(anyTorrent, tokens)
+	if err != nil {
+		return nil, true, err
+	}
+	if len(rest) == len(tokens) {
+		return nil, false, nil
+	}
+	if len(rest) > 0 {
+		return nil, true, fmt.Errorf("%s is not an expression, e.g. ratio>2", rest[0])
+	}
+
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		return nil, true, err
+	}
+
+	var ids []int
+	for _, t := range filterTorrents(torrents, filter) {
+		ids = append(ids, t.ID)
+	}
+	if len(ids) == 0 {
+		return nil, true, fmt.Errorf("no torrent matches %s", strings.Join(tokens, " "))
+	}
+	return ids, true, nil
+}
+
+// queryFilter narrows filter down to the torrents that match all the expressions in tokens,
+// e.g. "status=seeding ratio>2 size>10GB tracker~private added<30d label:tv". it returns
+// the rest of the tokens.
+func queryFilter(filter torrentFilter, tokens []string) (torrentFilter, []string, error) {
+	exprs, rest := splitFilter(tokens)
+	if len(exprs) == 0 {
+		return filter, tokens, nil
+	}
+
+	filters := []torrentFilter{filter}
+	var labels []string
+	for _, expr := range exprs {
+		if expr.key == "label" {
+			if expr.op != "=" {
+				return nil, nil, fmt.Errorf("label only takes =, e.g. label:tv")
+			}
+			labels = append(labels, "label:"+expr.value)
+			continue
+		}
+
+		f, err := expr.filter()
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	if len(labels) > 0 {
+		f, _, err := labelFilter(anyTorrent, labels)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	return func(t *transmission.Torrent) bool {
+		for _, f := range filters {
+			if !f(t) {
+				return false
+			}
+		}
+		return true
+	}, rest, nil
+}
+
+// filter returns the torrentFilter of expr
+func (expr filterExpr) filter() (torrentFilter, error) {
+	if number, ok := numberKeys[expr.key]; ok {
+		if expr.op == "~" {
+			return nil, fmt.Errorf("%s takes =, !=, >, <, >= or <=", expr.key)
+		}
+		want, err := number.parse(expr.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s%s: %s", expr.key, expr.op, expr.value, err)
+		}
+		return func(t *transmission.Torrent) bool { return compare(number.value(t), expr.op, want) }, nil
+	}
+
+	if expr.op != "=" && expr.op != "!=" && expr.op != "~" {
+		return nil, fmt.Errorf("%s takes =, != or ~", expr.key)
+	}
+
+	var match func(t *transmission.Torrent) bool
+	switch expr.key {
+	case "status":
+		f, ok := statusFilters[strings.ToLower(expr.value)]
+		if !ok || expr.op == "~" {
+			return nil, fmt.Errorf("status takes = or != and one of downloading, seeding, paused, checking, active, error or complete")
+		}
+		match = f
+
+	case "tracker":
+		if expr.op == "~" {
+			regx, err := compileQuery(expr.value)
+			if err != nil {
+				return nil, err
+			}
+			match = func(t *transmission.Torrent) bool { return regx.MatchString(t.GetTrackers()) }
+			break
+		}
+		host := expr.value
+		match = func(t *transmission.Torrent) bool {
+			for _, tracker := range t.Trackers {
+				if u, err := url.Parse(tracker.Announce); err == nil && hostMatches(u.Hostname(), host) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case "name", "error":
+		text := func(t *transmission.Torrent) string { return t.Name }
+		if expr.key == "error" {
+			text = func(t *transmission.Torrent) string { return t.ErrorString }
+		}
+		if expr.op == "~" {
+			regx, err := compileQuery(expr.value)
+			if err != nil {
+				return nil, err
+			}
+			match = func(t *transmission.Torrent) bool { return regx.MatchString(text(t)) }
+			break
+		}
+		value := strings.ToLower(expr.value)
+		// "name:ubuntu*" is a glob on the whole name
+		if strings.ContainsAny(value, "*?[") {
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("%s is not a valid pattern", expr.value)
+			}
+			match = func(t *transmission.Torrent) bool {
+				ok, _ := path.Match(value, strings.ToLower(text(t)))
+				return ok
+			}
+			break
+		}
+		match = func(t *transmission.Torrent) bool { return strings.Contains(strings.ToLower(text(t)), value) }
+	}
+
+	if expr.op == "!=" {
+		return func(t *transmission.Torrent) bool { return !match(t) }, nil
+	}
+	return match, nil
+}
+
+// compare compares a and b with op, an unknown value (NaN) is never a match, "!=" included
+func compare(a float64, op string, b float64) bool {
+	if math.IsNaN(a) {
+		return false
+	}
+	switch op {
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case "!=":
+		return a != b
+	}
+	return a == b
+}
+
+// torrentRatio is the ratio of t as a number, NaN for the ones that can't be told (-1 when
+// nothing was downloaded yet), so that they match no comparison
+func torrentRatio(t *transmission.Torrent) float64 {
+	ratio, err := strconv.ParseFloat(t.Ratio(), 64)
+	if err != nil || ratio < 0 {
+		return math.NaN()
+	}
+	return ratio
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func parsePercent(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+}
+
+func parseBytes(s string) (float64, error) {
+	n, err := humanize.ParseBytes(s)
+	return float64(n), err
+}
+
+// parseAge parses how long ago, with days and weeks on top of time.ParseDuration, e.g. 30d
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64); err == nil && strings.HasSuffix(s, suffix) {
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not an age, e.g. 30d, 2w or 12h", s)
+	}
+	return d, nil
+}
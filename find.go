@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	gosort "sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// findButtons is how many of the results get an add button
+const findButtons = 10
+
+// torznabIndexer is a Torznab endpoint to search, e.g. one of Jackett's or Prowlarr's indexers
+type torznabIndexer struct {
+	Name   string `yaml:"name"`
+	URL    string `yaml:"url"` // e.g. http://localhost:9117/api/v2.0/indexers/all/results/torznab
+	APIKey string `yaml:"apikey"`
+}
+
+// Indexers are loaded from the config file
+var Indexers []torznabIndexer
+
+var torznabClient = &http.Client{Timeout: 30 * time.Second}
+
+// torznabFeed is the answer to a Torznab search
+type torznabFeed struct {
+	Items []struct {
+		Title     string `xml:"title"`
+		Link      string `xml:"link"`
+		Size      uint64 `xml:"size"`
+		Enclosure struct {
+			URL string `xml:"url,attr"`
+		} `xml:"enclosure"`
+		Attrs []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"attr"`
+	} `xml:"channel>item"`
+}
+
+// torznabResult is a result of an indexer, before it's cached
+type torznabResult struct {
+	searchResult
+	seeders int
+}
+
+// find searches the Torznab indexers, "find more" and "find filter <query>" page and narrow
+// the results down, "find add 3" adds the 3rd of them.
+func find(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*find:* needs a query", ud.Message.Chat.ID, false)
+		return
+	}
+
+	switch strings.ToLower(tokens[0]) {
+	case "more":
+		page, err := moreResults(ud.Message.Chat.ID)
+		if err != nil {
+			sendErr("find", err, ud.Message.Chat.ID)
+			return
+		}
+		send(page, ud.Message.Chat.ID, true)
+		return
+
+	case "filter":
+		regx, err := compileQuery(strings.Join(tokens[1:], " "))
+		if err != nil {
+			sendErr("find", err, ud.Message.Chat.ID)
+			return
+		}
+		page, err := filterResults(ud.Message.Chat.ID, regx)
+		if err != nil {
+			sendErr("find", err, ud.Message.Chat.ID)
+			return
+		}
+		send(page, ud.Message.Chat.ID, true)
+		return
+
+	case "add":
+		if len(tokens) < 2 {
+			send("*find:* needs the number of a result, e.g. find add 3", ud.Message.Chat.ID, false)
+			return
+		}
+		add(ud, append([]string{"result"}, tokens[1:]...))
+		return
+	}
+
+	configMu.RLock()
+	indexers := Indexers
+	configMu.RUnlock()
+
+	if len(indexers) == 0 {
+		send("*find:* no indexers, add them under torznab in the config", ud.Message.Chat.ID, false)
+		return
+	}
+
+	query := strings.Join(tokens, " ")
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		found    []torznabResult
+		failures []string
+	)
+	for _, indexer := range indexers {
+		wg.Add(1)
+		go func(indexer torznabIndexer) {
+			defer wg.Done()
+
+			results, err := indexer.search(query, chatLocale(ud.Message.Chat.ID))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", indexer.Name, err))
+				return
+			}
+			found = append(found, results...)
+		}(indexer)
+	}
+	wg.Wait()
+
+	for _, failure := range failures {
+		send("*find:* "+failure, ud.Message.Chat.ID, false)
+	}
+	if len(found) == 0 {
+		send("*find:* no results", ud.Message.Chat.ID, false)
+		return
+	}
+
+	// the best seeded first
+	gosort.SliceStable(found, func(i, j int) bool {
+		return found[i].seeders > found[j].seeders
+	})
+
+	results := make([]searchResult, len(found))
+	for i := range found {
+		results[i] = found[i].searchResult
+	}
+
+	msg := tgbotapi.NewMessage(ud.Message.Chat.ID, cacheResults(ud.Message.Chat.ID, "find", results))
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.DisableWebPagePreview = true
+
+	// a button for each of the first results, five to a row
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := 0; i < len(results) && i < findButtons; i++ {
+		if i%5 == 0 {
+			rows = append(rows, []tgbotapi.InlineKeyboardButton{})
+		}
+		n := strconv.Itoa(i + 1)
+		rows[len(rows)-1] = append(rows[len(rows)-1], tgbotapi.NewInlineKeyboardButtonData("Add "+n, "find:"+n))
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if _, err := sendMarkdown(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// search queries the indexer
+func (indexer torznabIndexer) search(query string, loc locale) ([]torznabResult, error) {
+	u, err := url.Parse(indexer.URL)
+	if err != nil {
+		return nil, err
+	}
+	params := u.Query()
+	params.Set("t", "search")
+	params.Set("q", query)
+	if indexer.APIKey != "" {
+		params.Set("apikey", indexer.APIKey)
+	}
+	u.RawQuery = params.Encode()
+
+	resp, err := torznabClient.Get(u.String())
+	if err != nil {
+		// the error has the URL, with the API key in it
+		return nil, fmt.Errorf("not reachable")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// errors come as <error code="100" description="Invalid API Key"/>
+	var apiErr struct {
+		XMLName     xml.Name
+		Description string `xml:"description,attr"`
+	}
+	if xml.Unmarshal(body, &apiErr) == nil && apiErr.XMLName.Local == "error" {
+		return nil, fmt.Errorf("%s", apiErr.Description)
+	}
+
+	var feed torznabFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, err
+	}
+
+	results := make([]torznabResult, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		link := item.Enclosure.URL
+		if link == "" {
+			link = item.Link
+		}
+
+		size := item.Size
+		seeders, peers := -1, -1
+		for _, attr := range item.Attrs {
+			switch attr.Name {
+			case "magneturl":
+				link = attr.Value
+			case "seeders":
+				seeders, _ = strconv.Atoi(attr.Value)
+			case "peers":
+				peers, _ = strconv.Atoi(attr.Value)
+			case "size":
+				if n, err := strconv.ParseUint(attr.Value, 10, 64); err == nil && size == 0 {
+					size = n
+				}
+			}
+		}
+		if link == "" {
+			continue
+		}
+
+		results = append(results, torznabResult{
+			searchResult: searchResult{
+				Name: item.Title,
+				Link: link,
+				Info: fmt.Sprintf("%s · S: %s · P: %s · %s", loc.bytes(size),
+					swarmCount(seeders), swarmCount(peers), indexer.Name),
+			},
+			seeders: seeders,
+		})
+	}
+	return results, nil
+}
+
+// findCallback handles the Add buttons of find
+func findCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 1 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	result, err := cachedResult(cq.Message.Chat.ID, args[0])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Adding "+result.Name))
+
+	// addWithRetry answers in the chat of the update
+	addWithRetry(tgbotapi.Update{Message: cq.Message}, []string{result.Link}, addOptions{})
+}
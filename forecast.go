@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// forecastWindow is how far back the ingest rate is averaged
+const forecastWindow = 24 * time.Hour
+
+// forecast estimates when the download dir's disk will be full, from what the incomplete
+// torrents still need and the average download rate of the last day.
+func forecast(ud tgbotapi.Update) {
+	session, err := sessionGet()
+	if err != nil {
+		sendErr("forecast", err, ud.Message.Chat.ID)
+		return
+	}
+	free, err := freeSpace(session.DownloadDir)
+	if err != nil {
+		sendErr("forecast", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr("forecast", err, ud.Message.Chat.ID)
+		return
+	}
+
+	var left, current uint64
+	for i := range torrents {
+		if have := torrents[i].Have(); have < torrents[i].SizeWhenDone {
+			left += torrents[i].SizeWhenDone - have
+		}
+		current += torrents[i].RateDownload
+	}
+
+	rate, source := ingestRate(), "the last day's average"
+	if rate == 0 {
+		rate, source = current, "the current rate"
+	}
+
+	loc := chatLocale(ud.Message.Chat.ID)
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("Free on %s: %s\nIncomplete torrents need: %s\n", session.DownloadDir,
+		loc.bytes(free), loc.bytes(left)))
+
+	if left > free {
+		buf.WriteString(fmt.Sprintf("⚠️ %s short, the incomplete torrents won't fit", loc.bytes(left-free)))
+	} else {
+		buf.WriteString(fmt.Sprintf("%s will be left once they finish", loc.bytes(free-left)))
+	}
+
+	if rate == 0 {
+		buf.WriteString("\n\nNothing is downloading, so the disk isn't filling up")
+		send(buf.String(), ud.Message.Chat.ID, false)
+		return
+	}
+
+	fills := time.Duration(float64(free) / float64(rate) * float64(time.Second))
+	buf.WriteString(fmt.Sprintf("\n\nAt %s/s (%s) the disk is full in %s, around %s",
+		loc.bytes(rate), source, fills.Round(time.Minute), loc.time(time.Now().Add(fills))))
+	send(buf.String(), ud.Message.Chat.ID, false)
+}
+
+// ingestRate returns the average download rate over forecastWindow, from the activity samples
+func ingestRate() uint64 {
+	since := time.Now().Add(-forecastWindow).Unix()
+
+	var total, n uint64
+	stateMu.Lock()
+	for _, a := range state.Activity {
+		if a.Hour >= since && a.N > 0 {
+			total += a.Down / a.N
+			n++
+		}
+	}
+	stateMu.Unlock()
+
+	currentActivityMu.Lock()
+	if currentActivity.N > 0 {
+		total += currentActivity.Down / currentActivity.N
+		n++
+	}
+	currentActivityMu.Unlock()
+
+	if n == 0 {
+		return 0
+	}
+	return total / n
+}
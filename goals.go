@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// seedGoal is what a private tracker asks of a torrent before it can be removed without a
+// hit and run, reaching either Ratio or SeedTime is enough, 0 is no goal.
+type seedGoal struct {
+	Ratio    float64 `yaml:"ratio"`
+	SeedTime string  `yaml:"seed_time"` // e.g. "72h"
+
+	seedTime time.Duration // SeedTime parsed
+}
+
+// SeedGoals are loaded from the config file, by tracker host
+var SeedGoals map[string]seedGoal
+
+// seedGoalFor returns the goal of the first tracker of announces that has one
+func seedGoalFor(announces []rpcTracker) (string, seedGoal, bool) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	for _, announce := range announces {
+		u, err := url.Parse(announce.Announce)
+		if err != nil {
+			continue
+		}
+		for name, goal := range SeedGoals {
+			if hostMatches(u.Hostname(), name) {
+				return name, goal, true
+			}
+		}
+	}
+	return "", seedGoal{}, false
+}
+
+// reached returns true if a torrent with ratio that seeded for seeded met the goal
+func (g seedGoal) reached(ratio float64, seeded time.Duration) bool {
+	return (g.Ratio > 0 && ratio >= g.Ratio) || (g.seedTime > 0 && seeded >= g.seedTime)
+}
+
+// goals shows which of the completed torrents of the trackers in SeedGoals reached their
+// goal and can be removed, and how far the rest are from it.
+func goals(ud tgbotapi.Update) {
+	configMu.RLock()
+	none := len(SeedGoals) == 0
+	configMu.RUnlock()
+	if none {
+		send("*goals:* no seed_goals in the config", ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrents, err := getTorrentFields(nil, "id", "name", "trackers", "percentDone", "uploadRatio", "secondsSeeding")
+	if err != nil {
+		sendErr("goals", err, ud.Message.Chat.ID)
+		return
+	}
+
+	loc := chatLocale(ud.Message.Chat.ID)
+	safe, pending := new(bytes.Buffer), new(bytes.Buffer)
+	var nSafe, nPending int
+	for _, torrent := range torrents {
+		if torrent.PercentDone < 1 {
+			continue
+		}
+		tracker, goal, ok := seedGoalFor(torrent.Announces)
+		if !ok {
+			continue
+		}
+
+		seeded := time.Duration(torrent.SecondsSeeding) * time.Second
+		if goal.reached(torrent.UploadRatio, seeded) {
+			nSafe++
+			safe.WriteString(torrentLine(ud.Message.Chat.ID, torrent.ID, torrent.Name))
+			continue
+		}
+
+		nPending++
+		pending.WriteString(torrentLine(ud.Message.Chat.ID, torrent.ID, torrent.Name))
+		pending.WriteString(mdReplacer.Replace(tracker) + ":")
+		if goal.Ratio > 0 {
+			pending.WriteString(fmt.Sprintf(" ratio %s/%s", loc.float(torrent.UploadRatio, 2), loc.float(goal.Ratio, 2)))
+		}
+		if goal.seedTime > 0 {
+			pending.WriteString(fmt.Sprintf(" seeded %s/%s", roundDuration(seeded), roundDuration(goal.seedTime)))
+		}
+		pending.WriteString("\n\n")
+	}
+
+	if nSafe+nPending == 0 {
+		send("No completed torrents from the trackers with seed goals", ud.Message.Chat.ID, false)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if nSafe > 0 {
+		buf.WriteString(fmt.Sprintf("✅ *Safe to remove (%d)*\n", nSafe))
+		buf.Write(safe.Bytes())
+		buf.WriteString("\n")
+	}
+	if nPending > 0 {
+		buf.WriteString(fmt.Sprintf("⏳ *Still seeding (%d)*\n", nPending))
+		buf.Write(pending.Bytes())
+	}
+	sendListing(buf.String(), ud.Message.Chat.ID, false)
+}
+
+// roundDuration rounds d to the hour, or the minute when it's less than an hour
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Hour {
+		return d.Round(time.Minute)
+	}
+	return d.Round(time.Hour)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// speedKeep is how long the speed samples are kept for 'graph'
+const speedKeep = 24 * time.Hour
+
+// the size of the graph and its plot area
+const (
+	graphWidth  = 800
+	graphHeight = 400
+	graphMargin = 20
+)
+
+var (
+	graphBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	graphGrid       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	graphDown       = color.RGBA{0x1e, 0x88, 0xe5, 0xff}
+	graphUp         = color.RGBA{0x43, 0xa0, 0x47, 0xff}
+)
+
+// speedSample is the total transfer rate at one poll
+type speedSample struct {
+	at       time.Time
+	down, up uint64
+}
+
+var (
+	// speedSamples are the rates of the last speedKeep, oldest first. unlike the hourly
+	// activity they're only kept in memory.
+	speedSamples   []speedSample
+	speedSamplesMu sync.Mutex
+)
+
+func init() {
+	onPoll(sampleSpeed)
+}
+
+// sampleSpeed records the current transfer rate and drops the samples older than speedKeep
+func sampleSpeed(torrents transmission.Torrents) {
+	sample := speedSample{at: time.Now()}
+	for i := range torrents {
+		sample.down += torrents[i].RateDownload
+		sample.up += torrents[i].RateUpload
+	}
+
+	speedSamplesMu.Lock()
+	defer speedSamplesMu.Unlock()
+
+	oldest := sample.at.Add(-speedKeep)
+	i := 0
+	for i < len(speedSamples) && speedSamples[i].at.Before(oldest) {
+		i++
+	}
+	speedSamples = append(speedSamples[i:], sample)
+}
+
+// graph sends a chart of the download and upload speed of the last hour, or of the given
+// duration up to 24h, e.g. "graph 24h".
+func graph(ud tgbotapi.Update, tokens []string) {
+	span := time.Hour
+	if len(tokens) > 0 {
+		d, err := time.ParseDuration(tokens[0])
+		if err != nil || d <= 0 {
+			send(fmt.Sprintf("*graph:* %s is not a duration, e.g. 1h or 24h", tokens[0]), ud.Message.Chat.ID, false)
+			return
+		}
+		span = d
+	}
+	if span > speedKeep {
+		span = speedKeep
+	}
+
+	since := time.Now().Add(-span)
+	var samples []speedSample
+	speedSamplesMu.Lock()
+	for _, s := range speedSamples {
+		if !s.at.Before(since) {
+			samples = append(samples, s)
+		}
+	}
+	speedSamplesMu.Unlock()
+
+	if len(samples) < 2 {
+		send("*graph:* not enough samples yet, they're taken by the watcher (see -watch-interval)", ud.Message.Chat.ID, false)
+		return
+	}
+
+	data, err := drawGraph(samples, since, span)
+	if err != nil {
+		sendErr("graph", err, ud.Message.Chat.ID)
+		return
+	}
+
+	var peakDown, peakUp, sumDown, sumUp uint64
+	for _, s := range samples {
+		sumDown += s.down
+		sumUp += s.up
+		if s.down > peakDown {
+			peakDown = s.down
+		}
+		if s.up > peakUp {
+			peakUp = s.up
+		}
+	}
+	n := uint64(len(samples))
+
+	loc := chatLocale(ud.Message.Chat.ID)
+	photo := tgbotapi.NewPhotoUpload(ud.Message.Chat.ID, tgbotapi.FileBytes{Name: "graph.png", Bytes: data})
+	photo.Caption = fmt.Sprintf("Last %s\n🔵 Download: peak %s/s, average %s/s\n🟢 Upload: peak %s/s, average %s/s",
+		span, loc.bytes(peakDown), loc.bytes(sumDown/n), loc.bytes(peakUp), loc.bytes(sumUp/n))
+
+	if _, err := botSend(photo); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// drawGraph plots samples taken from since over span as a PNG, the download in blue and the
+// upload in green, scaled to the peak of both. the grid lines are at quarters of the peak.
+func drawGraph(samples []speedSample, since time.Time, span time.Duration) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{graphBackground}, image.Point{}, draw.Src)
+
+	plotW, plotH := graphWidth-2*graphMargin, graphHeight-2*graphMargin
+	for q := 0; q <= 4; q++ {
+		y := graphMargin + plotH*q/4
+		drawLine(img, graphMargin, y, graphMargin+plotW, y, graphGrid)
+	}
+
+	var peak uint64 = 1
+	for _, s := range samples {
+		if s.down > peak {
+			peak = s.down
+		}
+		if s.up > peak {
+			peak = s.up
+		}
+	}
+
+	point := func(s speedSample, rate uint64) (int, int) {
+		x := graphMargin + int(float64(plotW)*float64(s.at.Sub(since))/float64(span))
+		y := graphMargin + plotH - int(float64(plotH)*float64(rate)/float64(peak))
+		return x, y
+	}
+
+	for i := 1; i < len(samples); i++ {
+		x0, y0 := point(samples[i-1], samples[i-1].up)
+		x1, y1 := point(samples[i], samples[i].up)
+		drawLine(img, x0, y0, x1, y1, graphUp)
+
+		x0, y0 = point(samples[i-1], samples[i-1].down)
+		x1, y1 = point(samples[i], samples[i].down)
+		drawLine(img, x0, y0, x1, y1, graphDown)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLine draws a 2px thick line from x0,y0 to x1,y1 with Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		img.Set(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// activityKeep is how long the hourly activity samples are kept
+const activityKeep = 30 * 24 * time.Hour
+
+// heatmapShades go from idle to the busiest hour
+var heatmapShades = []rune(" ░▒▓█")
+
+// activitySample is the average transfer rate (download + upload) of an hour
+type activitySample struct {
+	Hour  int64  `json:"hour"` // unix time of the start of the hour
+	Total uint64 `json:"total"`
+	Down  uint64 `json:"down"` // the download part of Total
+	N     uint64 `json:"n"`
+}
+
+// rate is the average bytes per second of the hour
+func (a activitySample) rate() uint64 {
+	if a.N == 0 {
+		return 0
+	}
+	return a.Total / a.N
+}
+
+var (
+	// currentActivity is the hour being sampled, it gets persisted once the hour is over
+	currentActivity   activitySample
+	currentActivityMu sync.Mutex
+)
+
+func init() {
+	onPoll(sampleActivity)
+}
+
+// sampleActivity adds the current transfer rate to the hour's sample
+func sampleActivity(torrents transmission.Torrents) {
+	var rate, down uint64
+	for i := range torrents {
+		rate += torrents[i].RateDownload + torrents[i].RateUpload
+		down += torrents[i].RateDownload
+	}
+
+	hour := time.Now().Truncate(time.Hour).Unix()
+
+	currentActivityMu.Lock()
+	defer currentActivityMu.Unlock()
+
+	if currentActivity.Hour != hour {
+		if currentActivity.N > 0 {
+			saveActivity(currentActivity)
+		}
+		currentActivity = activitySample{Hour: hour}
+	}
+	currentActivity.Total += rate
+	currentActivity.Down += down
+	currentActivity.N++
+}
+
+// saveActivity persists a finished hour and drops the ones older than activityKeep
+func saveActivity(sample activitySample) {
+	oldest := time.Now().Add(-activityKeep).Unix()
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	kept := state.Activity[:0]
+	for _, a := range state.Activity {
+		if a.Hour >= oldest {
+			kept = append(kept, a)
+		}
+	}
+	state.Activity = append(kept, sample)
+
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
+
+// heatmap shows the transfer activity of the last days by hour, e.g. "heatmap 7d"
+func heatmap(ud tgbotapi.Update, tokens []string) {
+	days := 7
+	if len(tokens) > 0 {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(tokens[0]), "d"))
+		if err != nil || n < 1 {
+			send(fmt.Sprintf("*heatmap:* %s is not a number of days, e.g. 7d", tokens[0]), ud.Message.Chat.ID, false)
+			return
+		}
+		days = n
+	}
+	if limit := int(activityKeep / (24 * time.Hour)); days > limit {
+		days = limit
+	}
+
+	rates := make(map[int64]uint64)
+	stateMu.Lock()
+	for _, a := range state.Activity {
+		rates[a.Hour] = a.rate()
+	}
+	stateMu.Unlock()
+
+	currentActivityMu.Lock()
+	if currentActivity.N > 0 {
+		rates[currentActivity.Hour] = currentActivity.rate()
+	}
+	currentActivityMu.Unlock()
+
+	if len(rates) == 0 {
+		send("*heatmap:* no activity recorded yet, it's sampled by the watcher (see -watch-interval)", ud.Message.Chat.ID, false)
+		return
+	}
+
+	var busiest uint64
+	for _, rate := range rates {
+		if rate > busiest {
+			busiest = rate
+		}
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("```\n       0     6     12    18\n")
+	for d := days - 1; d >= 0; d-- {
+		day := today.AddDate(0, 0, -d)
+		buf.WriteString(day.Format("Mon 02") + " ")
+		for h := 0; h < 24; h++ {
+			hour := day.Add(time.Duration(h) * time.Hour)
+			rate, ok := rates[hour.Unix()]
+			if !ok || hour.After(now) {
+				buf.WriteString("·")
+				continue
+			}
+
+			shade := 0
+			if busiest > 0 {
+				shade = int(rate * uint64(len(heatmapShades)-1) / busiest)
+			}
+			if rate > 0 && shade == 0 {
+				shade = 1
+			}
+			buf.WriteRune(heatmapShades[shade])
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(fmt.Sprintf("```\n█ = %s/s, · = no samples", chatLocale(ud.Message.Chat.ID).bytes(busiest)))
+
+	send(buf.String(), ud.Message.Chat.ID, true)
+}
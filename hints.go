@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// hintSize is how big a completed torrent must be for its notification to get a hint
+const hintSize = 10 * humanize.GByte
+
+// idleHints are the commands worth knowing about after each kind of notification
+var idleHints = map[string]string{
+	"completed": "Try history for what completed lately, goals for what can be removed without a hit and run, and help for the rest.",
+	"errors":    "Try errors to see them grouped by tracker, check to verify a torrent, tracker pause when a tracker is down, and help for the rest.",
+}
+
+var (
+	// hinted are the chats that got a hint since their last command
+	hinted   = make(map[int64]bool)
+	hintedMu sync.Mutex
+)
+
+// markCommand records that a master sent a command in chat, the state is only saved when
+// it's been a while, not on every command
+func markCommand(chat int64) {
+	hintedMu.Lock()
+	delete(hinted, chat)
+	hintedMu.Unlock()
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if state.LastCommand == nil {
+		state.LastCommand = make(map[int64]int64)
+	}
+	now := time.Now().Unix()
+	last := state.LastCommand[chat]
+	state.LastCommand[chat] = now
+	if now-last < int64(time.Hour/time.Second) {
+		return
+	}
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
+
+// idleHint returns the greeting and the hint for kind when nobody sent a command in chat for
+// IdleHints, once until the next command. the chats that have no command recorded don't get it.
+func idleHint(chat int64, kind string) string {
+	configMu.RLock()
+	idle, greeting := IdleHints, IdleGreeting
+	configMu.RUnlock()
+
+	if idle <= 0 {
+		return ""
+	}
+
+	stateMu.Lock()
+	last, ok := state.LastCommand[chat]
+	stateMu.Unlock()
+
+	if !ok || time.Since(time.Unix(last, 0)) < idle {
+		return ""
+	}
+
+	hintedMu.Lock()
+	defer hintedMu.Unlock()
+	if hinted[chat] {
+		return ""
+	}
+	hinted[chat] = true
+	return "\n\n" + greeting + " " + idleHints[kind]
+}
+
+// notifyHinted is notify for the notable events, with the hint for kind in the chats that
+// have been idle
+func notifyHinted(text, kind string) {
+	for _, chat := range notifyChats() {
+		send(text+idleHint(chat, kind), chat, false)
+	}
+}
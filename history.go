@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	gosort "sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// torrentRecord is what the bot remembers about a torrent, transmission forgets it once the
+// torrent is removed
+type torrentRecord struct {
+	Name    string `json:"name"`
+	Tracker string `json:"tracker,omitempty"` // the host of the first tracker
+	Size    uint64 `json:"size"`
+	Added   int64  `json:"added"`            // unix time
+	Done    int64  `json:"done,omitempty"`   // unix time it completed, 0 until it does
+	Source  string `json:"source,omitempty"` // the URL or magnet it was added from, see 'source'
+}
+
+var (
+	// historyKnown are the IDs of the torrents that are in the history already
+	historyKnown   = make(map[int]bool)
+	historyKnownMu sync.Mutex
+)
+
+func init() {
+	onPoll(recordNew)
+	onCompletion(recordDone)
+}
+
+// backfillHistory records every torrent that's in transmission on the first start, so the
+// history has the torrents that were there before the bot.
+func backfillHistory() {
+	stateMu.Lock()
+	done := state.Backfilled
+	stateMu.Unlock()
+
+	if done {
+		return
+	}
+
+	n, err := recordTorrents(nil)
+	if err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+		return
+	}
+
+	stateMu.Lock()
+	state.Backfilled = true
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+		return
+	}
+	logger.Printf("[INFO] History: backfilled %d torrents", n)
+}
+
+// recordTorrents adds the torrents with ids to the history, all of them if ids is empty,
+// it returns how many were new.
+func recordTorrents(ids []int) (int, error) {
+	torrents, err := getTorrentFields(ids, "id", "hashString", "name", "trackers", "totalSize", "addedDate", "doneDate")
+	if err != nil {
+		return 0, err
+	}
+
+	records := make(map[string]torrentRecord)
+	for _, torrent := range torrents {
+		historyKnownMu.Lock()
+		historyKnown[torrent.ID] = true
+		historyKnownMu.Unlock()
+
+		record := torrentRecord{
+			Name:  torrent.Name,
+			Size:  torrent.TotalSize,
+			Added: torrent.AddedDate,
+			Done:  torrent.DoneDate,
+		}
+		if len(torrent.Announces) > 0 {
+			if u, err := url.Parse(torrent.Announces[0].Announce); err == nil {
+				record.Tracker = u.Hostname()
+			}
+		}
+		records[strings.ToLower(torrent.HashString)] = record
+	}
+
+	return historyAdd(records)
+}
+
+// recordNew adds the torrents that showed up since the last poll to the history
+func recordNew(torrents transmission.Torrents) {
+	var ids []int
+	historyKnownMu.Lock()
+	for i := range torrents {
+		if !historyKnown[torrents[i].ID] {
+			ids = append(ids, torrents[i].ID)
+		}
+	}
+	historyKnownMu.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+	if _, err := recordTorrents(ids); err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+	}
+}
+
+// recordDone records when a torrent completed
+func recordDone(t *transmission.Torrent) {
+	torrent, err := getTorrentExtra(t.ID, "hashString")
+	if err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+		return
+	}
+	hash := strings.ToLower(torrent.HashString)
+
+	// it might have been added and completed between two polls
+	if _, err := recordTorrents([]int{t.ID}); err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+		return
+	}
+
+	err = historyUpdate(hash, func(record *torrentRecord) bool {
+		record.Done = time.Now().Unix()
+		return true
+	})
+	if err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+	}
+}
+
+// history shows the last n torrents that completed, or the ones that completed in the last
+// n days along with the data transferred in them, from the stats recorded in the history, e.g. "history 20" or "history 7d".
+func history(ud tgbotapi.Update, tokens []string) {
+	n, days := 10, 0
+	if len(tokens) > 0 {
+		arg := strings.ToLower(tokens[0])
+		num, err := strconv.Atoi(strings.TrimSuffix(arg, "d"))
+		if err != nil || num <= 0 {
+			send("*history:* takes a number of torrents, or of days like 7d", ud.Message.Chat.ID, false)
+			return
+		}
+		if strings.HasSuffix(arg, "d") {
+			days = num
+		} else {
+			n = num
+		}
+	}
+
+	var since int64
+	if days > 0 {
+		since = time.Now().AddDate(0, 0, -days).Unix()
+	}
+
+	var done []torrentRecord
+	err := historyEach(func(hash string, record torrentRecord) {
+		if record.Done > 0 && record.Done >= since {
+			done = append(done, record)
+		}
+	})
+	if err != nil {
+		sendErr("history", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if len(done) == 0 {
+		if days > 0 {
+			send(fmt.Sprintf("Nothing completed in the last %d days", days), ud.Message.Chat.ID, false)
+			return
+		}
+		send("Nothing completed yet", ud.Message.Chat.ID, false)
+		return
+	}
+
+	gosort.Slice(done, func(i, j int) bool { return done[i].Done > done[j].Done })
+	if days == 0 && len(done) > n {
+		done = done[:n]
+	}
+
+	loc := chatLocale(ud.Message.Chat.ID)
+	buf := new(bytes.Buffer)
+	if days > 0 {
+		var total uint64
+		for _, record := range done {
+			total += record.Size
+		}
+		buf.WriteString(fmt.Sprintf("*%d completed in the last %d days, %s*\n", len(done), days, loc.bytes(total)))
+
+		// up to now, not just to the last sample
+		now, err := currentStats()
+		if err != nil {
+			logger.Printf("[ERROR] History: %s", err)
+		}
+		down, up, from, ok, err := transferredSince(since, now)
+		if err != nil {
+			logger.Printf("[ERROR] History: %s", err)
+		}
+		if ok {
+			buf.WriteString(fmt.Sprintf("Downloaded *%s*, uploaded *%s*", loc.bytes(down), loc.bytes(up)))
+			if from-since > int64(statsInterval/time.Second) {
+				buf.WriteString(fmt.Sprintf(" since %s", loc.time(time.Unix(from, 0))))
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+	}
+
+	for _, record := range done {
+		buf.WriteString(fmt.Sprintf("*%s*\n", mdReplacer.Replace(displayName(ud.Message.Chat.ID, record.Name))))
+		buf.WriteString(fmt.Sprintf("%s, %s", loc.time(time.Unix(record.Done, 0)), loc.bytes(record.Size)))
+		if record.Added > 0 && record.Done >= record.Added {
+			buf.WriteString(fmt.Sprintf(", took %s", roundDuration(time.Duration(record.Done-record.Added)*time.Second)))
+		}
+		buf.WriteString("\n\n")
+	}
+
+	send(buf.String(), ud.Message.Chat.ID, true)
+}
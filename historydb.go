@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// the history lives in its own database rather than the state file, it only ever grows and the
+// state file gets rewritten as a whole on every change
+
+// statsInterval is how often transmission's cumulative stats are recorded
+const statsInterval = time.Hour
+
+var (
+	// HistoryDB is the file of the history database
+	HistoryDB string
+
+	historyDB *bolt.DB
+
+	// torrentsBucket are the torrentRecords by hash, statsBucket the statsSamples by time
+	torrentsBucket = []byte("torrents")
+	statsBucket    = []byte("stats")
+)
+
+// statsSample is transmission's cumulative stats at a time
+type statsSample struct {
+	Time int64  `json:"time"` // unix time
+	Down uint64 `json:"down"`
+	Up   uint64 `json:"up"`
+}
+
+// openHistory opens HistoryDB and moves the history that used to be in the state file into it,
+// must be called after loadState.
+func openHistory() error {
+	db, err := bolt.Open(HistoryDB, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("%s: %s", HistoryDB, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{torrentsBucket, statsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	historyDB = db
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if len(state.History) == 0 {
+		return nil
+	}
+	if _, err := historyAdd(state.History); err != nil {
+		return err
+	}
+	logger.Printf("[INFO] History: moved %d torrents from the state file to %s", len(state.History), HistoryDB)
+	state.History = nil
+	return saveState()
+}
+
+// historyAdd adds the records that aren't in the history yet, it returns how many were new
+func historyAdd(records map[string]torrentRecord) (int, error) {
+	var n int
+	err := historyDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(torrentsBucket)
+		for hash, record := range records {
+			if bucket.Get([]byte(hash)) != nil {
+				continue
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(hash), data); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// historyUpdate changes the record of hash with fn, nothing happens if there's no record of it
+// or fn returns false.
+func historyUpdate(hash string, fn func(record *torrentRecord) bool) error {
+	return historyDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(torrentsBucket)
+		data := bucket.Get([]byte(hash))
+		if data == nil {
+			return nil
+		}
+
+		var record torrentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if !fn(&record) {
+			return nil
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(hash), data)
+	})
+}
+
+// historyGet returns the record of hash
+func historyGet(hash string) (torrentRecord, bool, error) {
+	var record torrentRecord
+	var ok bool
+	err := historyDB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(torrentsBucket).Get([]byte(hash))
+		if data == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(data, &record)
+	})
+	return record, ok, err
+}
+
+// historyEach calls fn with every record in the history
+func historyEach(fn func(hash string, record torrentRecord)) error {
+	return historyDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(torrentsBucket).ForEach(func(k, v []byte) error {
+			var record torrentRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			fn(string(k), record)
+			return nil
+		})
+	})
+}
+
+// statsKey is the key of a sample, big endian so the samples sort by time
+func statsKey(t int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t))
+	return key
+}
+
+// currentStats gets transmission's cumulative stats now
+func currentStats() (statsSample, error) {
+	stats, err := rpcClient().GetStats()
+	if err != nil {
+		return statsSample{}, err
+	}
+	return statsSample{
+		Time: time.Now().Unix(),
+		Down: stats.CumulativeStats.DownloadedBytes,
+		Up:   stats.CumulativeStats.UploadedBytes,
+	}, nil
+}
+
+// recordStats adds a sample of the stats to the history
+func recordStats() error {
+	sample, err := currentStats()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	return historyDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(statsBucket).Put(statsKey(sample.Time), data)
+	})
+}
+
+// startStatsHistory records the stats every statsInterval
+func startStatsHistory() {
+	go runLoop("stats history", func() time.Duration { return statsInterval }, recordStats)
+}
+
+// transferredSince adds up what was downloaded and uploaded between the samples since since and
+// now, it returns the time of the first sample, which is later than since when the bot wasn't
+// running yet. ok is false without a sample since then.
+func transferredSince(since int64, now statsSample) (down, up uint64, from int64, ok bool, err error) {
+	var samples []statsSample
+	err = historyDB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(statsBucket).Cursor()
+		for k, v := c.Seek(statsKey(since)); k != nil; k, v = c.Next() {
+			var sample statsSample
+			if err := json.Unmarshal(v, &sample); err != nil {
+				return err
+			}
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	if err != nil || len(samples) == 0 {
+		return 0, 0, 0, false, err
+	}
+	if now.Time > 0 {
+		samples = append(samples, now)
+	}
+
+	// the cumulative stats start over when transmission's stats get reset, what came after
+	// the reset is all there is of that hour then
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1], samples[i]
+		if cur.Down >= prev.Down && cur.Up >= prev.Up {
+			down, up = down+cur.Down-prev.Down, up+cur.Up-prev.Up
+		} else {
+			down, up = down+cur.Down, up+cur.Up
+		}
+	}
+	return down, up, samples[0].Time, true, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// the events that can run a script, as they are named in the config's hooks
+const (
+	eventStarted   = "started"
+	eventStopped   = "stopped"
+	eventAdded     = "added"
+	eventCompleted = "completed"
+	eventErrored   = "errored"
+	eventLowDisk   = "low_disk"
+)
+
+// hookTimeout is how long a hook script can run before it's killed
+const hookTimeout = time.Minute
+
+// Hooks are the scripts to run on each event, from the config file, e.g.
+// "added: /usr/local/bin/on-added.sh". they run through sh with the details
+// of the event in TT_ environment variables.
+var Hooks map[string]string
+
+func init() {
+	onCompletion(func(t *transmission.Torrent) {
+		go runTorrentHook(eventCompleted, t)
+	})
+	onAdded(func(torrents transmission.Torrents) {
+		for _, t := range torrents {
+			go runTorrentHook(eventAdded, t)
+		}
+	})
+	onError(func(torrents transmission.Torrents) {
+		for _, t := range torrents {
+			go runTorrentHook(eventErrored, t)
+		}
+	})
+}
+
+// runHook runs the script of event, if there's one
+func runHook(event string, env map[string]string) {
+	configMu.RLock()
+	script := Hooks[event]
+	configMu.RUnlock()
+
+	if script == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Env = append(os.Environ(), "TT_EVENT="+event)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		logger.Printf("[ERROR] Hook %s: %s: %s", event, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// runTorrentHook runs the script of an event about torrent t
+func runTorrentHook(event string, t *transmission.Torrent) {
+	env := map[string]string{
+		"TT_ID":    fmt.Sprint(t.ID),
+		"TT_NAME":  t.Name,
+		"TT_ERROR": t.ErrorString,
+	}
+
+	// the transmission package doesn't get these
+	if extra, err := getTorrentExtra(t.ID, "hashString", "downloadDir"); err == nil {
+		env["TT_HASH"] = extra.HashString
+		env["TT_DIR"] = extra.DownloadDir
+	}
+
+	runHook(event, env)
+}
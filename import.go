@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+var (
+	magnetRegex = regexp.MustCompile(`magnet:\?[^\s"'<>]+`)
+	btihRegex   = regexp.MustCompile(`(?i)urn:btih:([a-z0-9]+)`)
+)
+
+// importMagnets adds every magnet link found in a document, it can be a telegram
+// chat export (result.json) or any text file.
+func importMagnets(ud tgbotapi.Update, link string) {
+	resp, err := http.Get(link)
+	if err != nil {
+		sendErr("import", err, ud.Message.Chat.ID)
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		sendErr("import", err, ud.Message.Chat.ID)
+		return
+	}
+
+	// a chat export has the messages' text as JSON strings, walk them to get them unescaped
+	var texts []string
+	var export interface{}
+	if json.Unmarshal(data, &export) == nil {
+		texts = jsonStrings(export, texts)
+	} else {
+		texts = []string{string(data)}
+	}
+
+	// the hashes we already have, to skip the duplicates
+	have := make(map[string]bool)
+	torrents, err := getTorrentFields(nil, "hashString")
+	if err != nil {
+		sendErr("import", err, ud.Message.Chat.ID)
+		return
+	}
+	for _, torrent := range torrents {
+		have[strings.ToLower(torrent.HashString)] = true
+	}
+
+	var magnets []string
+	var duplicates int
+	for _, text := range texts {
+		for _, magnet := range magnetRegex.FindAllString(text, -1) {
+			// without a hash there's nothing to tell, only the same link twice is a duplicate
+			hash := magnetHash(magnet)
+			if hash == "" {
+				hash = magnet
+			}
+			if have[hash] {
+				duplicates++
+				continue
+			}
+			have[hash] = true
+			magnets = append(magnets, magnet)
+		}
+	}
+
+	if len(magnets) == 0 {
+		send(fmt.Sprintf("*import:* no new magnets, %d duplicates", duplicates), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// add them paused to check their size before transmission writes them all out
+	var opts addOptions
+	guard := preallocGuard()
+	if guard {
+		opts.Paused = true
+	}
+
+	ctx, finish := startOp(ud.Message.Chat.ID)
+	defer finish()
+
+	// spread them out, not to hammer the trackers
+	delay := staggerDelay(len(magnets))
+
+	p := newProgress(ud.Message.Chat.ID, "Importing", len(magnets))
+	var added, failed int
+	for i, magnet := range magnets {
+		if ctx.Err() != nil {
+			p.finish(fmt.Sprintf("Cancelled\nImported: %d\nDuplicates: %d\nFailed: %d\nSkipped: %d",
+				added, duplicates, failed, len(magnets)-i))
+			return
+		}
+
+		torrent, err := addOne(magnet, opts)
+		if err != nil {
+			logger.Printf("[ERROR] Import: %s", err)
+			failed++
+		} else {
+			added++
+			if guard {
+				go checkPrealloc(ud.Message.Chat.ID, torrent.ID)
+			}
+			go confirmSize(ud.Message.Chat.ID, torrent.ID)
+		}
+		p.update(i+1, len(magnets))
+		if i+1 < len(magnets) {
+			staggerWait(ctx, delay)
+		}
+	}
+
+	p.finish(fmt.Sprintf("Imported: %d\nDuplicates: %d\nFailed: %d", added, duplicates, failed))
+}
+
+// jsonStrings appends every string value in v to texts
+func jsonStrings(v interface{}, texts []string) []string {
+	switch v := v.(type) {
+	case string:
+		texts = append(texts, v)
+	case []interface{}:
+		for i := range v {
+			texts = jsonStrings(v[i], texts)
+		}
+	case map[string]interface{}:
+		for _, value := range v {
+			texts = jsonStrings(value, texts)
+		}
+	}
+	return texts
+}
+
+// magnetHash returns the info hash of a magnet link in lower cased hex, the way transmission
+// has it, or an empty string
+func magnetHash(magnet string) string {
+	sm := btihRegex.FindStringSubmatch(magnet)
+	if len(sm) < 2 {
+		return ""
+	}
+
+	// the older links have it in base32
+	if len(sm[1]) == 32 {
+		if raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(sm[1])); err == nil {
+			return hex.EncodeToString(raw)
+		}
+	}
+	return strings.ToLower(sm[1])
+}
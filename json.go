@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// jsonCommands are the commands that have a JSON output, see jsonOutput
+var jsonCommands = map[string]bool{
+	"speed": true, "ss": true,
+	"stats": true, "sa": true,
+	"count": true, "co": true,
+	"list": true, "li": true, "ls": true,
+	"search": true, "se": true,
+	"info": true, "in": true,
+	"head": true, "he": true,
+	"tail": true, "ta": true,
+	"latest": true, "la": true,
+	"downs": true, "dg": true,
+	"seeding": true, "sd": true,
+	"paused": true, "pa": true,
+	"checking": true, "ch": true,
+	"active": true, "ac": true,
+	"errors": true, "er": true,
+}
+
+// jsonTorrent is how a torrent looks in the JSON output
+type jsonTorrent struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	Status         string  `json:"status"`
+	PercentDone    float64 `json:"percent_done"`
+	SizeWhenDone   uint64  `json:"size_when_done"`
+	Have           uint64  `json:"have"`
+	RateDownload   uint64  `json:"rate_download"`
+	RateUpload     uint64  `json:"rate_upload"`
+	DownloadedEver uint64  `json:"downloaded_ever"`
+	UploadedEver   uint64  `json:"uploaded_ever"`
+	Ratio          string  `json:"ratio"`
+	ETA            string  `json:"eta"`
+	Added          string  `json:"added"`
+	Error          string  `json:"error,omitempty"`
+}
+
+func newJSONTorrent(t *transmission.Torrent) jsonTorrent {
+	return jsonTorrent{
+		ID:             t.ID,
+		Name:           t.Name,
+		Status:         t.TorrentStatus(),
+		PercentDone:    t.PercentDone,
+		SizeWhenDone:   t.SizeWhenDone,
+		Have:           t.Have(),
+		RateDownload:   t.RateDownload,
+		RateUpload:     t.RateUpload,
+		DownloadedEver: t.DownloadedEver,
+		UploadedEver:   t.UploadedEver,
+		Ratio:          t.Ratio(),
+		ETA:            t.ETA(),
+		Added:          time.Unix(t.AddedDate, 0).Format(time.RFC3339),
+		Error:          t.ErrorString,
+	}
+}
+
+// jsonOutput sends the results of command as JSON, for other bots and scripts to parse,
+// e.g. "list json" or "head 3 json".
+func jsonOutput(ud tgbotapi.Update, command string, tokens []string) {
+	command = strings.TrimPrefix(command, "/")
+
+	var result interface{}
+	switch command {
+	case "speed", "ss":
+		stats, err := rpcClient().GetStats()
+		if err != nil {
+			sendErr("json", err, ud.Message.Chat.ID)
+			return
+		}
+		result = map[string]uint64{"download": stats.DownloadSpeed, "upload": stats.UploadSpeed}
+
+	case "stats", "sa":
+		stats, err := rpcClient().GetStats()
+		if err != nil {
+			sendErr("json", err, ud.Message.Chat.ID)
+			return
+		}
+		result = stats
+
+	case "count", "co":
+		torrents, err := rpcClient().GetTorrents()
+		if err != nil {
+			sendErr("json", err, ud.Message.Chat.ID)
+			return
+		}
+
+		counts := make(map[string]int)
+		for i := range torrents {
+			counts[torrents[i].TorrentStatus()]++
+		}
+		counts["Total"] = len(torrents)
+		result = counts
+
+	default:
+		torrents, err := selectTorrents(ud.Message.Chat.ID, command, tokens)
+		if err != nil {
+			sendErr("json", err, ud.Message.Chat.ID)
+			return
+		}
+
+		out := make([]jsonTorrent, 0, len(torrents))
+		for i := range torrents {
+			out = append(out, newJSONTorrent(torrents[i]))
+		}
+		result = out
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		sendErr("json", err, ud.Message.Chat.ID)
+		return
+	}
+
+	// a backtick would end the code block, its unicode escape is the same thing to a JSON parser
+	payload := strings.Replace(string(data), "`", "\\u0060", -1)
+
+	// too long for a single message, send it as a file so it stays parsable
+	if len(payload) > 4000 {
+		doc := tgbotapi.NewDocumentUpload(ud.Message.Chat.ID, tgbotapi.FileBytes{
+			Name:  command + ".json",
+			Bytes: data,
+		})
+		if _, err := botSend(doc); err != nil {
+			logger.Printf("[ERROR] Send: %s", err)
+		}
+		return
+	}
+
+	send("```\n"+payload+"\n```", ud.Message.Chat.ID, true)
+}
+
+// selectTorrents returns the torrents that a listing command would list in chat
+func selectTorrents(chat int64, command string, tokens []string) (transmission.Torrents, error) {
+	torrents, err := rpcClient().GetTorrents()
+	if err != nil {
+		return nil, err
+	}
+
+	// "label:tv" narrows any of them down to the torrents labeled tv
+	filter, tokens, err := queryFilter(anyTorrent, tokens)
+	if err != nil {
+		return nil, err
+	}
+	torrents = filterTorrents(torrents, filter)
+
+	// commands that take n, default to 5
+	n := 5
+	if len(tokens) > 0 {
+		if num, err := strconv.Atoi(tokens[0]); err == nil {
+			n = num
+		}
+	}
+	if n <= 0 || n > len(torrents) {
+		n = len(torrents)
+	}
+
+	switch command {
+	case "list", "li", "ls":
+		if len(tokens) == 0 {
+			return torrents, nil
+		}
+		regx, err := compileQuery(tokens[0])
+		if err != nil {
+			return nil, err
+		}
+		return filterTorrents(torrents, func(t *transmission.Torrent) bool {
+			return regx.MatchString(t.GetTrackers())
+		}), nil
+
+	case "search", "se":
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("search needs an argument")
+		}
+		regx, err := compileQuery(strings.Join(tokens, " "))
+		if err != nil {
+			return nil, err
+		}
+		return filterTorrents(torrents, func(t *transmission.Torrent) bool {
+			return matchName(chat, regx, t.Name)
+		}), nil
+
+	case "info", "in":
+		ids := make(map[int]bool)
+		for _, token := range tokens {
+			id, err := strconv.Atoi(token)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a number", token)
+			}
+			ids[id] = true
+		}
+		return filterTorrents(torrents, func(t *transmission.Torrent) bool {
+			return ids[t.ID]
+		}), nil
+
+	case "head", "he":
+		return torrents[:n], nil
+	case "tail", "ta":
+		return torrents[len(torrents)-n:], nil
+	case "latest", "la":
+		torrents.SortAge(true)
+		return torrents[:n], nil
+
+	case "downs", "dg":
+		return filterTorrents(torrents, isDownloading), nil
+	case "seeding", "sd":
+		return filterTorrents(torrents, isSeeding), nil
+	case "paused", "pa":
+		return filterTorrents(torrents, isPaused), nil
+	case "checking", "ch":
+		return filterTorrents(torrents, isChecking), nil
+	case "active", "ac":
+		return filterTorrents(torrents, isActive), nil
+	case "errors", "er":
+		return filterTorrents(torrents, hasError), nil
+	}
+
+	return nil, fmt.Errorf("%s has no JSON output", command)
+}
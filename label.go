@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// label manages the torrents' labels (transmission 3.0+), "label <id> [id...] <label>" adds a label
+func label(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*label* takes one of:\n  _<id> [id...] <label>_\n  _rename <old> <new>_\n  _merge <from> <into>_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	if _, err := strconv.Atoi(tokens[0]); err == nil {
+		if len(tokens) < 2 {
+			send("*label:* needs a label after the IDs", ud.Message.Chat.ID, false)
+			return
+		}
+
+		ids, err := parseIDs(tokens[:len(tokens)-1])
+		if err != nil {
+			sendErr("label", err, ud.Message.Chat.ID)
+			return
+		}
+
+		name := tokens[len(tokens)-1]
+		n, err := changeLabels(ids, func(labels []string) []string {
+			return append(labels, name)
+		})
+		if err != nil {
+			sendErr("label", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("*label:* labeled %d torrents %s", n, name), ud.Message.Chat.ID, false)
+		return
+	}
+
+	switch strings.ToLower(tokens[0]) {
+	case "rename", "merge":
+		if len(tokens) != 3 {
+			send(fmt.Sprintf("*label:* %s needs two labels", tokens[0]), ud.Message.Chat.ID, false)
+			return
+		}
+
+		n, err := replaceLabel(tokens[1], tokens[2])
+		if err != nil {
+			sendErr("label", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("*label:* %s → %s on %d torrents", tokens[1], tokens[2], n), ud.Message.Chat.ID, false)
+
+	default:
+		send("*label:* unknown subcommand "+tokens[0], ud.Message.Chat.ID, false)
+	}
+}
+
+// replaceLabel replaces the label from with into on every torrent that has it,
+// into can be an existing label, which merges the two. it returns the number of changed torrents.
+func replaceLabel(from, into string) (int, error) {
+	torrents, err := getTorrentFields(nil, "id", "labels")
+	if err != nil {
+		return 0, err
+	}
+
+	var changed int
+	for _, torrent := range torrents {
+		var found bool
+		labels := make([]string, 0, len(torrent.Labels))
+		seen := make(map[string]bool)
+		for _, l := range torrent.Labels {
+			if strings.EqualFold(l, from) {
+				found = true
+				l = into
+			}
+			if seen[strings.ToLower(l)] {
+				continue
+			}
+			seen[strings.ToLower(l)] = true
+			labels = append(labels, l)
+		}
+
+		if !found {
+			continue
+		}
+
+		if err := torrentSet([]int{torrent.ID}, map[string]interface{}{"labels": labels}); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// unlabel removes a label from torrents, "unlabel <id> [id...] <label>", or all
+// their labels with "unlabel <id> [id...]".
+func unlabel(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*unlabel:* needs torrent IDs and optionally a label", ud.Message.Chat.ID, false)
+		return
+	}
+
+	// the last token is the label if it's not an ID
+	var name string
+	if _, err := strconv.Atoi(tokens[len(tokens)-1]); err != nil {
+		name = tokens[len(tokens)-1]
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	ids, err := parseIDs(tokens)
+	if err != nil {
+		sendErr("unlabel", err, ud.Message.Chat.ID)
+		return
+	}
+
+	n, err := changeLabels(ids, func(labels []string) []string {
+		if name == "" {
+			return []string{}
+		}
+		kept := []string{}
+		for _, l := range labels {
+			if !strings.EqualFold(l, name) {
+				kept = append(kept, l)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		sendErr("unlabel", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("*unlabel:* changed %d torrents", n), ud.Message.Chat.ID, false)
+}
+
+// labels lists the labels in use and how many torrents have each
+func labels(ud tgbotapi.Update) {
+	torrents, err := getTorrentFields(nil, "id", "labels")
+	if err != nil {
+		sendErr("labels", err, ud.Message.Chat.ID)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, torrent := range torrents {
+		for _, l := range torrent.Labels {
+			counts[l]++
+		}
+	}
+
+	if len(counts) == 0 {
+		send("*labels:* no torrent has a label", ud.Message.Chat.ID, false)
+		return
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	gosort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("%s: %d\n", name, counts[name]))
+	}
+	send(buf.String(), ud.Message.Chat.ID, false)
+}
+
+// changeLabels sets the labels of the torrents with ids to what change returns for their
+// current labels, it returns the number of changed torrents.
+func changeLabels(ids []int, change func(labels []string) []string) (int, error) {
+	torrents, err := getTorrentFields(ids, "id", "labels")
+	if err != nil {
+		return 0, err
+	}
+	if len(torrents) == 0 {
+		return 0, fmt.Errorf("no torrents with those IDs")
+	}
+
+	var changed int
+	for _, torrent := range torrents {
+		before := strings.Join(torrent.Labels, ",")
+
+		// no duplicates, labels are case insensitive
+		seen := make(map[string]bool)
+		labels := []string{}
+		for _, l := range change(append([]string{}, torrent.Labels...)) {
+			if seen[strings.ToLower(l)] {
+				continue
+			}
+			seen[strings.ToLower(l)] = true
+			labels = append(labels, l)
+		}
+
+		if strings.Join(labels, ",") == before {
+			continue
+		}
+		if err := torrentSet([]int{torrent.ID}, map[string]interface{}{"labels": labels}); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// parseIDs parses torrent IDs
+func parseIDs(tokens []string) ([]int, error) {
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		id, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", token)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// the seedRatioMode values of torrent-set
+const (
+	ratioGlobal    = 0
+	ratioSingle    = 1
+	ratioUnlimited = 2
+)
+
+// tlimit sets the speed limits of a torrent, e.g. "tlimit 42 down 1MB up 200KB",
+// "off" or "unlimited" removes a limit.
+func tlimit(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) < 3 || len(tokens)%2 != 1 {
+		send("*tlimit:* needs a torrent ID and limits, e.g. _tlimit 42 down 1MB up 200KB_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*tlimit:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	fields := make(map[string]interface{})
+	var changes []string
+	for i := 1; i < len(tokens); i += 2 {
+		var field string
+		switch strings.ToLower(tokens[i]) {
+		case "down", "dl":
+			field = "download"
+		case "up", "ul":
+			field = "upload"
+		default:
+			send(fmt.Sprintf("*tlimit:* %s is not down or up", tokens[i]), ud.Message.Chat.ID, false)
+			return
+		}
+
+		value := strings.ToLower(tokens[i+1])
+		if value == "off" || value == "unlimited" {
+			fields[field+"Limited"] = false
+			changes = append(changes, field+" unlimited")
+			continue
+		}
+
+		size, err := humanize.ParseBytes(value)
+		if err != nil {
+			send(fmt.Sprintf("*tlimit:* %s is not a speed, e.g. 1MB", tokens[i+1]), ud.Message.Chat.ID, false)
+			return
+		}
+
+		// transmission's limits are in KB/s
+		fields[field+"Limited"] = true
+		fields[field+"Limit"] = size / 1000
+		changes = append(changes, fmt.Sprintf("%s %s/s", field, chatLocale(ud.Message.Chat.ID).bytes(size/1000*1000)))
+	}
+
+	if err := torrentSet([]int{id}, fields); err != nil {
+		sendErr("tlimit", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("*tlimit:* <%d> %s", id, strings.Join(changes, ", ")), ud.Message.Chat.ID, false)
+}
+
+// tratio sets the seed ratio limit of a torrent, "tratio 42 2.0", "tratio 42 unlimited",
+// or "tratio 42 global" to go back to the global limit.
+func tratio(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) != 2 {
+		send("*tratio:* needs a torrent ID and a ratio, _unlimited_ or _global_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*tratio:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	var fields map[string]interface{}
+	switch value := strings.ToLower(tokens[1]); value {
+	case "unlimited", "off":
+		fields = map[string]interface{}{"seedRatioMode": ratioUnlimited}
+	case "global":
+		fields = map[string]interface{}{"seedRatioMode": ratioGlobal}
+	default:
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 {
+			send(fmt.Sprintf("*tratio:* %s is not a ratio, e.g. 2.0", tokens[1]), ud.Message.Chat.ID, false)
+			return
+		}
+		fields = map[string]interface{}{"seedRatioMode": ratioSingle, "seedRatioLimit": ratio}
+	}
+
+	if err := torrentSet([]int{id}, fields); err != nil {
+		sendErr("tratio", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("*tratio:* <%d> %s", id, tokens[1]), ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// listingTop is how many torrents the "Top 20" button shows
+const listingTop = 20
+
+var (
+	// pendingListings are the listings waiting for one of the buttons of sendListing, by number
+	pendingListings   = make(map[int]string)
+	pendingListingsN  int
+	pendingListingsMu sync.Mutex
+
+	// listingCommands are the commands that answer with sendListing
+	listingCommands = map[string]bool{
+		"list": true, "li": true, "ls": true,
+		"downs": true, "dg": true,
+		"seeding": true, "sd": true,
+		"paused": true, "pa": true,
+		"checking": true, "ch": true,
+		"errors": true, "er": true,
+		"latest": true, "la": true,
+	}
+)
+
+// sendListing sends the markdown listing text to chat. When it would take more than
+// MaxMessages messages it switches to the compact format, one torrentLine per torrent,
+// and if even that is too long it asks how to send it. asFile sends it as a file right away,
+// see the "asfile" modifier.
+func sendListing(text string, chat int64, asFile bool) {
+	if asFile {
+		sendFile(chat, "listing.txt", plainMarkdown.Replace(text), "")
+		return
+	}
+
+	configMu.RLock()
+	limit := MaxMessages
+	configMu.RUnlock()
+
+	if limit <= 0 || messageCount(text) <= limit {
+		send(text, chat, true)
+		return
+	}
+
+	compact := compactListing(text)
+	lines := strings.Count(compact, "\n")
+	if compact != text && messageCount(compact) <= limit {
+		send(compact+fmt.Sprintf("\n_Compact listing of %d torrents, /info the ones you need_", lines), chat, true)
+		return
+	}
+
+	pendingListingsMu.Lock()
+	pendingListingsN++
+	n := pendingListingsN
+	pendingListings[n] = text
+	pendingListingsMu.Unlock()
+
+	msg := tgbotapi.NewMessage(chat, fmt.Sprintf("That's %d torrents, about %d messages. How should I send them?",
+		lines, messageCount(text)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Show all", fmt.Sprintf("listing:all:%d", n)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Top %d", listingTop), fmt.Sprintf("listing:top:%d", n)),
+			tgbotapi.NewInlineKeyboardButtonData("Export as file", fmt.Sprintf("listing:file:%d", n)),
+		),
+	)
+	if _, err := botSend(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// sendFile sends text to chat as the text file name, with an optional caption
+func sendFile(chat int64, name, text, caption string) {
+	doc := tgbotapi.NewDocumentUpload(chat, tgbotapi.FileBytes{
+		Name:  name,
+		Bytes: []byte(text),
+	})
+	doc.Caption = caption
+	if _, err := botSend(doc); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// messageCount is how many messages send splits text into
+func messageCount(text string) int {
+	return len(splitMessage(text, true))
+}
+
+// compactListing keeps only the torrentLine of each torrent in a listing
+func compactListing(text string) string {
+	var compact []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "`<") {
+			compact = append(compact, line)
+		}
+	}
+	if len(compact) == 0 {
+		return ""
+	}
+	return strings.Join(compact, "\n") + "\n"
+}
+
+// listingCallback handles the buttons of sendListing
+func listingCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	pendingListingsMu.Lock()
+	text, ok := pendingListings[n]
+	delete(pendingListings, n)
+	pendingListingsMu.Unlock()
+
+	if !ok {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Already answered"))
+		return
+	}
+
+	chat := cq.Message.Chat.ID
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, ""))
+
+	switch args[0] {
+	case "all":
+		botSend(tgbotapi.NewEditMessageText(chat, cq.Message.MessageID, "Sending all of them"))
+		sendChunks(text, chat, true)
+
+	case "top":
+		lines := strings.SplitAfter(compactListing(text), "\n")
+		lines = lines[:len(lines)-1] // after the last newline
+		more := len(lines) - listingTop
+		if more > 0 {
+			lines = lines[:listingTop]
+		}
+
+		botSend(tgbotapi.NewEditMessageText(chat, cq.Message.MessageID, fmt.Sprintf("Sending the first %d", len(lines))))
+		top := strings.Join(lines, "")
+		if more > 0 {
+			top += fmt.Sprintf("\n_…and %d more_", more)
+		}
+		send(top, chat, true)
+
+	case "file":
+		botSend(tgbotapi.NewEditMessageText(chat, cq.Message.MessageID, "Sending it as a file"))
+		sendFile(chat, "listing.txt", plainMarkdown.Replace(text), "")
+
+	default:
+		botSend(tgbotapi.NewEditMessageText(chat, cq.Message.MessageID, "Invalid request"))
+	}
+}
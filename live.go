@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// liveRender formats a live message from the torrents of the tick, "" leaves it as is
+type liveRender func(torrents transmission.Torrents) string
+
+// liveSession is a live-updating message, it's edited every interval for duration ticks and
+// then once more with final, if there's one, to show it stopped.
+type liveSession struct {
+	chat     int64
+	msgID    int
+	markdown bool
+	render   liveRender
+	final    liveRender
+	ticks    int
+	busy     bool // still editing the last tick
+}
+
+// liveStopMarkup is the button under the live messages
+var liveStopMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⏹ Stop updates", "live:stop"),
+	),
+)
+
+var (
+	// liveViews are the live sessions of each chat, chat id => message id => session
+	liveViews   = make(map[int64]map[int]*liveSession)
+	liveViewsMu sync.Mutex
+
+	liveOnce sync.Once
+)
+
+// startLive makes msgID in chat live, it's updated with render by the ticks of liveLoop.
+// it returns an error if the chat already has LiveCap live views running.
+func startLive(chat int64, msgID int, markdown bool, render, final liveRender) error {
+	// send gives 0 when it went out as a file, or not at all, there's nothing to update
+	if msgID == 0 {
+		return nil
+	}
+
+	configMu.RLock()
+	limit := LiveCap
+	configMu.RUnlock()
+
+	liveViewsMu.Lock()
+	defer liveViewsMu.Unlock()
+
+	views := liveViews[chat]
+	if views == nil {
+		views = make(map[int]*liveSession)
+		liveViews[chat] = views
+	}
+
+	if limit > 0 && len(views) >= limit {
+		return fmt.Errorf("this chat already has %d live views, this one won't be updated", len(views))
+	}
+
+	views[msgID] = &liveSession{chat: chat, msgID: msgID, markdown: markdown, render: render, final: final}
+	liveOnce.Do(func() { go liveLoop() })
+
+	go botSend(tgbotapi.NewEditMessageReplyMarkup(chat, msgID, liveStopMarkup))
+	return nil
+}
+
+// stopLive stops updating msgID in chat, it returns its session or nil if it wasn't live
+func stopLive(chat int64, msgID int) *liveSession {
+	liveViewsMu.Lock()
+	defer liveViewsMu.Unlock()
+
+	s := liveViews[chat][msgID]
+	delete(liveViews[chat], msgID)
+	if len(liveViews[chat]) == 0 {
+		delete(liveViews, chat)
+	}
+	return s
+}
+
+// liveTiming returns how often the live messages are updated and how many times
+func liveTiming() (time.Duration, int) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return time.Second * interval, duration
+}
+
+// liveLoop gets the torrents once every interval for all the live sessions, instead of each
+// of them polling on its own
+func liveLoop() {
+	for {
+		every, _ := liveTiming()
+		time.Sleep(every)
+
+		liveViewsMu.Lock()
+		var sessions []*liveSession
+		for _, views := range liveViews {
+			for _, s := range views {
+				if !s.busy {
+					s.busy = true
+					sessions = append(sessions, s)
+				}
+			}
+		}
+		liveViewsMu.Unlock()
+
+		if len(sessions) == 0 {
+			continue
+		}
+
+		torrents, err := getTorrents(statsFields...)
+		if err != nil {
+			// try again on the next tick
+			liveViewsMu.Lock()
+			for _, s := range sessions {
+				s.busy = false
+			}
+			liveViewsMu.Unlock()
+			continue
+		}
+
+		// the edits of a chat wait on each other in botSend, the chats don't
+		for _, s := range sessions {
+			go s.tick(torrents)
+		}
+	}
+}
+
+// tick updates the message of s, or gives it its final look once it's done
+func (s *liveSession) tick(torrents transmission.Torrents) {
+	_, times := liveTiming()
+
+	liveViewsMu.Lock()
+	s.ticks++
+	last := s.ticks > times
+	msgID := s.msgID
+	liveViewsMu.Unlock()
+
+	render := s.render
+	if last {
+		stopLive(s.chat, msgID)
+		render = s.final
+	}
+
+	var text string
+	if render != nil {
+		text = render(torrents)
+	}
+
+	// it might have been stopped with the button while rendering
+	liveViewsMu.Lock()
+	stopped := !last && liveViews[s.chat][msgID] != s
+	liveViewsMu.Unlock()
+
+	switch {
+	case text != "" && !stopped:
+		editLive(s.chat, &msgID, text, s.markdown, !last)
+	case last:
+		// just take the button away
+		botSend(tgbotapi.NewEditMessageReplyMarkup(s.chat, msgID, tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+		}))
+	}
+
+	liveViewsMu.Lock()
+	s.busy = false
+	liveViewsMu.Unlock()
+}
+
+// liveCallback handles the stop button of the live messages, they get their final look
+// right away
+func liveCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 1 || args[0] != "stop" {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	chat, msgID := cq.Message.Chat.ID, cq.Message.MessageID
+	s := stopLive(chat, msgID)
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Stopped"))
+
+	if s != nil && s.final != nil {
+		if torrents, err := getTorrents(statsFields...); err == nil {
+			if text := s.final(torrents); text != "" {
+				editLive(chat, &msgID, text, s.markdown, false)
+				return
+			}
+		}
+	}
+	botSend(tgbotapi.NewEditMessageReplyMarkup(chat, msgID, tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+	}))
+}
+
+// live shows or changes how often the live messages are updated and how many times, e.g.
+// "live 3 20" or "live 3s 1m", until the next restart
+func live(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		every, times := liveTiming()
+		send(fmt.Sprintf("Live messages are updated every %s, %d times", every, times), ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) != 2 {
+		send("*live:* needs the interval and the duration, e.g. _live 3 20_ or _live 3s 1m_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	every, err := parseLiveDuration(tokens[0])
+	if err != nil || every < time.Second {
+		send(fmt.Sprintf("*live:* %s is not an interval, e.g. 3 or 3s", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// the duration is a number of updates, or how long they go on
+	times, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		span, spanErr := time.ParseDuration(tokens[1])
+		if spanErr != nil {
+			times = 0
+		} else {
+			times = int(span / every)
+		}
+	}
+	if times < 1 {
+		send(fmt.Sprintf("*live:* %s is not a duration, e.g. 20 updates or 1m", tokens[1]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	configMu.Lock()
+	interval, duration = every/time.Second, times
+	configMu.Unlock()
+
+	send(fmt.Sprintf("Live messages are updated every %s, %d times", every/time.Second*time.Second, times), ud.Message.Chat.ID, false)
+}
+
+// parseLiveDuration parses seconds, or a duration like 3s
+func parseLiveDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// liveLine formats a torrent for head, tail and active
+func liveLine(chat int64, loc locale, t *transmission.Torrent) string {
+	torrentName := mdReplacer.Replace(displayName(chat, t.Name)) // escape markdown
+	return fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%s%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
+		t.ID, torrentName, t.TorrentStatus(), loc.bytes(t.Have()),
+		loc.bytes(t.SizeWhenDone), loc.float(t.PercentDone*100, 1), loc.bytes(t.RateDownload),
+		loc.bytes(t.RateUpload), loc.number(t.Ratio()))
+}
+
+// editLive updates the live view *msgID in chat with text, with the stop button while it's
+// still live. telegram refuses to edit messages that are too old (48 hours), in that case a
+// fresh message takes the view's place and *msgID is updated to it.
+func editLive(chat int64, msgID *int, text string, markdown, live bool) {
+	edit := tgbotapi.NewEditMessageText(chat, *msgID, text)
+	if markdown {
+		edit.ParseMode = tgbotapi.ModeMarkdown
+	}
+	if live {
+		edit.ReplyMarkup = &liveStopMarkup
+	}
+
+	_, err := editMarkdown(edit)
+	if err == nil {
+		return
+	}
+
+	// deleted, it's not coming back
+	if messageGone(err) {
+		stopLive(chat, *msgID)
+		return
+	}
+	if !tooOldToEdit(err) {
+		return
+	}
+
+	newID := send(text, chat, markdown)
+	if newID == 0 {
+		return
+	}
+	if live {
+		botSend(tgbotapi.NewEditMessageReplyMarkup(chat, newID, liveStopMarkup))
+	}
+
+	liveViewsMu.Lock()
+	if views := liveViews[chat]; views[*msgID] != nil {
+		views[newID] = views[*msgID]
+		views[newID].msgID = newID
+		delete(views, *msgID)
+	}
+	liveViewsMu.Unlock()
+
+	logger.Printf("[INFO] Live: message %d in %d can't be edited anymore, replaced it with %d", *msgID, chat, newID)
+	*msgID = newID
+}
+
+// tooOldToEdit returns true if err is telegram refusing to edit a message
+func tooOldToEdit(err error) bool {
+	return strings.Contains(err.Error(), "message can't be edited")
+}
+
+// messageGone returns true if err is telegram not finding the message, it was deleted
+func messageGone(err error) bool {
+	return strings.Contains(err.Error(), "message to edit not found")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// locale is how numbers and dates are written in a language
+type locale struct {
+	decimal string // the decimal separator
+	date    string // the layout of dates with a time
+}
+
+// locales are the languages with their own formats, by telegram's language_code,
+// the ones that aren't here use english.
+var locales = map[string]locale{
+	"en": {".", "Jan _2 15:04:05"},
+	"de": {",", "02.01.2006 15:04:05"},
+	"fr": {",", "02/01/2006 15:04:05"},
+	"es": {",", "02/01/2006 15:04:05"},
+	"it": {",", "02/01/2006 15:04:05"},
+	"pt": {",", "02/01/2006 15:04:05"},
+	"nl": {",", "02-01-2006 15:04:05"},
+	"pl": {",", "02.01.2006 15:04:05"},
+	"ru": {",", "02.01.2006 15:04:05"},
+	"uk": {",", "02.01.2006 15:04:05"},
+	"tr": {",", "02.01.2006 15:04:05"},
+	"sv": {",", "2006-01-02 15:04:05"},
+	"fa": {".", "2006/01/02 15:04:05"},
+	"ar": {".", "02/01/2006 15:04:05"},
+	"ja": {".", "2006/01/02 15:04:05"},
+	"zh": {".", "2006-01-02 15:04:05"},
+	"ko": {".", "2006.01.02 15:04:05"},
+}
+
+var (
+	// chatLocales is the language of each chat, from the language_code of its last message
+	chatLocales   = make(map[int64]string)
+	chatLocalesMu sync.Mutex
+)
+
+// rememberLocale records the language of whoever sent the update for its chat
+func rememberLocale(ud tgbotapi.Update) {
+	if ud.Message == nil || ud.Message.From == nil || ud.Message.From.LanguageCode == "" {
+		return
+	}
+
+	chatLocalesMu.Lock()
+	chatLocales[ud.Message.Chat.ID] = ud.Message.From.LanguageCode
+	chatLocalesMu.Unlock()
+}
+
+// chatLocale returns the locale of chat, falling back to Locale when telegram didn't say
+func chatLocale(chat int64) locale {
+	chatLocalesMu.Lock()
+	code := chatLocales[chat]
+	chatLocalesMu.Unlock()
+
+	if code == "" {
+		configMu.RLock()
+		code = Locale
+		configMu.RUnlock()
+	}
+
+	// "pt-br" is formatted like "pt"
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i > 0 {
+		code = code[:i]
+	}
+
+	if l, ok := locales[code]; ok {
+		return l
+	}
+	return locales["en"]
+}
+
+// number localizes the decimal separator of an already formatted number, e.g. a ratio
+func (l locale) number(s string) string {
+	return strings.Replace(s, ".", l.decimal, 1)
+}
+
+// float formats f with prec decimals
+func (l locale) float(f float64, prec int) string {
+	return l.number(strconv.FormatFloat(f, 'f', prec, 64))
+}
+
+// bytes formats a size or a speed, e.g. "1,5 GB"
+func (l locale) bytes(n uint64) string {
+	return l.number(humanize.Bytes(n))
+}
+
+// time formats a date with its time
+func (l locale) time(t time.Time) string {
+	return t.Format(l.date)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// move changes where a torrent's data is, "move <id> <path>" moves the data to path
+// while "setlocation <id> <path>" only points transmission to it, for data that was moved already.
+func move(ud tgbotapi.Update, cmd string, tokens []string, moveData bool) {
+	if len(tokens) < 2 {
+		send(fmt.Sprintf("*%s:* needs a torrent ID and a path", cmd), ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*%s:* %s is not a number", cmd, tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// the path can have spaces
+	path := strings.Join(tokens[1:], " ")
+	if !strings.HasPrefix(path, "/") {
+		send(fmt.Sprintf("*%s:* the path must be absolute", cmd), ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrent, err := getTorrentExtra(id, "name")
+	if err != nil {
+		sendErr(cmd, err, ud.Message.Chat.ID)
+		return
+	}
+
+	args := map[string]interface{}{
+		"ids":      []int{id},
+		"location": path,
+		"move":     moveData,
+	}
+	if err := rpcCall("torrent-set-location", args, nil); err != nil {
+		sendErr(cmd, err, ud.Message.Chat.ID)
+		return
+	}
+
+	if moveData {
+		send(fmt.Sprintf("Moving %s to %s", torrent.Name, path), ud.Message.Chat.ID, false)
+		return
+	}
+	send(fmt.Sprintf("%s is now at %s", torrent.Name, path), ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	gosort "sort"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// maxBackoff caps how long a failing background loop waits between tries
+const maxBackoff = 30 * time.Minute
+
+// loopStatus is the state of a background loop, as shown by 'diag'
+type loopStatus struct {
+	failures int
+	lastErr  error
+	lastOK   time.Time
+	next     time.Time
+}
+
+var (
+	// loops holds the status of every running background loop, name => status
+	loops   = make(map[string]*loopStatus)
+	loopsMu sync.Mutex
+)
+
+// runLoop calls fn every interval, while fn keeps failing it waits exponentially
+// longer (with some jitter) to avoid spamming the log and transmission.
+func runLoop(name string, interval func() time.Duration, fn func() error) {
+	status := &loopStatus{}
+	loopsMu.Lock()
+	loops[name] = status
+	loopsMu.Unlock()
+
+	for {
+		err := fn()
+
+		loopsMu.Lock()
+		wait := interval()
+		if err != nil {
+			status.failures++
+			status.lastErr = err
+			wait = backoff(wait, status.failures)
+			logger.Printf("[ERROR] %s: %s, retrying in %s", name, err, wait.Round(time.Second))
+		} else {
+			status.failures = 0
+			status.lastErr = nil
+			status.lastOK = time.Now()
+			markPoll()
+		}
+		status.next = time.Now().Add(wait)
+		loopsMu.Unlock()
+
+		time.Sleep(wait)
+	}
+}
+
+// backoff returns how long to wait after failures consecutive failures
+func backoff(interval time.Duration, failures int) time.Duration {
+	wait := interval
+	for i := 0; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+
+	// +/- 25% so loops that failed together don't retry together
+	jitter := time.Duration(rand.Int63n(int64(wait)/2+1)) - wait/4
+	return wait + jitter
+}
+
+// diag shows the state of the background loops, and the RPC URL in use when there are fallbacks
+func diag(ud tgbotapi.Update) {
+	loopsMu.Lock()
+	names := make([]string, 0, len(loops))
+	for name := range loops {
+		names = append(names, name)
+	}
+	gosort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		status := loops[name]
+		if status.failures == 0 {
+			lastOK := "never"
+			if !status.lastOK.IsZero() {
+				lastOK = time.Since(status.lastOK).Round(time.Second).String() + " ago"
+			}
+			buf.WriteString(fmt.Sprintf("%s: ok, last run %s\n", name, lastOK))
+			continue
+		}
+
+		buf.WriteString(fmt.Sprintf("%s: degraded, %d failures, next try in %s\n  %s\n",
+			name, status.failures, time.Until(status.next).Round(time.Second), status.lastErr))
+	}
+	loopsMu.Unlock()
+
+	if len(FallbackURLs) > 0 {
+		which := "fallback"
+		if activeEndpoint() == RPCURL {
+			which = "primary"
+		}
+		buf.WriteString(fmt.Sprintf("endpoint: %s (%s)\n", activeEndpoint(), which))
+	}
+
+	if buf.Len() == 0 {
+		send("*diag:* no background loops running", ud.Message.Chat.ID, false)
+		return
+	}
+	send(buf.String(), ud.Message.Chat.ID, false)
+}
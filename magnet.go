@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// magnet sends the magnet link of a torrent, so it can be added somewhere else
+func magnet(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*magnet:* needs a torrent ID", ud.Message.Chat.ID, false)
+		return
+	}
+
+	for _, token := range tokens {
+		id, err := strconv.Atoi(token)
+		if err != nil {
+			send(fmt.Sprintf("*magnet:* %s is not a number", token), ud.Message.Chat.ID, false)
+			continue
+		}
+
+		torrent, err := getTorrentExtra(id, "name", "hashString", "trackers")
+		if err != nil {
+			sendErr("magnet", err, ud.Message.Chat.ID)
+			continue
+		}
+
+		// as code, so it can be copied with a tap
+		send(fmt.Sprintf("%s\n`%s`", mdReplacer.Replace(torrent.Name), magnetLink(torrent)), ud.Message.Chat.ID, true)
+	}
+}
+
+// infoHashRegex matches a bare info hash, in hex or in base32
+var infoHashRegex = regexp.MustCompile(`^(?i:[0-9a-f]{40}|[a-z2-7]{32})$`)
+
+// hashMagnet turns a bare info hash into a magnet with DefaultTrackers, since many
+// indexers only give the hash. it returns false if s isn't an info hash.
+func hashMagnet(s string) (string, bool) {
+	if !infoHashRegex.MatchString(s) {
+		return "", false
+	}
+
+	// 32 characters of hex are base32 too, but 40 of them can only be hex
+	hash := strings.ToUpper(s)
+	if _, err := hex.DecodeString(s); err == nil && len(s) == 40 {
+		hash = strings.ToLower(s)
+	}
+
+	configMu.RLock()
+	trackers := DefaultTrackers
+	configMu.RUnlock()
+
+	link := "magnet:?xt=urn:btih:" + hash
+	for _, tracker := range trackers {
+		link += "&tr=" + url.QueryEscape(tracker)
+	}
+	return link, true
+}
+
+// magnetLink builds the magnet link of torrent from its hash, name and trackers
+func magnetLink(torrent *rpcTorrent) string {
+	link := "magnet:?xt=urn:btih:" + torrent.HashString + "&dn=" + url.QueryEscape(torrent.Name)
+	for _, tracker := range torrent.Announces {
+		link += "&tr=" + url.QueryEscape(tracker.Announce)
+	}
+	return link
+}
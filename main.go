@@ -6,14 +6,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
-	"unicode/utf8"
 
 	"github.com/dustin/go-humanize"
-	"github.com/pyed/tailer"
 	"github.com/pyed/transmission"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
 )
@@ -24,6 +25,10 @@ const (
 	HELP = `
 	*list* or *li* or *ls*
 	Lists all the torrents, takes an optional argument which is a query to list only torrents that has a tracker matches the query, or some of it.
+	_label:tv_ lists only the torrents labeled tv, it works with the other listings too, e.g. _downs label:tv_.
+	Filters narrow it and the other listings, count, stop, start and del down, e.g. _list status=seeding ratio>2 size>10GB tracker~private added<30d_. The keys are status, name, tracker, error, label, ratio, size, progress, down, up and added, with =, !=, >, <, >=, <= and ~ for a query.
+	Names take globs and queries, e.g. _stop name:ubuntu*_ or _del ~"S02E0[1-3]"_, del always asks to confirm what matched.
+	Listings longer than -max-messages messages shrink to one line per torrent, or ask whether to send all of them, the top 20 or a file.
 
 	*head* or *he*
 	Lists the first n number of torrents, n defaults to 5 if no argument is provided.
@@ -48,6 +53,10 @@ const (
 
 	*errors* or *er*
 	Lists torrents with with errors along with the error message.
+	When the same error repeats it shows a line per error and tracker with buttons to list their torrents, _errors all_ lists them one by one.
+	Torrents that get an error are notified with buttons to verify or remove them, unless -error-alerts=false.
+
+	The fields under the names of these listings can be set with listing\_fields in the config.
 
 	*sort* or *so*
 	Manipulate the sorting of the aforementioned commands. Call it without arguments for more.
@@ -60,19 +69,73 @@ const (
 	directory in case you provided an inexistent one.
 
 	*add* or *ad*
-	Takes one or many URLs or magnets to add them. You can send a ".torrent" file via Telegram to add it.
+	Takes one or many URLs, magnets or info hashes to add them. You can send a ".torrent" file via Telegram to add it, with options in its caption, e.g. "dir=/data/movies paused label=4k".
+	Separate mirrors of the same torrent with '|', e.g. "*add* url1 | url2", to try them in order.
+	With -confirm-size, torrents bigger than it are paused once their size is known, and start when you confirm.
+	Magnets and .torrent links in other messages, e.g. posts forwarded from channels, are found and offered with an _Add_ button.
+	Options go before the URLs: _-paused_ to not start them, _-dir /data/tv_ to download them there, and _-label tv_ to label them, e.g. "*add* -paused -dir /data/tv -label tv url".
+
+	*import*
+	Send a Telegram chat export (result.json) or a text file with _import_ as its caption to add all the magnets in it.
+	With -add-stagger, adding 3 or more at once is spread over that long and reported in a single message.
 
 	*search* or *se*
-	Takes a query and lists torrents with matching names.
+	Takes a query and lists torrents with matching names, _search more_ shows more results and _search filter <query>_ narrows them down.
+
+	*find*
+	Takes a query and searches the Torznab indexers (Jackett, Prowlarr) from the config, tap a result's button or send _find add <n>_ to add it. _find more_ and _find filter <query>_ work like with search.
 
 	*latest* or *la*
 	Lists the newest n torrents, n defaults to 5 if no argument is provided.
 
 	*info* or *in*
-	Takes one or more torrent's IDs to list more info about them.
+	Takes one or more torrent's IDs to list more info about them, start with _full_ for more details, including when each tracker was last and will next be announced to.
+
+	*move* or *mv*
+	Takes a torrent's ID and a path to move its data to, e.g. _move 42 /mnt/disk2/movies_.
+
+	*setlocation*
+	Like _move_ but without moving the data, for data that was moved already.
+
+	*rename*
+	Takes a torrent's ID and a new name for it.
+
+	*renamefile*
+	Takes a torrent's ID, the path of a file or folder inside it (or the file's number from _files_), and a new name for it.
+
+	*after*
+	Chains torrents, _after 41 start 42_ stops 42 until 41 completes, _after 41 clear_ removes the chain, _after_ alone lists them.
+
+	*magnet*
+	Takes one or more torrent's IDs and sends their magnet links.
+
+	*detail*
+	Takes one or more torrent's IDs and shows their hash, comment, creator, creation date, pieces, privacy and directory.
+
+	*streamprep*
+	Takes a torrent's ID and gets the start and the end of its largest video first so it can be previewed, then puts the priorities back. Stop it with _cancel_.
+
+	*trackerstat*
+	Takes a torrent's ID and shows the seeders and leechers each of its trackers reports, with the results of the last announce and scrape.
+
+	*swarm*
+	Lists all the torrents by their seeders and leechers, smallest swarms first, marking the ones no tracker answers for.
+
+	*peers* or *pe*
+	Takes a torrent's ID and lists the peers it's connected to, with their clients, progress, speeds and flags.
+
+	*export*
+	Takes one or more torrent's IDs and sends their .torrent files, or _all_ to get all of them in a zip.
+
+	*files* or *fi*
+	Takes a torrent's ID to list its files with buttons to skip or download them, or _files <id> want 3 5-9_ and _files <id> unwant 1_.
+
+	*webseed* or *ws*
+	Takes a torrent's ID to list its web seeds.
 
 	*stop* or *sp*
 	Takes one or more torrent's IDs to stop them, or _all_ to stop all torrents.
+	Replying _stop_ to a listing stops the torrents in it, and _stop 2_ the second one. start, check, info, files and the others that take IDs work the same, del and deldata need the numbers when there's more than one torrent.
 
 	*start* or *st*
 	Takes one or more torrent's IDs to start them, or _all_ to start all torrents.
@@ -81,14 +144,26 @@ const (
 	Takes one or more torrent's IDs to verify them, or _all_ to verify all torrents.
 
 	*del* or *rm*
-	Takes one or more torrent's IDs to delete them.
+	Takes one or more torrent's IDs to delete them, end with _after:seedtarget_ to delete them once they reach their seed ratio or idle limit.
 
 	*deldata*
-	Takes one or more torrent's IDs to delete them and their data.
+	Takes one or more torrent's IDs to delete them and their data, also takes _after:seedtarget_.
 
 	*stats* or *sa*
 	Shows Transmission's stats.
 
+	*history*
+	Lists the last n torrents that completed with when, their size and how long they took, n defaults to 10. _history 7d_ lists the ones of the last 7 days and the data transferred. The bot remembers them after they're removed from transmission.
+
+	*source*
+	Shows the URL or magnet a torrent was added from, to add it again if its data is lost. Takes its ID, or words of its name once it's removed, e.g. _source ubuntu_.
+
+	*goals*
+	Shows which completed torrents of the trackers in seed\_goals reached the ratio or seed time their tracker wants, and can be removed without a hit and run.
+
+	*report*
+	Sends a summary of what completed, the data transferred, the counts, the free space and the errors since the last report. _report daily 09:00_ or _report weekly 09:00_ (mondays) sends it to the notification chats on schedule, _report off_ stops it.
+
 	*downlimit* or *dl*
 	Set global limit for download speed in kilobytes.
 
@@ -99,14 +174,113 @@ const (
 	Shows the upload and download speeds.
 
 	*count* or *co*
-	Shows the torrents counts per status.
+	Shows the torrents counts per status, takes filters like list, e.g. _count tracker=example.org_.
+
+	*freespace* or *fs*
+	Shows the free space on the download dir, or on the given path.
+
+	*forecast*
+	Estimates when the disk will be full, from what the incomplete torrents need and the last day's download rate.
+
+	*status*
+	Sends a one line summary of the speeds and torrents, meant for groups, at most once a minute.
+
+	*heatmap* or *hm*
+	Shows how busy the line was by hour over the last days, e.g. _heatmap 7d_, up to 30 days.
+
+	*graph*
+	Sends a chart of the download and upload speed of the last hour, or e.g. _graph 24h_, up to 24h. The speeds are sampled by the watcher since the bot started.
+
+	*masters*
+	Lists the masters and their roles. New users can ask for access by sending _request_ to the bot.
+
+	*whoami*
+	Shows your user ID, username, the chat's ID, the topic's thread ID and your role, e.g. for -notify-chat. Anyone can use it.
+
+	*revoke*
+	Takes one or more usernames to revoke their access, admins only.
+
+	*label*
+	Takes torrents' IDs and a label to add to them, or manages labels: _rename <old> <new>_ renames a label on all torrents, _merge <from> <into>_ merges two labels.
+
+	*unlabel*
+	Takes torrents' IDs and a label to remove from them, or removes all their labels without one.
+
+	*labels*
+	Lists the labels and how many torrents have each.
+
+	*preset*
+	Takes a preset's name from the config file to switch to its speed limits, queue sizes and turtle mode, lists the presets without arguments.
+
+	*prune*
+	Lists the .torrent and .resume files of torrents that are gone from Transmission, _prune delete_ deletes them.
+
+	*tracker*
+	_tracker pause host_ stops the torrents announcing to a tracker, e.g. during its maintenance, _tracker resume host_ starts them again.
+
+	*retrack*
+	Moves the torrents of a tracker that changed its domain, e.g. _retrack old.org new.org_ lists them, end with _apply_ to move them.
+
+	*tlimit*
+	Sets the speed limits of a torrent, e.g. _tlimit 42 down 1MB up 200KB_, _off_ removes a limit.
+
+	*tratio*
+	Sets the seed ratio limit of a torrent, e.g. _tratio 42 2.0_, _unlimited_, or _global_ to follow the global limit.
+
+	*prealloc*
+	Shows or sets how transmission allocates the files of new torrents: _off_, _sparse_ or _full_. With _full_, adding a torrent bigger than -prealloc-warn asks whether to switch first.
+
+	*turtle*
+	Turns turtle mode (the alternative speed limits) _on_ or _off_, shows its _status_, or schedules it, e.g. _turtle schedule 09:00 17:00 mon-fri_.
+
+	*cancel*
+	Cancels the running bulk operations, like deleting or importing many torrents.
+
+	*reload*
+	Re-reads the config file, admins only.
 
 	*help*
 	Shows this help message.
 
+	*translit*
+	Turns transliteration of the torrents' names _on_ or _off_ for this chat, cyrillic becomes latin and full-width characters normal.
+
+	*botstats*
+	Shows how often each command is used, how long it takes and how often it fails, and who uses the bot, from the audit log. e.g. *botstats 7d*, admins only.
+
+	*verifyqueue*
+	Sets how many torrents _check_ lets verify at once, the rest wait for a free slot. 0 turns it off, without a number it shows the queue.
+
+	*dashboard*
+	_dashboard on_ pins a message that's kept up to date with the speeds, the counts, the most active torrents and the free space, _dashboard off_ stops it.
+
+	*alias*
+	Saves a command under a name, e.g. _alias purge "deldata status=seeding ratio>5"_, then _purge_ runs it. Lists the aliases without arguments.
+
+	*unalias*
+	Takes the names of aliases to remove them.
+
+	*live*
+	Shows how often the live messages are updated and how many times, _live 3 20_ or _live 3s 1m_ changes it until the next restart. The live messages have a button to stop them.
+
+	*diag*
+	Shows the state of the background checks, and whether they are failing.
+
+	*ping*
+	Shows the round trip time to Transmission and Telegram, and when the last background check happened.
+
+	*daemon*
+	_restart_ restarts transmission-daemon and tells when it answers again, _status_ shows its status. Needs -daemon-restart and -daemon-status, admins only.
+
+	*container*
+	_status_, _restart_ or _logs [lines]_ of transmission's docker container. Needs -docker-container and access to the docker socket, admins only.
+
 	*version* or *ver*
 	Shows version numbers.
 
+	- Tap an ID in a listing to copy it, or the /info link next to it to get its info.
+	- End listing commands with _json_ to get the results as JSON, e.g. "*head 3 json*".
+	- End listing commands with _asfile_ to get them as a text file, e.g. "*seeding asfile*". Answers longer than -max-messages messages always come as a file.
 	- Prefix commands with '/' if you want to talk to your bot in a group. 
 	- report any issues [here](https://github.com/pyed/transmission-telegram)
 	`
@@ -115,29 +289,79 @@ const (
 var (
 
 	// flags
-	BotToken     string
-	Masters      masterSlice
-	RPCURL       string
-	Username     string
-	Password     string
-	LogFile      string
-	TransLogFile string // Transmission log file
-	NoLive       bool
-
-	// transmission
-	Client *transmission.TransmissionClient
+	BotToken        string
+	Masters         masterSlice
+	RPCURL          string
+	FallbackURLs    urlSlice
+	DefaultTrackers urlSlice
+	Username        string
+	Password        string
+	LogFile         string
+	TransLogFile    string // Transmission log file
+	NoLive          bool
+	AddRetry        time.Duration
+	LiveCap         int
+	MaxMessages     int
+	AddStagger      time.Duration
+	ErrorAlerts     bool
+	IdleHints       time.Duration
+	IdleGreeting    string
+	Report          string
+	StateFile       string
+	ConfigFile      string
+	NotifyChat      int64
+	Channel         int64
+	WatchInterval   int
+	Public          bool
+	VerifyAlert     time.Duration
+	TransDir        string
+	PruneInterval   time.Duration
+	LowDisk         uint64
+	CommandTimeout  time.Duration
+	Locale          string
+	AuditLog        string
+	PreallocWarn    uint64
+	ConfirmSize     uint64
+	UploadOnlyAfter time.Duration
+	AutoAdd         bool
+	DaemonRestart   string
+	DaemonStatus    string
+	DockerSocket    string
+	DockerContainer string
+
+	// deletes need confirmation, only above these if they are set
+	ConfirmDel      bool
+	ConfirmDelSize  uint64
+	ConfirmDelCount int
+
+	// turtle mode auto toggle
+	TurtlePing      string
+	TurtlePlexURL   string
+	TurtlePlexToken string
+	TurtleInterval  int
+
+	// donor mode, cap the upload during some hours unless the line is idle
+	DonorUpload  uint64
+	DonorHours   string
+	DonorProbe   string
+	DonorLatency time.Duration
+
+	// REST API for other tools
+	APIListen string
+	APIToken  string
+
+	// transmission, read it with rpcClient, it changes with the failover and the setup
+	transmissionClient *transmission.TransmissionClient
 
 	// telegram
 	Bot     *tgbotapi.BotAPI
 	Updates <-chan tgbotapi.Update
 
-	// chatID will be used to keep track of which chat to send completion notifictions.
-	chatID int64
-
 	// logging
 	logger = log.New(os.Stdout, "", log.LstdFlags)
 
-	// interval in seconds for live updates, affects: "active", "info", "speed", "head", "tail"
+	// interval in seconds for live updates, affects: "active", "info", "speed", "head", "tail",
+	// 'live' changes it and duration, read them with liveTiming
 	interval time.Duration = 5
 	// duration controls how many intervals will happen
 	duration = 10
@@ -176,26 +400,108 @@ func (masters masterSlice) Contains(master string) bool {
 	return false
 }
 
+// byteSize lets the flag package parse human sizes, e.g. "5GB"
+type byteSize struct {
+	size *uint64
+}
+
+// String is mandatory functions for the flag package
+func (b byteSize) String() string {
+	if b.size == nil || *b.size == 0 {
+		return ""
+	}
+	return humanize.Bytes(*b.size)
+}
+
+// Set is mandatory functions for the flag package
+func (b byteSize) Set(s string) error {
+	size, err := humanize.ParseBytes(s)
+	if err != nil {
+		return err
+	}
+	*b.size = size
+	return nil
+}
+
 // init flags
 func init() {
 	// define arguments and parse them.
 	flag.StringVar(&BotToken, "token", "", "Telegram bot token, Can be passed via environment variable 'TT_BOTT'")
 	flag.Var(&Masters, "master", "Your telegram handler, So the bot will only respond to you. Can specify more than one")
-	flag.StringVar(&RPCURL, "url", "http://localhost:9091/transmission/rpc", "Transmission RPC URL")
+	flag.StringVar(&RPCURL, "url", defaultRPCURL, "Transmission RPC URL")
+	flag.Var(&FallbackURLs, "fallback-url", "Another RPC URL of the same transmission, used while -url doesn't answer. Can specify more than one")
 	flag.StringVar(&Username, "username", "", "Transmission username")
 	flag.StringVar(&Password, "password", "", "Transmission password")
 	flag.StringVar(&LogFile, "logfile", "", "Send logs to a file")
-	flag.StringVar(&TransLogFile, "transmission-logfile", "", "Open transmission logfile to monitor torrents completion")
+	flag.StringVar(&TransLogFile, "transmission-logfile", "", "Deprecated: torrents completion is watched through RPC, see -watch-interval")
+	flag.IntVar(&WatchInterval, "watch-interval", 30, "Seconds between checks for completed torrents, 0 to disable completion notifications")
 	flag.BoolVar(&NoLive, "no-live", false, "Don't edit and update info after sending")
+	flag.Var(&DefaultTrackers, "tracker", "Tracker to add to the torrents added by their info hash, can be repeated")
+	flag.BoolVar(&AutoAdd, "auto-add", false, "Add the magnets and .torrent links found in messages right away, instead of asking")
+	flag.BoolVar(&Public, "public", false, "Let anyone use the read only commands: speed, count, stats and status")
+	flag.StringVar(&ConfigFile, "config", "", "YAML config file, reloaded with the 'reload' command or SIGHUP")
+	flag.StringVar(&StateFile, "statefile", "transmission-telegram.json", "File to keep the bot's state in, e.g. approved masters")
+	flag.StringVar(&HistoryDB, "history-db", "transmission-telegram.db", "Database to keep the history of the torrents and the transfer stats in, for 'history'")
+	flag.StringVar(&TransDir, "transmission-dir", "", "Transmission's config dir, where its torrents and resume folders are, for 'prune' and 'export'")
+	flag.DurationVar(&PruneInterval, "prune-interval", 0, "Delete the orphaned .torrent and .resume files this often (e.g. 168h for weekly), needs -transmission-dir")
+	PreallocWarn = 50 * humanize.GByte
+	flag.Var(byteSize{&PreallocWarn}, "prealloc-warn", "Ask before starting torrents bigger than this while files are fully preallocated, 0 to disable")
+	flag.Var(byteSize{&ConfirmSize}, "confirm-size", "Pause the added torrents bigger than this (e.g. 20GB) and ask before starting them")
+	flag.Var(byteSize{&LowDisk}, "low-disk", "Alert when the free space on the download dir drops below this, e.g. 20GB")
+	flag.DurationVar(&CommandTimeout, "timeout", 30*time.Second, "How long transmission gets to answer a call before giving up on it, 0 to disable")
+	flag.DurationVar(&UploadOnlyAfter, "upload-only-after", 0, "Stop downloading torrents that didn't complete this long (e.g. 720h) after being added, they keep seeding")
+	flag.DurationVar(&VerifyAlert, "verify-alert", 6*time.Hour, "Alert about torrents that have been verifying for longer than this, 0 to disable")
+	flag.StringVar(&Report, "report", "", "Send a summary report to the notification chats, \"daily 09:00\" or \"weekly 09:00\" (mondays), 'report' overrides it")
+	flag.StringVar(&AuditLog, "audit-log", "", "File to log every command to, with who sent it, how long it took and whether it failed, for 'botstats'")
+	flag.StringVar(&Locale, "locale", "en", "Language to format numbers and dates in when telegram doesn't give the user's, e.g. de")
+	flag.Int64Var(&NotifyChat, "notify-chat", 0, "Chat ID to send notifications to, defaults to every chat where a master talked to the bot")
+	flag.Int64Var(&Channel, "channel", 0, "Channel ID to also post completed torrents to, the bot must be an admin there")
+	flag.IntVar(&LiveCap, "live-cap", 3, "Maximum number of live-updating messages per chat, 0 for no limit")
+	flag.IntVar(&MaxMessages, "max-messages", 3, "Switch listings longer than this many messages to one line per torrent, or ask how to send them, 0 for no limit")
+	flag.BoolVar(&ConfirmDel, "confirm-del", true, "Ask for confirmation before deleting torrents")
+	flag.BoolVar(&ErrorAlerts, "error-alerts", true, "Notify when a torrent gets an error, with buttons to verify or remove it")
+	flag.DurationVar(&IdleHints, "idle-hints", 14*24*time.Hour, "Add a hint of the commands that help to big notifications after this long without a command, 0 to disable")
+	flag.StringVar(&IdleGreeting, "idle-greeting", "👋 Haven't seen you in a while.", "The greeting before the hints of -idle-hints")
+	flag.Var(byteSize{&ConfirmDelSize}, "confirm-del-size", "Only ask for confirmation before deleting torrents bigger than this in total, e.g. 5GB")
+	flag.IntVar(&ConfirmDelCount, "confirm-del-count", 0, "Only ask for confirmation before deleting more than this many torrents at once")
+	flag.DurationVar(&AddRetry, "add-retry", 0, "Keep retrying failed adds for this long (e.g. 10m)")
+	flag.DurationVar(&AddStagger, "add-stagger", 0, "Spread batches of 3 or more adds (e.g. imports) over this long (e.g. 10m), not to hammer the trackers")
+	flag.StringVar(&TurtlePing, "turtle-ping", "", "Enable turtle mode while this host (e.g. a media player) answers pings")
+	flag.StringVar(&TurtlePlexURL, "turtle-plex", "", "Enable turtle mode while this Plex server (e.g. http://localhost:32400) is streaming")
+	flag.StringVar(&TurtlePlexToken, "turtle-plex-token", "", "Plex token to use with -turtle-plex")
+	flag.IntVar(&TurtleInterval, "turtle-interval", 60, "Seconds between the checks of -turtle-ping, -turtle-plex and -donor-probe")
+	flag.StringVar(&DaemonRestart, "daemon-restart", "", "Command that restarts transmission-daemon for 'daemon restart', e.g. 'systemctl restart transmission-daemon'")
+	flag.StringVar(&DaemonStatus, "daemon-status", "", "Command that shows the status of transmission-daemon for 'daemon status', e.g. 'systemctl status transmission-daemon'")
+	flag.StringVar(&DockerSocket, "docker-socket", "/var/run/docker.sock", "Docker's API socket, for 'container'")
+	flag.StringVar(&DockerContainer, "docker-container", "", "Name of transmission's docker container, for 'container'")
+	flag.StringVar(&APIListen, "api-listen", "", "Serve the REST API on this address, e.g. 127.0.0.1:8080, needs -api-token")
+	flag.StringVar(&APIToken, "api-token", "", "Token the REST API requires, as 'Authorization: Bearer <token>'")
+	flag.Var(byteSize{&DonorUpload}, "donor-upload", "Cap the upload at this (e.g. 500KB) during -donor-hours, unless the line is idle")
+	flag.StringVar(&DonorHours, "donor-hours", "", "When to cap the upload, e.g. 09:00-23:00, defaults to all day")
+	flag.StringVar(&DonorProbe, "donor-probe", "", "Host to ping to tell if the line is idle, e.g. your ISP's gateway")
+	flag.DurationVar(&DonorLatency, "donor-latency", 50*time.Millisecond, "The line is idle while -donor-probe answers faster than this")
 
 	// set the usage message
 	flag.Usage = func() {
-		fmt.Fprint(os.Stderr, "Usage: transmission-telegram <-token=TOKEN> <-master=@tuser> [-master=@yuser2] [-url=http://] [-username=user] [-password=pass]\n\n")
+		fmt.Fprint(os.Stderr, "Usage: transmission-telegram <-token=TOKEN> [-master=@tuser] [-master=@yuser2] [-url=http://] [-username=user] [-password=pass]\n")
+		fmt.Fprint(os.Stderr, "       transmission-telegram -config=config.yml\n\n")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
+	// make sure that the handler doesn't contain @
+	for i := range Masters {
+		Masters[i] = strings.Replace(Masters[i], "@", "", -1)
+	}
+
+	// load the config file, flags take precedence over it
+	recordFlags()
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] Config: %s\n", err)
+		os.Exit(1)
+	}
+
 	// if we don't have BotToken passed, check the environment variable "TT_BOTT"
 	if BotToken == "" {
 		if token := os.Getenv("TT_BOTT"); len(token) > 1 {
@@ -203,19 +509,14 @@ func init() {
 		}
 	}
 
-	// make sure that we have the two madatory arguments: telegram token & master's handler.
-	if BotToken == "" ||
-		len(Masters) < 1 {
-		fmt.Fprintf(os.Stderr, "Error: Mandatory argument missing! (-token or -master)\n\n")
+	// make sure that we have the madatory argument: telegram token. without a master
+	// the first user to message the bot sets it up, see setup.go
+	if BotToken == "" {
+		fmt.Fprintf(os.Stderr, "Error: Mandatory argument missing! (-token, or its config equivalent)\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// make sure that the handler doesn't contain @
-	for i := range Masters {
-		Masters[i] = strings.Replace(Masters[i], "@", "", -1)
-	}
-
 	// if we got a log file, log to it
 	if LogFile != "" {
 		logf, err := os.OpenFile(LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -225,37 +526,25 @@ func init() {
 		logger.SetOutput(logf)
 	}
 
-	// if we got a transmission log file, monitor it for torrents completion to notify upon them.
-	if TransLogFile != "" {
-		go func() {
-			ft := tailer.RunFileTailer(TransLogFile, false, nil)
-
-			// [2017-02-22 21:00:00.898] File-Name State changed from "Incomplete" to "Complete" (torrent.c:2218)
-			const (
-				substring = `"Incomplete" to "Complete"`
-				start     = len(`[2017-02-22 21:00:00.898] `)
-				end       = len(` State changed from "Incomplete" to "Complete" (torrent.c:2218)`)
-			)
-
-			for {
-				select {
-				case line := <-ft.Lines():
-					if strings.Contains(line, substring) {
-						// if we don't have a chatID continue
-						if chatID == 0 {
-							continue
-						}
-
-						msg := fmt.Sprintf("Completed: %s", line[start:len(line)-end])
-						send(msg, chatID, false)
-					}
-				case err := <-ft.Errors():
-					logger.Printf("[ERROR] tailing transmission log: %s", err)
-					return
-				}
+	if err := loadState(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] State: %s\n", err)
+		os.Exit(1)
+	}
 
-			}
-		}()
+	if err := openHistory(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] History: %s\n", err)
+		os.Exit(1)
+	}
+
+	// use what was set up through the chat, or start the setup
+	applySetup()
+	if setup.active {
+		logger.Printf("[INFO] No masters, the first user to message the bot gets to set it up")
+	}
+
+	// the completion notifications come from polling transmission now
+	if TransLogFile != "" {
+		logger.Printf("[INFO] -transmission-logfile is deprecated and ignored, completion is watched through RPC, see -watch-interval")
 	}
 
 	// if the `-username` flag isn't set, look into the environment variable 'TR_AUTH'
@@ -266,18 +555,35 @@ func init() {
 	}
 
 	// log the flags
-	logger.Printf("[INFO] Token=%s\n\t\tMasters=%s\n\t\tURL=%s\n\t\tUSER=%s\n\t\tPASS=%s",
-		BotToken, Masters, RPCURL, Username, Password)
+	logger.Printf("[INFO] Token=%s\n\t\tMasters=%s\n\t\tURL=%s\n\t\tFallbacks=%s\n\t\tUSER=%s\n\t\tPASS=%s",
+		BotToken, Masters, RPCURL, FallbackURLs.String(), Username, Password)
 }
 
 // init transmission
 func init() {
-	var err error
-	Client, err = transmission.New(RPCURL, Username, Password)
+	// with fallbacks, start on the first URL that answers
+	if len(FallbackURLs) > 0 {
+		err := connect()
+		if err == nil {
+			return
+		}
+		logger.Printf("[ERROR] Transmission: %s", err)
+	}
+
+	client, err := transmission.New(RPCURL, Username, Password)
 	if err != nil {
+		// the setup asks for the URL and connects, it's there for this
+		if setupPending() {
+			logger.Printf("[INFO] Transmission: %s, the setup will ask for the URL", err)
+			return
+		}
 		fmt.Fprintf(os.Stderr, "[ERROR] Transmission: Make sure you have the right URL, Username and Password\n")
 		os.Exit(1)
 	}
+	endpointMu.Lock()
+	endpoint = RPCURL
+	transmissionClient = client
+	endpointMu.Unlock()
 
 }
 
@@ -292,171 +598,499 @@ func init() {
 	}
 	logger.Printf("[INFO] Authorized: %s", Bot.Self.UserName)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	// asks for the reactions too, see reaction.go
+	Updates = getUpdatesChan(60)
+}
 
-	Updates, err = Bot.GetUpdatesChan(u)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[ERROR] Telegram: %s\n", err)
-		os.Exit(1)
-	}
+// servicesOnce makes sure startServices only starts them once
+var servicesOnce sync.Once
+
+// startServices starts everything that talks to transmission on its own. without a client it
+// waits for the setup to connect.
+func startServices() {
+	servicesOnce.Do(func() {
+		// if we got something to watch for streaming, toggle turtle mode based on it.
+		startTurtleAuto()
+
+		// donate the idle upload, while keeping it capped when the line is in use
+		startDonor()
+
+		// let other tools talk to the bot
+		startAPI()
+
+		// remember the torrents that were there before the bot
+		go backfillHistory()
+		startStatsHistory()
+
+		// put back the priorities streamprep changed once the videos are ready
+		resumeStreamPreps()
+
+		// watch torrents to notify upon completion
+		startWatcher()
+		startPrune()
+		startDiskWatch()
+		go watchEndpoint()
+		go watchReports()
+	})
 }
 
 func main() {
+	if rpcClient() != nil {
+		startServices()
+	}
+
+	// let the scripts know, and again when stopping
+	go runHook(eventStarted, nil)
+	go func() {
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+		<-term
+		runHook(eventStopped, nil)
+		os.Exit(0)
+	}()
+
+	// reload the config on SIGHUP
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			if err := reloadConfig(); err != nil {
+				logger.Printf("[ERROR] Reload: %s", err)
+				continue
+			}
+			logger.Printf("[INFO] Reloaded the config")
+		}
+	}()
+
 	for update := range Updates {
+		// inline keyboard buttons
+		if update.CallbackQuery != nil {
+			go callback(update.CallbackQuery)
+			continue
+		}
+
 		// ignore edited messages
 		if update.Message == nil {
 			continue
 		}
 
-		// ignore non masters
-		if !Masters.Contains(update.Message.From.UserName) {
-			logger.Printf("[INFO] Ignored a message from: %s", update.Message.From.String())
+		// format numbers and dates the way the user does
+		rememberLocale(update)
+
+		// no masters yet, the first user walks through the setup. testing the connection
+		// can take a while, the steps take turns on setup's lock meanwhile
+		if setupPending() {
+			go setupStep(update)
 			continue
 		}
 
-		// update chatID for complete notification
-		if TransLogFile != "" && chatID != update.Message.Chat.ID {
-			chatID = update.Message.Chat.ID
+		// ignore non masters, unless they are asking for access or it's a public command
+		if !isMaster(update.Message.From.UserName) {
+			if cmd := strings.ToLower(update.Message.Text); cmd == "request" || cmd == "/request" {
+				go requestAccess(update)
+				continue
+			}
+			if cmd := strings.ToLower(update.Message.Text); cmd == "whoami" || cmd == "/whoami" {
+				go whoami(update)
+				continue
+			}
+			if publicCommand(update) {
+				continue
+			}
+			logger.Printf("[INFO] Ignored a message from: %s", update.Message.From.String())
+			continue
 		}
 
+		// remember the chat for notifications
+		rememberChat(update.Message.Chat.ID, update.Message.From.UserName)
+		markCommand(update.Message.Chat.ID)
+
 		// tokenize the update
 		tokens := strings.Split(update.Message.Text, " ")
 
 		// preprocess message based on URL schema
 		// in case those were added from the mobile via "Share..." option
 		// when it is not possible to easily prepend it with "add" command
-		if strings.HasPrefix(tokens[0], "magnet") || strings.HasPrefix(tokens[0], "http") {
+		if strings.HasPrefix(tokens[0], "magnet") || strings.HasPrefix(tokens[0], "http") || infoHashRegex.MatchString(tokens[0]) {
 			tokens = append([]string{"add"}, tokens...)
 		}
 
+		// "purge" runs what was saved with "alias purge ..."
+		tokens = expandAlias(tokens)
+
 		command := strings.ToLower(tokens[0])
 
-		switch command {
-		case "list", "/list", "li", "/li", "/ls", "ls":
-			go list(update, tokens[1:])
+		// commands tapped in groups come as "/command@botname"
+		command = strings.TrimSuffix(command, "@"+strings.ToLower(Bot.Self.UserName))
+
+		// "/info_42" style links from the listings
+		if i := strings.LastIndex(command, "_"); strings.HasPrefix(command, "/") && i > 0 {
+			if _, err := strconv.Atoi(command[i+1:]); err == nil {
+				tokens = append([]string{command[:i], command[i+1:]}, tokens[1:]...)
+				command = command[:i]
+			}
+		}
+
+		// accept IDs the way they're shown, e.g. "stop <42>"
+		for i := range tokens[1:] {
+			tokens[i+1] = strings.TrimSuffix(strings.TrimPrefix(tokens[i+1], "<"), ">")
+		}
+
+		// "stop" or "del 2" in reply to a listing acts on its torrents
+		replied, err := replyTargets(update, command, tokens)
+		if err != nil {
+			go send(fmt.Sprintf("*%s:* %s", strings.TrimPrefix(command, "/"), err), update.Message.Chat.ID, false)
+			continue
+		}
+		tokens = replied
+
+		// a trailing "json" asks for the results as JSON, e.g. "list json"
+		if len(tokens) > 1 && strings.ToLower(tokens[len(tokens)-1]) == "json" && jsonCommands[strings.TrimPrefix(command, "/")] {
+			go jsonOutput(update, command, tokens[1:len(tokens)-1])
+			continue
+		}
+
+		// a trailing "asfile" sends the listing as a text file, e.g. "list asfile"
+		var asFile bool
+		if len(tokens) > 1 && strings.ToLower(tokens[len(tokens)-1]) == "asfile" && listingCommands[strings.TrimPrefix(command, "/")] {
+			tokens = tokens[:len(tokens)-1]
+			asFile = true
+		}
 
-		case "head", "/head", "he", "/he":
-			go head(update, tokens[1:])
+		// run the command, and record how it went in the audit log
+		update := update // the loop reuses it
+		go runCommand(update, strings.TrimPrefix(command, "/"), func() {
+			switch command {
+			case "list", "/list", "li", "/li", "/ls", "ls":
+				list(update, tokens[1:], asFile)
 
-		case "tail", "/tail", "ta", "/ta":
-			go tail(update, tokens[1:])
+			case "head", "/head", "he", "/he":
+				head(update, tokens[1:])
 
-		case "downs", "/downs", "dg", "/dg":
-			go downs(update)
+			case "tail", "/tail", "ta", "/ta":
+				tail(update, tokens[1:])
 
-		case "seeding", "/seeding", "sd", "/sd":
-			go seeding(update)
+			case "downs", "/downs", "dg", "/dg":
+				downs(update, tokens[1:], asFile)
 
-		case "paused", "/paused", "pa", "/pa":
-			go paused(update)
+			case "seeding", "/seeding", "sd", "/sd":
+				seeding(update, tokens[1:], asFile)
 
-		case "checking", "/checking", "ch", "/ch":
-			go checking(update)
+			case "paused", "/paused", "pa", "/pa":
+				paused(update, tokens[1:], asFile)
 
-		case "active", "/active", "ac", "/ac":
-			go active(update)
+			case "checking", "/checking", "ch", "/ch":
+				checking(update, tokens[1:], asFile)
 
-		case "errors", "/errors", "er", "/er":
-			go errors(update)
+			case "active", "/active", "ac", "/ac":
+				active(update, tokens[1:])
 
-		case "sort", "/sort", "so", "/so":
-			go sort(update, tokens[1:])
+			case "errors", "/errors", "er", "/er":
+				errors(update, tokens[1:], asFile)
 
-		case "trackers", "/trackers", "tr", "/tr":
-			go trackers(update)
+			case "sort", "/sort", "so", "/so":
+				sort(update, tokens[1:])
 
-		case "downloaddir", "dd":
-			go downloaddir(update, tokens[1:])
+			case "trackers", "/trackers", "tr", "/tr":
+				trackers(update)
 
-		case "add", "/add", "ad", "/ad":
-			go add(update, tokens[1:])
+			case "downloaddir", "dd":
+				downloaddir(update, tokens[1:])
 
-		case "search", "/search", "se", "/se":
-			go search(update, tokens[1:])
+			case "add", "/add", "ad", "/ad":
+				add(update, tokens[1:])
 
-		case "latest", "/latest", "la", "/la":
-			go latest(update, tokens[1:])
+			case "import", "/import":
+				send("*import:* send a chat export (result.json) or a text file with _import_ as its caption", update.Message.Chat.ID, true)
 
-		case "info", "/info", "in", "/in":
-			go info(update, tokens[1:])
+			case "find", "/find":
+				find(update, tokens[1:])
 
-		case "stop", "/stop", "sp", "/sp":
-			go stop(update, tokens[1:])
+			case "search", "/search", "se", "/se":
+				search(update, tokens[1:])
 
-		case "start", "/start", "st", "/st":
-			go start(update, tokens[1:])
+			case "latest", "/latest", "la", "/la":
+				latest(update, tokens[1:], asFile)
 
-		case "check", "/check", "ck", "/ck":
-			go check(update, tokens[1:])
+			case "info", "/info", "in", "/in":
+				info(update, tokens[1:])
 
-		case "stats", "/stats", "sa", "/sa":
-			go stats(update)
+			case "move", "/move", "mv", "/mv":
+				move(update, "move", tokens[1:], true)
 
-		case "downlimit", "dl":
-			go downlimit(update, tokens[1:])
+			case "setlocation", "/setlocation":
+				move(update, "setlocation", tokens[1:], false)
 
-		case "uplimit", "ul":
-			go uplimit(update, tokens[1:])
+			case "heatmap", "/heatmap", "hm", "/hm":
+				heatmap(update, tokens[1:])
 
-		case "speed", "/speed", "ss", "/ss":
-			go speed(update)
+			case "rename", "/rename":
+				rename(update, tokens[1:])
 
-		case "count", "/count", "co", "/co":
-			go count(update)
+			case "renamefile", "/renamefile":
+				renamefile(update, tokens[1:])
 
-		case "del", "/del", "rm", "/rm":
-			go del(update, tokens[1:])
+			case "after", "/after":
+				after(update, tokens[1:])
 
-		case "deldata", "/deldata":
-			go deldata(update, tokens[1:])
+			case "streamprep", "/streamprep":
+				streamprep(update, tokens[1:])
 
-		case "help", "/help":
-			go send(HELP, update.Message.Chat.ID, true)
+			case "trackerstat", "/trackerstat":
+				trackerstat(update, tokens[1:])
 
-		case "version", "/version", "ver", "/ver":
-			go getVersion(update)
+			case "swarm", "/swarm":
+				swarm(update, tokens[1:])
 
-		case "":
-			// might be a file received
-			go receiveTorrent(update)
+			case "peers", "/peers", "pe", "/pe":
+				peers(update, tokens[1:])
 
-		default:
-			// no such command, try help
-			go send("No such command, try /help", update.Message.Chat.ID, false)
+			case "translit", "/translit":
+				translit(update, tokens[1:])
 
-		}
+			case "export", "/export":
+				export(update, tokens[1:])
+
+			case "detail", "/detail":
+				detail(update, tokens[1:])
+
+			case "magnet", "/magnet":
+				magnet(update, tokens[1:])
+
+			case "files", "/files", "fi", "/fi":
+				files(update, tokens[1:])
+
+			case "webseed", "/webseed", "ws", "/ws":
+				webseed(update, tokens[1:])
+
+			case "stop", "/stop", "sp", "/sp":
+				stop(update, tokens[1:])
+
+			case "start", "/start", "st", "/st":
+				start(update, tokens[1:])
+
+			case "check", "/check", "ck", "/ck":
+				check(update, tokens[1:])
+
+			case "stats", "/stats", "sa", "/sa":
+				stats(update)
+
+			case "report", "/report":
+				report(update, tokens[1:])
+
+			case "goals", "/goals":
+				goals(update)
+
+			case "history", "/history":
+				history(update, tokens[1:])
+
+			case "source", "/source":
+				source(update, tokens[1:])
+
+			case "graph", "/graph":
+				graph(update, tokens[1:])
+
+			case "downlimit", "dl":
+				downlimit(update, tokens[1:])
+
+			case "uplimit", "ul":
+				uplimit(update, tokens[1:])
+
+			case "speed", "/speed", "ss", "/ss":
+				speed(update)
+
+			case "count", "/count", "co", "/co":
+				count(update, tokens[1:])
+
+			case "status", "/status":
+				status(update)
+
+			case "del", "/del", "rm", "/rm":
+				del(update, tokens[1:])
+
+			case "deldata", "/deldata":
+				deldata(update, tokens[1:])
+
+			case "masters", "/masters":
+				masters(update)
+
+			case "whoami", "/whoami":
+				whoami(update)
+
+			case "revoke", "/revoke":
+				revoke(update, tokens[1:])
+
+			case "label", "/label":
+				label(update, tokens[1:])
+
+			case "unlabel", "/unlabel":
+				unlabel(update, tokens[1:])
+
+			case "labels", "/labels":
+				labels(update)
+
+			case "forecast", "/forecast":
+				forecast(update)
+
+			case "freespace", "/freespace", "fs", "/fs":
+				freespace(update, tokens[1:])
+
+			case "tracker", "/tracker":
+				tracker(update, tokens[1:])
+
+			case "retrack", "/retrack":
+				retrack(update, tokens[1:])
+
+			case "tlimit", "/tlimit":
+				tlimit(update, tokens[1:])
+
+			case "tratio", "/tratio":
+				tratio(update, tokens[1:])
+
+			case "prealloc", "/prealloc":
+				prealloc(update, tokens[1:])
+
+			case "turtle", "/turtle":
+				turtle(update, tokens[1:])
+
+			case "cancel", "/cancel":
+				cancelOps(update)
+
+			case "prune", "/prune":
+				prune(update, tokens[1:])
+
+			case "preset", "/preset":
+				applyPreset(update, tokens[1:])
+
+			case "reload", "/reload":
+				reload(update)
+
+			case "help", "/help":
+				send(HELP, update.Message.Chat.ID, true)
+
+			case "botstats", "/botstats":
+				botstats(update, tokens[1:])
+
+			case "verifyqueue", "/verifyqueue":
+				verifyqueue(update, tokens[1:])
+
+			case "dashboard", "/dashboard":
+				dashboard(update, tokens[1:])
+
+			case "alias", "/alias":
+				alias(update, tokens[1:])
+
+			case "unalias", "/unalias":
+				unalias(update, tokens[1:])
+
+			case "live", "/live":
+				live(update, tokens[1:])
+
+			case "diag", "/diag":
+				diag(update)
+
+			case "ping", "/ping":
+				ping(update)
+
+			case "daemon", "/daemon":
+				daemon(update, tokens[1:])
+
+			case "container", "/container":
+				container(update, tokens[1:])
+
+			case "version", "/version", "ver", "/ver":
+				getVersion(update)
+
+			case "":
+				// might be a file received
+				receiveTorrent(update)
+
+			default:
+				// a post with magnets or .torrent links in it, e.g. forwarded from a channel
+				if links := detectLinks(update.Message); len(links) > 0 {
+					offerLinks(update, links)
+					return
+				}
+
+				// no such command, try help
+				send("No such command, try /help", update.Message.Chat.ID, false)
+
+			}
+		})
+	}
+}
+
+// callback routes the inline keyboard buttons based on the prefix of their data
+func callback(cq *tgbotapi.CallbackQuery) {
+	args := strings.Split(cq.Data, ":")
+
+	switch args[0] {
+	case "access":
+		accessCallback(cq, args[1:])
+	case "del":
+		deleteCallback(cq, args[1:])
+	case "files":
+		filesCallback(cq, args[1:])
+	case "prealloc":
+		preallocCallback(cq, args[1:])
+	case "links":
+		linksCallback(cq, args[1:])
+	case "size":
+		sizeCallback(cq, args[1:])
+	case "find":
+		findCallback(cq, args[1:])
+	case "listing":
+		listingCallback(cq, args[1:])
+	case "errored":
+		erroredCallback(cq, args[1:])
+	case "errdigest":
+		errorDigestCallback(cq, args[1:])
+	case "live":
+		liveCallback(cq, args[1:])
+	default:
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Unknown button"))
 	}
 }
 
 // list will form and send a list of all the torrents
 // takes an optional argument which is a query to match against trackers
 // to list only torrents that has a tracker that matchs.
-func list(ud tgbotapi.Update, tokens []string) {
-	torrents, err := Client.GetTorrents()
+func list(ud tgbotapi.Update, tokens []string, asFile bool) {
+	extra := filterFields(tokens)
+	if len(tokens) > 0 {
+		extra = append(extra, "trackers")
+	}
+	torrents, err := getTorrents(listingFields("list", extra...)...)
+	if err != nil {
+		sendErr("list", err, ud.Message.Chat.ID)
+		return
+	}
+
+	// "label:tv" narrows the list down to the torrents labeled tv
+	filter, tokens, err := queryFilter(anyTorrent, tokens)
 	if err != nil {
-		send("*list:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("list", err, ud.Message.Chat.ID)
 		return
 	}
+	torrents = filterTorrents(torrents, filter)
 
 	buf := new(bytes.Buffer)
 	// if it gets a query, it will list torrents that has trackers that match the query
 	if len(tokens) != 0 {
-		// (?i) for case insensitivity
-		regx, err := regexp.Compile("(?i)" + tokens[0])
+		regx, err := compileQuery(tokens[0])
 		if err != nil {
-			send("*list:* "+err.Error(), ud.Message.Chat.ID, false)
+			sendErr("list", err, ud.Message.Chat.ID)
 			return
 		}
 
 		for i := range torrents {
 			if regx.MatchString(torrents[i].GetTrackers()) {
-				buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+				buf.WriteString(listingLine(ud.Message.Chat.ID, "list", torrents[i]))
 			}
 		}
 	} else { // if we did not get a query, list all torrents
 		for i := range torrents {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+			buf.WriteString(listingLine(ud.Message.Chat.ID, "list", torrents[i]))
 		}
 	}
 
@@ -470,11 +1104,13 @@ func list(ud tgbotapi.Update, tokens []string) {
 		return
 	}
 
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 }
 
 // head will list the first 5 or n torrents
 func head(ud tgbotapi.Update, tokens []string) {
+	loc := chatLocale(ud.Message.Chat.ID)
+
 	var (
 		n   = 5 // default to 5
 		err error
@@ -488,74 +1124,49 @@ func head(ud tgbotapi.Update, tokens []string) {
 		}
 	}
 
-	torrents, err := Client.GetTorrents()
-	if err != nil {
-		send("*head:* "+err.Error(), ud.Message.Chat.ID, false)
-		return
-	}
+	chat := ud.Message.Chat.ID
+	render := func(torrents transmission.Torrents) string {
+		// make sure that we stay in the boundaries
+		n := n
+		if n <= 0 || n > len(torrents) {
+			n = len(torrents)
+		}
 
-	// make sure that we stay in the boundaries
-	if n <= 0 || n > len(torrents) {
-		n = len(torrents)
+		buf := new(bytes.Buffer)
+		for _, torrent := range torrents[:n] {
+			buf.WriteString(liveLine(chat, loc, torrent))
+		}
+		return buf.String()
 	}
 
-	buf := new(bytes.Buffer)
-	for i := range torrents[:n] {
-		torrentName := mdReplacer.Replace(torrents[i].Name) // escape markdown
-		buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
-			torrents[i].ID, torrentName, torrents[i].TorrentStatus(), humanize.Bytes(torrents[i].Have()),
-			humanize.Bytes(torrents[i].SizeWhenDone), torrents[i].PercentDone*100, humanize.Bytes(torrents[i].RateDownload),
-			humanize.Bytes(torrents[i].RateUpload), torrents[i].Ratio()))
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr("head", err, chat)
+		return
 	}
 
-	if buf.Len() == 0 {
-		send("*head:* no torrents", ud.Message.Chat.ID, false)
+	text := render(torrents)
+	if text == "" {
+		send("*head:* no torrents", chat, false)
 		return
 	}
 
-	msgID := send(buf.String(), ud.Message.Chat.ID, true)
+	msgID := send(text, chat, true)
 
 	if NoLive {
 		return
 	}
 
 	// keep the info live
-	for i := 0; i < duration; i++ {
-		time.Sleep(time.Second * interval)
-		buf.Reset()
-
-		torrents, err = Client.GetTorrents()
-		if err != nil {
-			continue // try again if some error heppened
-		}
-
-		if len(torrents) < 1 {
-			continue
-		}
-
-		// make sure that we stay in the boundaries
-		if n <= 0 || n > len(torrents) {
-			n = len(torrents)
-		}
-
-		for _, torrent := range torrents[:n] {
-			torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
-				torrent.ID, torrentName, torrent.TorrentStatus(), humanize.Bytes(torrent.Have()),
-				humanize.Bytes(torrent.SizeWhenDone), torrent.PercentDone*100, humanize.Bytes(torrent.RateDownload),
-				humanize.Bytes(torrent.RateUpload), torrent.Ratio()))
-		}
-
-		// no need to check if it is empty, as if the buffer is empty telegram won't change the message
-		editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, buf.String())
-		editConf.ParseMode = tgbotapi.ModeMarkdown
-		Bot.Send(editConf)
+	if err := startLive(chat, msgID, true, render, nil); err != nil {
+		sendErr("head", err, chat)
 	}
-
 }
 
 // tail lists the last 5 or n torrents
 func tail(ud tgbotapi.Update, tokens []string) {
+	loc := chatLocale(ud.Message.Chat.ID)
+
 	var (
 		n   = 5 // default to 5
 		err error
@@ -569,86 +1180,63 @@ func tail(ud tgbotapi.Update, tokens []string) {
 		}
 	}
 
-	torrents, err := Client.GetTorrents()
-	if err != nil {
-		send("*tail:* "+err.Error(), ud.Message.Chat.ID, false)
-		return
-	}
+	chat := ud.Message.Chat.ID
+	render := func(torrents transmission.Torrents) string {
+		// make sure that we stay in the boundaries
+		n := n
+		if n <= 0 || n > len(torrents) {
+			n = len(torrents)
+		}
 
-	// make sure that we stay in the boundaries
-	if n <= 0 || n > len(torrents) {
-		n = len(torrents)
+		buf := new(bytes.Buffer)
+		for _, torrent := range torrents[len(torrents)-n:] {
+			buf.WriteString(liveLine(chat, loc, torrent))
+		}
+		return buf.String()
 	}
 
-	buf := new(bytes.Buffer)
-	for _, torrent := range torrents[len(torrents)-n:] {
-		torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-		buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
-			torrent.ID, torrentName, torrent.TorrentStatus(), humanize.Bytes(torrent.Have()),
-			humanize.Bytes(torrent.SizeWhenDone), torrent.PercentDone*100, humanize.Bytes(torrent.RateDownload),
-			humanize.Bytes(torrent.RateUpload), torrent.Ratio()))
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr("tail", err, chat)
+		return
 	}
 
-	if buf.Len() == 0 {
-		send("*tail:* no torrents", ud.Message.Chat.ID, false)
+	text := render(torrents)
+	if text == "" {
+		send("*tail:* no torrents", chat, false)
 		return
 	}
 
-	msgID := send(buf.String(), ud.Message.Chat.ID, true)
+	msgID := send(text, chat, true)
 
 	if NoLive {
 		return
 	}
 
 	// keep the info live
-	for i := 0; i < duration; i++ {
-		time.Sleep(time.Second * interval)
-		buf.Reset()
-
-		torrents, err = Client.GetTorrents()
-		if err != nil {
-			continue // try again if some error heppened
-		}
-
-		if len(torrents) < 1 {
-			continue
-		}
-
-		// make sure that we stay in the boundaries
-		if n <= 0 || n > len(torrents) {
-			n = len(torrents)
-		}
-
-		for _, torrent := range torrents[len(torrents)-n:] {
-			torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
-				torrent.ID, torrentName, torrent.TorrentStatus(), humanize.Bytes(torrent.Have()),
-				humanize.Bytes(torrent.SizeWhenDone), torrent.PercentDone*100, humanize.Bytes(torrent.RateDownload),
-				humanize.Bytes(torrent.RateUpload), torrent.Ratio()))
-		}
-
-		// no need to check if it is empty, as if the buffer is empty telegram won't change the message
-		editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, buf.String())
-		editConf.ParseMode = tgbotapi.ModeMarkdown
-		Bot.Send(editConf)
+	if err := startLive(chat, msgID, true, render, nil); err != nil {
+		sendErr("tail", err, chat)
 	}
-
 }
 
 // downs will send the names of torrents with status 'Downloading' or in queue to
-func downs(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func downs(ud tgbotapi.Update, tokens []string, asFile bool) {
+	filter, _, err := queryFilter(isDownloading, tokens)
+	if err != nil {
+		sendErr("downs", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(listingFields("downs", filterFields(tokens)...)...)
 	if err != nil {
-		send("*downs:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("downs", err, ud.Message.Chat.ID)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		// Downloading or in queue to download
-		if torrents[i].Status == transmission.StatusDownloading ||
-			torrents[i].Status == transmission.StatusDownloadPending {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+		if filter(torrents[i]) {
+			buf.WriteString(listingLine(ud.Message.Chat.ID, "downs", torrents[i]))
 		}
 	}
 
@@ -656,22 +1244,27 @@ func downs(ud tgbotapi.Update) {
 		send("No downloads", ud.Message.Chat.ID, false)
 		return
 	}
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 }
 
 // seeding will send the names of the torrents with the status 'Seeding' or in the queue to
-func seeding(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func seeding(ud tgbotapi.Update, tokens []string, asFile bool) {
+	filter, _, err := queryFilter(isSeeding, tokens)
 	if err != nil {
-		send("*seeding:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("seeding", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(listingFields("seeding", filterFields(tokens)...)...)
+	if err != nil {
+		sendErr("seeding", err, ud.Message.Chat.ID)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].Status == transmission.StatusSeeding ||
-			torrents[i].Status == transmission.StatusSeedPending {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+		if filter(torrents[i]) {
+			buf.WriteString(listingLine(ud.Message.Chat.ID, "seeding", torrents[i]))
 		}
 	}
 
@@ -680,25 +1273,37 @@ func seeding(ud tgbotapi.Update) {
 		return
 	}
 
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 
 }
 
 // paused will send the names of the torrents with status 'Paused'
-func paused(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func paused(ud tgbotapi.Update, tokens []string, asFile bool) {
+	loc := chatLocale(ud.Message.Chat.ID)
+
+	filter, _, err := queryFilter(isPaused, tokens)
+	if err != nil {
+		sendErr("paused", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(statsFields...)
 	if err != nil {
-		send("*paused:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("paused", err, ud.Message.Chat.ID)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].Status == transmission.StatusStopped {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n%s (%.1f%%) DL: %s UL: %s  R: %s\n\n",
-				torrents[i].ID, torrents[i].Name, torrents[i].TorrentStatus(),
-				torrents[i].PercentDone*100, humanize.Bytes(torrents[i].DownloadedEver),
-				humanize.Bytes(torrents[i].UploadedEver), torrents[i].Ratio()))
+		if filter(torrents[i]) {
+			if line := customLine(ud.Message.Chat.ID, "paused", torrents[i]); line != "" {
+				buf.WriteString(line)
+				continue
+			}
+			buf.WriteString(fmt.Sprintf("%s%s (%s%%) DL: %s UL: %s  R: %s\n\n",
+				torrentLine(ud.Message.Chat.ID, torrents[i].ID, torrents[i].Name), torrents[i].TorrentStatus(),
+				loc.float(torrents[i].PercentDone*100, 1), loc.bytes(torrents[i].DownloadedEver),
+				loc.bytes(torrents[i].UploadedEver), loc.number(torrents[i].Ratio())))
 		}
 	}
 
@@ -707,24 +1312,35 @@ func paused(ud tgbotapi.Update) {
 		return
 	}
 
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 }
 
 // checking will send the names of torrents with the status 'verifying' or in the queue to
-func checking(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func checking(ud tgbotapi.Update, tokens []string, asFile bool) {
+	loc := chatLocale(ud.Message.Chat.ID)
+
+	filter, _, err := queryFilter(isChecking, tokens)
 	if err != nil {
-		send("*checking:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("checking", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr("checking", err, ud.Message.Chat.ID)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].Status == transmission.StatusChecking ||
-			torrents[i].Status == transmission.StatusCheckPending {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n%s (%.1f%%)\n\n",
-				torrents[i].ID, torrents[i].Name, torrents[i].TorrentStatus(),
-				torrents[i].PercentDone*100))
+		if filter(torrents[i]) {
+			if line := customLine(ud.Message.Chat.ID, "checking", torrents[i]); line != "" {
+				buf.WriteString(line)
+				continue
+			}
+			buf.WriteString(fmt.Sprintf("%s%s (%s%%)\n\n",
+				torrentLine(ud.Message.Chat.ID, torrents[i].ID, torrents[i].Name), torrents[i].TorrentStatus(),
+				loc.float(torrents[i].PercentDone*100, 1)))
 
 		}
 	}
@@ -734,111 +1350,109 @@ func checking(ud tgbotapi.Update) {
 		return
 	}
 
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 }
 
 // active will send torrents that are actively downloading or uploading
-func active(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func active(ud tgbotapi.Update, tokens []string) {
+	loc := chatLocale(ud.Message.Chat.ID)
+
+	filter, _, err := queryFilter(isActive, tokens)
 	if err != nil {
-		send("*active:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("active", err, ud.Message.Chat.ID)
 		return
 	}
 
-	buf := new(bytes.Buffer)
-	for i := range torrents {
-		if torrents[i].RateDownload > 0 ||
-			torrents[i].RateUpload > 0 {
-			// escape markdown
-			torrentName := mdReplacer.Replace(torrents[i].Name)
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
-				torrents[i].ID, torrentName, torrents[i].TorrentStatus(), humanize.Bytes(torrents[i].Have()),
-				humanize.Bytes(torrents[i].SizeWhenDone), torrents[i].PercentDone*100, humanize.Bytes(torrents[i].RateDownload),
-				humanize.Bytes(torrents[i].RateUpload), torrents[i].Ratio()))
+	chat := ud.Message.Chat.ID
+	render := func(torrents transmission.Torrents) string {
+		buf := new(bytes.Buffer)
+		for _, torrent := range torrents {
+			if filter(torrent) {
+				buf.WriteString(liveLine(chat, loc, torrent))
+			}
 		}
+		return buf.String()
 	}
-	if buf.Len() == 0 {
-		send("No active torrents", ud.Message.Chat.ID, false)
+
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr("active", err, chat)
 		return
 	}
 
-	msgID := send(buf.String(), ud.Message.Chat.ID, true)
-
-	if NoLive {
+	text := render(torrents)
+	if text == "" {
+		send("No active torrents", chat, false)
 		return
 	}
 
-	// keep the active list live for 'duration * interval'
-	for i := 0; i < duration; i++ {
-		time.Sleep(time.Second * interval)
-		// reset the buffer to reuse it
-		buf.Reset()
-
-		// update torrents
-		torrents, err = Client.GetTorrents()
-		if err != nil {
-			continue // if there was error getting torrents, skip to the next iteration
-		}
-
-		// do the same loop again
-		for i := range torrents {
-			if torrents[i].RateDownload > 0 ||
-				torrents[i].RateUpload > 0 {
-				torrentName := mdReplacer.Replace(torrents[i].Name) // replace markdown chars
-				buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\n\n",
-					torrents[i].ID, torrentName, torrents[i].TorrentStatus(), humanize.Bytes(torrents[i].Have()),
-					humanize.Bytes(torrents[i].SizeWhenDone), torrents[i].PercentDone*100, humanize.Bytes(torrents[i].RateDownload),
-					humanize.Bytes(torrents[i].RateUpload), torrents[i].Ratio()))
-			}
-		}
+	msgID := send(text, chat, true)
 
-		// no need to check if it is empty, as if the buffer is empty telegram won't change the message
-		editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, buf.String())
-		editConf.ParseMode = tgbotapi.ModeMarkdown
-		Bot.Send(editConf)
+	if NoLive {
+		return
 	}
-	// sleep one more time before putting the dashes
-	time.Sleep(time.Second * interval)
 
 	// replace the speed with dashes to indicate that we are done being live
-	buf.Reset()
-	for i := range torrents {
-		if torrents[i].RateDownload > 0 ||
-			torrents[i].RateUpload > 0 {
-			// escape markdown
-			torrentName := mdReplacer.Replace(torrents[i].Name)
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *-*  ↑ *-* R: *%s*\n\n",
-				torrents[i].ID, torrentName, torrents[i].TorrentStatus(), humanize.Bytes(torrents[i].Have()),
-				humanize.Bytes(torrents[i].SizeWhenDone), torrents[i].PercentDone*100, torrents[i].Ratio()))
+	final := func(torrents transmission.Torrents) string {
+		buf := new(bytes.Buffer)
+		for _, torrent := range torrents {
+			if filter(torrent) {
+				torrentName := mdReplacer.Replace(displayName(chat, torrent.Name)) // escape markdown
+				buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%s%%*) ↓ *-*  ↑ *-* R: *%s*\n\n",
+					torrent.ID, torrentName, torrent.TorrentStatus(), loc.bytes(torrent.Have()),
+					loc.bytes(torrent.SizeWhenDone), loc.float(torrent.PercentDone*100, 1), loc.number(torrent.Ratio())))
+			}
 		}
+		return buf.String()
 	}
 
-	editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, buf.String())
-	editConf.ParseMode = tgbotapi.ModeMarkdown
-	Bot.Send(editConf)
-
+	// keep the active list live for 'duration * interval'
+	if err := startLive(chat, msgID, true, render, final); err != nil {
+		sendErr("active", err, chat)
+	}
 }
 
 // errors will send torrents with errors
-func errors(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func errors(ud tgbotapi.Update, tokens []string, asFile bool) {
+	filter, rest, err := queryFilter(hasError, tokens)
 	if err != nil {
-		send("*errors:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("errors", err, ud.Message.Chat.ID)
 		return
 	}
 
+	torrents, err := getTorrents(listingFields("errors", append(filterFields(tokens), "trackers")...)...)
+	if err != nil {
+		sendErr("errors", err, ud.Message.Chat.ID)
+		return
+	}
+
+	// the same error on many torrents gets a line for all of them, unless "errors all"
+	if len(rest) == 0 || strings.ToLower(rest[0]) != "all" {
+		groups := groupErrors(filterTorrents(torrents, filter))
+		for _, g := range groups {
+			if len(g.ids) > 1 {
+				sendErrorDigest(ud.Message.Chat.ID, groups)
+				return
+			}
+		}
+	}
+
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].Error != 0 {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n%s\n",
-				torrents[i].ID, torrents[i].Name, torrents[i].ErrorString))
+		if filter(torrents[i]) {
+			if line := customLine(ud.Message.Chat.ID, "errors", torrents[i]); line != "" {
+				buf.WriteString(line)
+				continue
+			}
+			buf.WriteString(fmt.Sprintf("%s%s\n",
+				torrentLine(ud.Message.Chat.ID, torrents[i].ID, torrents[i].Name), mdReplacer.Replace(torrents[i].ErrorString)))
 		}
 	}
 	if buf.Len() == 0 {
 		send("No errors", ud.Message.Chat.ID, false)
 		return
 	}
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 }
 
 // sort changes torrents sorting
@@ -860,64 +1474,64 @@ func sort(ud tgbotapi.Update, tokens []string) {
 	switch strings.ToLower(tokens[0]) {
 	case "id":
 		if reversed {
-			Client.SetSort(transmission.SortRevID)
+			setSort(transmission.SortRevID)
 			break
 		}
-		Client.SetSort(transmission.SortID)
+		setSort(transmission.SortID)
 	case "name":
 		if reversed {
-			Client.SetSort(transmission.SortRevName)
+			setSort(transmission.SortRevName)
 			break
 		}
-		Client.SetSort(transmission.SortName)
+		setSort(transmission.SortName)
 	case "age":
 		if reversed {
-			Client.SetSort(transmission.SortRevAge)
+			setSort(transmission.SortRevAge)
 			break
 		}
-		Client.SetSort(transmission.SortAge)
+		setSort(transmission.SortAge)
 	case "size":
 		if reversed {
-			Client.SetSort(transmission.SortRevSize)
+			setSort(transmission.SortRevSize)
 			break
 		}
-		Client.SetSort(transmission.SortSize)
+		setSort(transmission.SortSize)
 	case "progress":
 		if reversed {
-			Client.SetSort(transmission.SortRevProgress)
+			setSort(transmission.SortRevProgress)
 			break
 		}
-		Client.SetSort(transmission.SortProgress)
+		setSort(transmission.SortProgress)
 	case "downspeed":
 		if reversed {
-			Client.SetSort(transmission.SortRevDownSpeed)
+			setSort(transmission.SortRevDownSpeed)
 			break
 		}
-		Client.SetSort(transmission.SortDownSpeed)
+		setSort(transmission.SortDownSpeed)
 	case "upspeed":
 		if reversed {
-			Client.SetSort(transmission.SortRevUpSpeed)
+			setSort(transmission.SortRevUpSpeed)
 			break
 		}
-		Client.SetSort(transmission.SortUpSpeed)
+		setSort(transmission.SortUpSpeed)
 	case "download":
 		if reversed {
-			Client.SetSort(transmission.SortRevDownloaded)
+			setSort(transmission.SortRevDownloaded)
 			break
 		}
-		Client.SetSort(transmission.SortDownloaded)
+		setSort(transmission.SortDownloaded)
 	case "upload":
 		if reversed {
-			Client.SetSort(transmission.SortRevUploaded)
+			setSort(transmission.SortRevUploaded)
 			break
 		}
-		Client.SetSort(transmission.SortUploaded)
+		setSort(transmission.SortUploaded)
 	case "ratio":
 		if reversed {
-			Client.SetSort(transmission.SortRevRatio)
+			setSort(transmission.SortRevRatio)
 			break
 		}
-		Client.SetSort(transmission.SortRatio)
+		setSort(transmission.SortRatio)
 	default:
 		send("unkown sorting method", ud.Message.Chat.ID, false)
 		return
@@ -934,9 +1548,9 @@ var trackerRegex = regexp.MustCompile(`[https?|udp]://([^:/]*)`)
 
 // trackers will send a list of trackers and how many torrents each one has
 func trackers(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+	torrents, err := getTorrents("id", "trackers")
 	if err != nil {
-		send("*trackers:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("trackers", err, ud.Message.Chat.ID)
 		return
 	}
 
@@ -981,9 +1595,9 @@ func downloaddir(ud tgbotapi.Update, tokens []string) {
 	cmd := transmission.NewSessionSetCommand()
 	cmd.SetDownloadDir(downloadDir)
 
-	out, err := Client.ExecuteCommand(cmd)
+	out, err := rpcClient().ExecuteCommand(cmd)
 	if err != nil {
-		send("*downloaddir:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("downloaddir", err, ud.Message.Chat.ID)
 		return
 	}
 	if out.Result != "success" {
@@ -997,35 +1611,169 @@ func downloaddir(ud tgbotapi.Update, tokens []string) {
 	)
 }
 
-// add takes an URL to a .torrent file to add it to transmission
+// add takes an URL to a .torrent file to add it to transmission,
+// URLs separated by '|' are mirrors of the same torrent and are tried in order.
 func add(ud tgbotapi.Update, tokens []string) {
+	opts, tokens, err := parseAddOptions(tokens)
+	if err != nil {
+		sendErr("add", err, ud.Message.Chat.ID)
+		return
+	}
+
 	if len(tokens) == 0 {
 		send("*add:* needs at least one URL", ud.Message.Chat.ID, false)
 		return
 	}
 
-	// loop over the URL/s and add them
-	for _, url := range tokens {
-		cmd := transmission.NewAddCmdByURL(url)
+	// "add result 3" adds the 3rd of the last results, like their links were given
+	if strings.ToLower(tokens[0]) == "result" {
+		var links []string
+		for _, n := range tokens[1:] {
+			result, err := cachedResult(ud.Message.Chat.ID, n)
+			if err != nil {
+				sendErr("add", err, ud.Message.Chat.ID)
+				continue
+			}
+			if result.Link == "" {
+				send(fmt.Sprintf("*add:* %s is already added", result.Name), ud.Message.Chat.ID, false)
+				continue
+			}
+			links = append(links, result.Link)
+		}
+		tokens = links
+	}
 
-		torrent, err := Client.ExecuteAddCommand(cmd)
-		if err != nil {
-			send("*add:* "+err.Error(), ud.Message.Chat.ID, false)
-			continue
+	// bare info hashes become magnets, the mirrors too
+	for i := range tokens {
+		if magnet, ok := hashMagnet(tokens[i]); ok {
+			tokens[i] = magnet
 		}
+	}
 
-		// check if torrent.Name is empty, then an error happened
-		if torrent.Name == "" {
-			send("*add:* error adding "+url, ud.Message.Chat.ID, false)
+	// group the mirrors together, e.g. "url1 | url2 url3" => [url1 url2] [url3]
+	var groups [][]string
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "" {
+			continue
+		}
+		if tokens[i] == "|" {
+			if len(groups) > 0 && i+1 < len(tokens) {
+				i++
+				groups[len(groups)-1] = append(groups[len(groups)-1], tokens[i])
+			}
 			continue
 		}
-		send(fmt.Sprintf("*Added:* <%d> %s", torrent.ID, torrent.Name), ud.Message.Chat.ID, false)
+		groups = append(groups, []string{tokens[i]})
+	}
+
+	// many at once get spread out, not to hammer the trackers
+	if staggerDelay(len(groups)) > 0 {
+		go addBatch(ud.Message.Chat.ID, groups, nil, opts)
+		return
+	}
+
+	// loop over the URL/s and add them
+	for _, urls := range groups {
+		go addWithRetry(ud, urls, opts)
+	}
+}
+
+// addWithRetry tries to add one of urls, if all of them fail it keeps retrying
+// with exponential backoff until AddRetry passes, then reports the outcome.
+func addWithRetry(ud tgbotapi.Update, urls []string, opts addOptions) {
+	configMu.RLock()
+	window := AddRetry
+	configMu.RUnlock()
+
+	// add it paused to check its size before transmission writes it all out
+	guard := !opts.Paused && preallocGuard()
+	if guard {
+		opts.Paused = true
+	}
+
+	ctx, finish := startOp(ud.Message.Chat.ID)
+	defer finish()
+
+	var (
+		deadline = time.Now().Add(window)
+		backoff  = 5 * time.Second
+		attempts int
+		err      error
+	)
+
+	for {
+		for _, url := range urls {
+			attempts++
+
+			var torrent transmission.TorrentAdded
+			torrent, err = addOne(url, opts)
+			if err != nil {
+				// it got added but something after failed, or it was there already
+				if torrent.ID != 0 {
+					sendErr("add", err, ud.Message.Chat.ID)
+					return
+				}
+				continue
+			}
+
+			send(fmt.Sprintf("*Added:* <%d> %s", torrent.ID, torrent.Name), ud.Message.Chat.ID, false)
+			if guard {
+				go checkPrealloc(ud.Message.Chat.ID, torrent.ID)
+			}
+			go confirmSize(ud.Message.Chat.ID, torrent.ID)
+			return
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			break
+		}
+
+		// let the user know that we are still trying, only once
+		if attempts == len(urls) {
+			send(fmt.Sprintf("*add:* %s, retrying for %s", err, window), ud.Message.Chat.ID, false)
+		}
+
+		select {
+		case <-ctx.Done():
+			send("*add:* cancelled", ud.Message.Chat.ID, false)
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 5*time.Minute {
+			backoff = 5 * time.Minute
+		}
+	}
+
+	if attempts > len(urls) {
+		send(fmt.Sprintf("*add:* gave up after %d attempts: %s", attempts, err), ud.Message.Chat.ID, false)
+		return
+	}
+	sendErr("add", err, ud.Message.Chat.ID)
+}
+
+// addURL adds a single URL or magnet to transmission
+func addURL(url string) (transmission.TorrentAdded, error) {
+	cmd := transmission.NewAddCmdByURL(url)
+
+	torrent, err := rpcClient().ExecuteAddCommand(cmd)
+	if err != nil {
+		return torrent, err
+	}
+
+	// check if torrent.Name is empty, then an error happened
+	if torrent.Name == "" {
+		return torrent, fmt.Errorf("error adding %s", url)
 	}
+	return torrent, nil
 }
 
 // receiveTorrent gets an update that potentially has a .torrent file to add
 func receiveTorrent(ud tgbotapi.Update) {
 	if ud.Message.Document == nil {
+		// maybe a caption with links, e.g. a picture forwarded from a channel
+		if links := detectLinks(ud.Message); len(links) > 0 {
+			offerLinks(ud, links)
+		}
 		return // has no document
 	}
 
@@ -1035,15 +1783,35 @@ func receiveTorrent(ud tgbotapi.Update) {
 	}
 	file, err := Bot.GetFile(fconfig)
 	if err != nil {
-		send("*receiver:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("receiver", err, ud.Message.Chat.ID)
+		return
+	}
+
+	// a chat export or a text file full of magnets
+	if caption := strings.ToLower(ud.Message.Caption); caption == "import" || caption == "/import" {
+		importMagnets(ud, file.Link(BotToken))
+		return
+	}
+
+	// several documents sent at once come one by one, they're added together
+	if ud.Message.MediaGroupID != "" {
+		collectAlbum(ud, file.Link(BotToken))
+		return
+	}
+
+	// the caption can have options, e.g. "dir=/data/movies paused label=4k"
+	opts, err := parseCaption(ud.Message.Caption)
+	if err != nil {
+		sendErr("receiver", err, ud.Message.Chat.ID)
 		return
 	}
 
 	// add by file URL
-	add(ud, []string{file.Link(BotToken)})
+	addWithRetry(ud, []string{file.Link(BotToken)}, opts)
 }
 
-// search takes a query and returns torrents with match
+// search takes a query and returns torrents with match, the results are kept
+// so "search more" shows the next page and "search filter <query>" narrows them down.
 func search(ud tgbotapi.Update, tokens []string) {
 	// make sure that we got a query
 	if len(tokens) == 0 {
@@ -1051,35 +1819,60 @@ func search(ud tgbotapi.Update, tokens []string) {
 		return
 	}
 
+	switch strings.ToLower(tokens[0]) {
+	case "more":
+		page, err := moreResults(ud.Message.Chat.ID)
+		if err != nil {
+			sendErr("search", err, ud.Message.Chat.ID)
+			return
+		}
+		send(page, ud.Message.Chat.ID, true)
+		return
+
+	case "filter":
+		regx, err := compileQuery(strings.Join(tokens[1:], " "))
+		if err != nil {
+			sendErr("search", err, ud.Message.Chat.ID)
+			return
+		}
+
+		page, err := filterResults(ud.Message.Chat.ID, regx)
+		if err != nil {
+			sendErr("search", err, ud.Message.Chat.ID)
+			return
+		}
+		send(page, ud.Message.Chat.ID, true)
+		return
+	}
+
 	query := strings.Join(tokens, " ")
-	// "(?i)" for case insensitivity
-	regx, err := regexp.Compile("(?i)" + query)
+	regx, err := compileQuery(query)
 	if err != nil {
-		send("*search:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("search", err, ud.Message.Chat.ID)
 		return
 	}
 
-	torrents, err := Client.GetTorrents()
+	torrents, err := getTorrents(nameFields...)
 	if err != nil {
-		send("*search:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("search", err, ud.Message.Chat.ID)
 		return
 	}
 
-	buf := new(bytes.Buffer)
+	var results []searchResult
 	for i := range torrents {
-		if regx.MatchString(torrents[i].Name) {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+		if matchName(ud.Message.Chat.ID, regx, torrents[i].Name) {
+			results = append(results, searchResult{ID: torrents[i].ID, Name: torrents[i].Name})
 		}
 	}
-	if buf.Len() == 0 {
+	if len(results) == 0 {
 		send("No matches!", ud.Message.Chat.ID, false)
 		return
 	}
-	send(buf.String(), ud.Message.Chat.ID, false)
+	send(cacheResults(ud.Message.Chat.ID, "search", results), ud.Message.Chat.ID, true)
 }
 
 // latest takes n and returns the latest n torrents
-func latest(ud tgbotapi.Update, tokens []string) {
+func latest(ud tgbotapi.Update, tokens []string, asFile bool) {
 	var (
 		n   = 5 // default to 5
 		err error
@@ -1093,9 +1886,9 @@ func latest(ud tgbotapi.Update, tokens []string) {
 		}
 	}
 
-	torrents, err := Client.GetTorrents()
+	torrents, err := getTorrents(listingFields("latest")...)
 	if err != nil {
-		send("*latest:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("latest", err, ud.Message.Chat.ID)
 		return
 	}
 
@@ -1109,17 +1902,26 @@ func latest(ud tgbotapi.Update, tokens []string) {
 
 	buf := new(bytes.Buffer)
 	for i := range torrents[:n] {
-		buf.WriteString(fmt.Sprintf("<%d> %s\n", torrents[i].ID, torrents[i].Name))
+		buf.WriteString(listingLine(ud.Message.Chat.ID, "latest", torrents[i]))
 	}
 	if buf.Len() == 0 {
 		send("*latest:* No torrents", ud.Message.Chat.ID, false)
 		return
 	}
-	send(buf.String(), ud.Message.Chat.ID, false)
+	sendListing(buf.String(), ud.Message.Chat.ID, asFile)
 }
 
 // info takes an id of a torrent and returns some info about it
 func info(ud tgbotapi.Update, tokens []string) {
+	loc := chatLocale(ud.Message.Chat.ID)
+
+	// 'full' adds the details that don't change while live
+	var full bool
+	if len(tokens) > 0 && strings.ToLower(tokens[0]) == "full" {
+		full = true
+		tokens = tokens[1:]
+	}
+
 	if len(tokens) == 0 {
 		send("*info:* needs a torrent ID number", ud.Message.Chat.ID, false)
 		return
@@ -1133,7 +1935,7 @@ func info(ud tgbotapi.Update, tokens []string) {
 		}
 
 		// get the torrent
-		torrent, err := Client.GetTorrent(torrentID)
+		torrent, err := rpcClient().GetTorrent(torrentID)
 		if err != nil {
 			send(fmt.Sprintf("*info:* Can't find a torrent with an ID of %d", torrentID), ud.Message.Chat.ID, false)
 			continue
@@ -1148,58 +1950,162 @@ func info(ud tgbotapi.Update, tokens []string) {
 			}
 		}
 
+		var extra string
+		if full {
+			extra, err = infoFull(torrentID)
+			if err != nil {
+				sendErr("info", err, ud.Message.Chat.ID)
+				continue
+			}
+		}
+
+		// set by other tools through the API, e.g. who requested it
+		if fields := customFields(torrentID); fields != "" {
+			extra += "\n" + mdReplacer.Replace(fields)
+		}
+
 		// format the info
-		torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-		info := fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\nDL: *%s* UP: *%s*\nAdded: *%s*, ETA: *%s*\nTrackers: `%s`",
-			torrent.ID, torrentName, torrent.TorrentStatus(), humanize.Bytes(torrent.Have()), humanize.Bytes(torrent.SizeWhenDone),
-			torrent.PercentDone*100, humanize.Bytes(torrent.RateDownload), humanize.Bytes(torrent.RateUpload), torrent.Ratio(),
-			humanize.Bytes(torrent.DownloadedEver), humanize.Bytes(torrent.UploadedEver), time.Unix(torrent.AddedDate, 0).Format(time.Stamp),
-			torrent.ETA(), trackers)
+		render, final := infoRender(ud.Message.Chat.ID, loc, torrentID, trackers, extra)
+		info := render(transmission.Torrents{torrent})
 
 		// send it
 		msgID := send(info, ud.Message.Chat.ID, true)
+		rememberCard(ud.Message.Chat.ID, msgID, torrentID)
 
 		if NoLive {
 			return
 		}
 
-		// this go-routine will make the info live for 'duration * interval'
-		go func(torrentID, msgID int) {
-			for i := 0; i < duration; i++ {
-				time.Sleep(time.Second * interval)
-				torrent, err = Client.GetTorrent(torrentID)
-				if err != nil {
-					continue // skip this iteration if there's an error retrieving the torrent's info
-				}
+		// keep the info live for 'duration * interval'
+		if err := startLive(ud.Message.Chat.ID, msgID, true, render, final); err != nil {
+			sendErr("info", err, ud.Message.Chat.ID)
+		}
+	}
+}
+
+// infoRender returns the live renders of info for the torrent with id
+func infoRender(chat int64, loc locale, id int, trackers, extra string) (render, final liveRender) {
+	find := func(torrents transmission.Torrents) *transmission.Torrent {
+		for _, torrent := range torrents {
+			if torrent.ID == id {
+				return torrent
+			}
+		}
+		return nil
+	}
+
+	render = func(torrents transmission.Torrents) string {
+		torrent := find(torrents)
+		if torrent == nil {
+			return ""
+		}
+
+		torrentName := mdReplacer.Replace(displayName(chat, torrent.Name)) // escape markdown
+		return fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%s%%*) ↓ *%s*  ↑ *%s* R: *%s*\nDL: *%s* UP: *%s*\nAdded: *%s*, ETA: *%s*\nTrackers: `%s`%s",
+			torrent.ID, torrentName, torrent.TorrentStatus(), loc.bytes(torrent.Have()), loc.bytes(torrent.SizeWhenDone),
+			loc.float(torrent.PercentDone*100, 1), loc.bytes(torrent.RateDownload), loc.bytes(torrent.RateUpload), loc.number(torrent.Ratio()),
+			loc.bytes(torrent.DownloadedEver), loc.bytes(torrent.UploadedEver), loc.time(time.Unix(torrent.AddedDate, 0)),
+			torrent.ETA(), trackers, extra)
+	}
+
+	// at the end write dashes to indicate that we are done being live.
+	final = func(torrents transmission.Torrents) string {
+		torrent := find(torrents)
+		if torrent == nil {
+			return ""
+		}
+
+		torrentName := mdReplacer.Replace(displayName(chat, torrent.Name))
+		return fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%s%%*) ↓ *- B*  ↑ *- B* R: *%s*\nDL: *%s* UP: *%s*\nAdded: *%s*, ETA: *-*\nTrackers: `%s`%s",
+			torrent.ID, torrentName, torrent.TorrentStatus(), loc.bytes(torrent.Have()), loc.bytes(torrent.SizeWhenDone),
+			loc.float(torrent.PercentDone*100, 1), loc.number(torrent.Ratio()), loc.bytes(torrent.DownloadedEver), loc.bytes(torrent.UploadedEver),
+			loc.time(time.Unix(torrent.AddedDate, 0)), trackers, extra)
+	}
+	return render, final
+}
+
+// infoFull returns the extra details of a torrent shown by 'info full'
+func infoFull(id int) (string, error) {
+	torrent, err := getTorrentExtra(id, "isPrivate", "webseeds", "trackerStats")
+	if err != nil {
+		return "", err
+	}
 
-				torrentName := mdReplacer.Replace(torrent.Name)
-				info := fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *%s*  ↑ *%s* R: *%s*\nDL: *%s* UP: *%s*\nAdded: *%s*, ETA: *%s*\nTrackers: `%s`",
-					torrent.ID, torrentName, torrent.TorrentStatus(), humanize.Bytes(torrent.Have()), humanize.Bytes(torrent.SizeWhenDone),
-					torrent.PercentDone*100, humanize.Bytes(torrent.RateDownload), humanize.Bytes(torrent.RateUpload), torrent.Ratio(),
-					humanize.Bytes(torrent.DownloadedEver), humanize.Bytes(torrent.UploadedEver), time.Unix(torrent.AddedDate, 0).Format(time.Stamp),
-					torrent.ETA(), trackers)
+	private := "no"
+	if torrent.IsPrivate {
+		private = "yes"
+	}
+
+	webseeds := "none"
+	if len(torrent.Webseeds) > 0 {
+		webseeds = strings.Join(torrent.Webseeds, " ")
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("\nPrivate: *%s*\nWeb seeds: `%s`", private, webseeds))
 
-				// update the message
-				editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, info)
-				editConf.ParseMode = tgbotapi.ModeMarkdown
-				Bot.Send(editConf)
+	// when each tracker was last announced to, with what result, and when it's next
+	for _, tracker := range torrent.Trackers {
+		last := "never"
+		if tracker.LastAnnounceTime > 0 {
+			last = time.Since(time.Unix(tracker.LastAnnounceTime, 0)).Round(time.Second).String() + " ago"
+		}
 
+		next := "not scheduled"
+		if tracker.NextAnnounceTime > 0 {
+			next = "now"
+			if until := time.Until(time.Unix(tracker.NextAnnounceTime, 0)); until > 0 {
+				next = "in " + until.Round(time.Second).String()
 			}
-			// sleep one more time before the dashes
-			time.Sleep(time.Second * interval)
+		}
+
+		result := tracker.LastAnnounceResult
+		if result == "" {
+			result = "-"
+		}
+
+		buf.WriteString(fmt.Sprintf("\n\n*%s*\nLast announce: %s, %s\nNext announce: %s",
+			mdReplacer.Replace(tracker.Host), last, mdReplacer.Replace(result), next))
+	}
+
+	return buf.String(), nil
+}
+
+// webseed lists the web seeds of a torrent, adding web seeds isn't supported
+// since transmission's RPC has no way to do it.
+func webseed(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*webseed:* needs a torrent ID number", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if strings.ToLower(tokens[0]) == "add" {
+		send("*webseed:* Transmission doesn't support adding web seeds", ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrentID, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*webseed:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
 
-			// at the end write dashes to indicate that we are done being live.
-			torrentName := mdReplacer.Replace(torrent.Name)
-			info := fmt.Sprintf("`<%d>` *%s*\n%s *%s* of *%s* (*%.1f%%*) ↓ *- B*  ↑ *- B* R: *%s*\nDL: *%s* UP: *%s*\nAdded: *%s*, ETA: *-*\nTrackers: `%s`",
-				torrent.ID, torrentName, torrent.TorrentStatus(), humanize.Bytes(torrent.Have()), humanize.Bytes(torrent.SizeWhenDone),
-				torrent.PercentDone*100, torrent.Ratio(), humanize.Bytes(torrent.DownloadedEver), humanize.Bytes(torrent.UploadedEver),
-				time.Unix(torrent.AddedDate, 0).Format(time.Stamp), trackers)
+	torrent, err := getTorrentExtra(torrentID, "name", "webseeds")
+	if err != nil {
+		sendErr("webseed", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if len(torrent.Webseeds) == 0 {
+		send(fmt.Sprintf("*webseed:* %s has no web seeds", torrent.Name), ud.Message.Chat.ID, false)
+		return
+	}
 
-			editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, info)
-			editConf.ParseMode = tgbotapi.ModeMarkdown
-			Bot.Send(editConf)
-		}(torrentID, msgID)
+	buf := new(bytes.Buffer)
+	for _, ws := range torrent.Webseeds {
+		buf.WriteString(ws + "\n")
 	}
+	send(buf.String(), ud.Message.Chat.ID, false)
 }
 
 // stop takes id[s] of torrent[s] or 'all' to stop them
@@ -1210,9 +2116,23 @@ func stop(ud tgbotapi.Update, tokens []string) {
 		return
 	}
 
+	// "stop status=seeding ratio>2" stops the torrents that match
+	if ids, ok, err := filteredIDs(tokens); ok {
+		if err != nil {
+			sendErr("stop", err, ud.Message.Chat.ID)
+			return
+		}
+		if err := rpcCall("torrent-stop", map[string]interface{}{"ids": ids}, nil); err != nil {
+			sendErr("stop", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("Stopped %d torrents", len(ids)), ud.Message.Chat.ID, false)
+		return
+	}
+
 	// if the first argument is 'all' then stop all torrents
 	if tokens[0] == "all" {
-		if err := Client.StopAll(); err != nil {
+		if err := rpcClient().StopAll(); err != nil {
 			send("*stop:* error occurred while stopping some torrents", ud.Message.Chat.ID, false)
 			return
 		}
@@ -1226,13 +2146,13 @@ func stop(ud tgbotapi.Update, tokens []string) {
 			send(fmt.Sprintf("*stop:* %s is not a number", id), ud.Message.Chat.ID, false)
 			continue
 		}
-		status, err := Client.StopTorrent(num)
+		status, err := rpcClient().StopTorrent(num)
 		if err != nil {
-			send("*stop:* "+err.Error(), ud.Message.Chat.ID, false)
+			sendErr("stop", err, ud.Message.Chat.ID)
 			continue
 		}
 
-		torrent, err := Client.GetTorrent(num)
+		torrent, err := rpcClient().GetTorrent(num)
 		if err != nil {
 			send(fmt.Sprintf("[fail] *stop:* No torrent with an ID of %d", num), ud.Message.Chat.ID, false)
 			return
@@ -1249,9 +2169,23 @@ func start(ud tgbotapi.Update, tokens []string) {
 		return
 	}
 
+	// "start status=paused label:tv" starts the torrents that match
+	if filtered, isFilter, err := filteredIDs(tokens); isFilter {
+		if err != nil {
+			sendErr("start", err, ud.Message.Chat.ID)
+			return
+		}
+		if err := rpcCall("torrent-start", map[string]interface{}{"ids": filtered}, nil); err != nil {
+			sendErr("start", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("Started %d torrents", len(filtered)), ud.Message.Chat.ID, false)
+		return
+	}
+
 	// if the first argument is 'all' then start all torrents
 	if tokens[0] == "all" {
-		if err := Client.StartAll(); err != nil {
+		if err := rpcClient().StartAll(); err != nil {
 			send("*start:* error occurred while starting some torrents", ud.Message.Chat.ID, false)
 			return
 		}
@@ -1266,13 +2200,13 @@ func start(ud tgbotapi.Update, tokens []string) {
 			send(fmt.Sprintf("*start:* %s is not a number", id), ud.Message.Chat.ID, false)
 			continue
 		}
-		status, err := Client.StartTorrent(num)
+		status, err := rpcClient().StartTorrent(num)
 		if err != nil {
-			send("*start:* "+err.Error(), ud.Message.Chat.ID, false)
+			sendErr("start", err, ud.Message.Chat.ID)
 			continue
 		}
 
-		torrent, err := Client.GetTorrent(num)
+		torrent, err := rpcClient().GetTorrent(num)
 		if err != nil {
 			send(fmt.Sprintf("[fail] *start:* No torrent with an ID of %d", num), ud.Message.Chat.ID, false)
 			return
@@ -1289,13 +2223,39 @@ func check(ud tgbotapi.Update, tokens []string) {
 		return
 	}
 
+	// hold them back while verifyqueue is on
+	if verifyLimit() > 0 {
+		var ids []int
+		if tokens[0] != "all" {
+			var err error
+			if ids, err = parseIDs(tokens); err != nil {
+				sendErr("check", err, ud.Message.Chat.ID)
+				return
+			}
+		}
+
+		n, err := queueVerify(ids)
+		if err != nil {
+			sendErr("check", err, ud.Message.Chat.ID)
+			return
+		}
+		send(fmt.Sprintf("*check:* queued %d torrents, %d verify at a time", n, verifyLimit()), ud.Message.Chat.ID, false)
+		return
+	}
+
 	// if the first argument is 'all' then start all torrents
 	if tokens[0] == "all" {
-		if err := Client.VerifyAll(); err != nil {
+		torrents, err := getTorrents(statsFields...)
+		if err != nil {
+			sendErr("check", err, ud.Message.Chat.ID)
+			return
+		}
+
+		if err := rpcClient().VerifyAll(); err != nil {
 			send("*check:* error occurred while verifying some torrents", ud.Message.Chat.ID, false)
 			return
 		}
-		send("Verifying all torrents", ud.Message.Chat.ID, false)
+		watchVerify(ud.Message.Chat.ID, len(torrents))
 		return
 
 	}
@@ -1306,13 +2266,13 @@ func check(ud tgbotapi.Update, tokens []string) {
 			send(fmt.Sprintf("*check:* %s is not a number", id), ud.Message.Chat.ID, false)
 			continue
 		}
-		status, err := Client.VerifyTorrent(num)
+		status, err := rpcClient().VerifyTorrent(num)
 		if err != nil {
-			send("*check:* "+err.Error(), ud.Message.Chat.ID, false)
+			sendErr("check", err, ud.Message.Chat.ID)
 			continue
 		}
 
-		torrent, err := Client.GetTorrent(num)
+		torrent, err := rpcClient().GetTorrent(num)
 		if err != nil {
 			send(fmt.Sprintf("[fail] *check:* No torrent with an ID of %d", num), ud.Message.Chat.ID, false)
 			return
@@ -1324,9 +2284,11 @@ func check(ud tgbotapi.Update, tokens []string) {
 
 // stats echo back transmission stats
 func stats(ud tgbotapi.Update) {
-	stats, err := Client.GetStats()
+	loc := chatLocale(ud.Message.Chat.ID)
+
+	stats, err := rpcClient().GetStats()
 	if err != nil {
-		send("*stats:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("stats", err, ud.Message.Chat.ID)
 		return
 	}
 
@@ -1351,12 +2313,12 @@ func stats(ud tgbotapi.Update) {
 		stats.TorrentCount,
 		stats.ActiveTorrentCount,
 		stats.PausedTorrentCount,
-		humanize.Bytes(stats.CurrentStats.DownloadedBytes),
-		humanize.Bytes(stats.CurrentStats.UploadedBytes),
+		loc.bytes(stats.CurrentStats.DownloadedBytes),
+		loc.bytes(stats.CurrentStats.UploadedBytes),
 		stats.CurrentActiveTime(),
 		stats.CumulativeStats.SessionCount,
-		humanize.Bytes(stats.CumulativeStats.DownloadedBytes),
-		humanize.Bytes(stats.CumulativeStats.UploadedBytes),
+		loc.bytes(stats.CumulativeStats.DownloadedBytes),
+		loc.bytes(stats.CumulativeStats.UploadedBytes),
 		stats.CumulativeActiveTime(),
 	)
 
@@ -1392,7 +2354,7 @@ func speedLimit(ud tgbotapi.Update, tokens []string, limitType transmission.Spee
 		return
 	}
 
-	out, err := Client.ExecuteCommand(speedLimitCmd)
+	out, err := rpcClient().ExecuteCommand(speedLimitCmd)
 	if err != nil {
 		send(fmt.Sprintf("*%s:* %v", limitType, err.Error()), ud.Message.Chat.ID, false)
 		return
@@ -1410,13 +2372,15 @@ func speedLimit(ud tgbotapi.Update, tokens []string, limitType transmission.Spee
 
 // speed will echo back the current download and upload speeds
 func speed(ud tgbotapi.Update) {
-	stats, err := Client.GetStats()
+	loc := chatLocale(ud.Message.Chat.ID)
+
+	stats, err := rpcClient().GetStats()
 	if err != nil {
-		send("*speed:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("speed", err, ud.Message.Chat.ID)
 		return
 	}
 
-	msg := fmt.Sprintf("↓ %s  ↑ %s", humanize.Bytes(stats.DownloadSpeed), humanize.Bytes(stats.UploadSpeed))
+	msg := fmt.Sprintf("↓ %s  ↑ %s", loc.bytes(stats.DownloadSpeed), loc.bytes(stats.UploadSpeed))
 
 	msgID := send(msg, ud.Message.Chat.ID, false)
 
@@ -1424,34 +2388,38 @@ func speed(ud tgbotapi.Update) {
 		return
 	}
 
-	for i := 0; i < duration; i++ {
-		time.Sleep(time.Second * interval)
-		stats, err = Client.GetStats()
-		if err != nil {
-			continue
+	// the live ticks add up the rates of the torrents they got anyway, it's what the stats do
+	render := func(torrents transmission.Torrents) string {
+		var down, up uint64
+		for _, torrent := range torrents {
+			down += torrent.RateDownload
+			up += torrent.RateUpload
 		}
-
-		msg = fmt.Sprintf("↓ %s  ↑ %s", humanize.Bytes(stats.DownloadSpeed), humanize.Bytes(stats.UploadSpeed))
-
-		editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, msg)
-		Bot.Send(editConf)
-		time.Sleep(time.Second * interval)
+		return fmt.Sprintf("↓ %s  ↑ %s", loc.bytes(down), loc.bytes(up))
 	}
-	// sleep one more time before switching to dashes
-	time.Sleep(time.Second * interval)
 
 	// show dashes to indicate that we are done updating.
-	editConf := tgbotapi.NewEditMessageText(ud.Message.Chat.ID, msgID, "↓ - B  ↑ - B")
-	Bot.Send(editConf)
+	final := func(transmission.Torrents) string { return "↓ - B  ↑ - B" }
+
+	if err := startLive(ud.Message.Chat.ID, msgID, false, render, final); err != nil {
+		sendErr("speed", err, ud.Message.Chat.ID)
+	}
 }
 
 // count returns current torrents count per status
-func count(ud tgbotapi.Update) {
-	torrents, err := Client.GetTorrents()
+func count(ud tgbotapi.Update, tokens []string) {
+	filter, _, err := queryFilter(anyTorrent, tokens)
+	if err != nil {
+		sendErr("count", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(statsFields...)
 	if err != nil {
-		send("*count:* "+err.Error(), ud.Message.Chat.ID, false)
+		sendErr("count", err, ud.Message.Chat.ID)
 		return
 	}
+	torrents = filterTorrents(torrents, filter)
 
 	var downloading, seeding, stopped, checking, downloadingQ, seedingQ, checkingQ int
 
@@ -1483,101 +2451,158 @@ func count(ud tgbotapi.Update) {
 
 // del takes an id or more, and delete the corresponding torrent/s
 func del(ud tgbotapi.Update, tokens []string) {
+	deleteTorrents(ud, tokens, "del", false)
+}
+
+// deldata takes an id or more, and delete the corresponding torrent/s with their data
+func deldata(ud tgbotapi.Update, tokens []string) {
+	deleteTorrents(ud, tokens, "deldata", true)
+}
+
+// deleteTorrents deletes the torrents with the IDs in tokens, and their data if withData is true.
+// deleting many torrents edits a single progress message instead of sending one message per torrent.
+func deleteTorrents(ud tgbotapi.Update, tokens []string, cmd string, withData bool) {
 	// make sure that we got an argument
 	if len(tokens) == 0 {
-		send("*del:* needs an ID", ud.Message.Chat.ID, false)
+		send(fmt.Sprintf("*%s:* needs an ID", cmd), ud.Message.Chat.ID, false)
 		return
 	}
 
-	// loop over tokens to read each potential id
+	// "after:seedtarget" waits for the torrents to finish seeding
+	var afterSeed bool
+	if last := strings.ToLower(tokens[len(tokens)-1]); last == "after:seedtarget" {
+		afterSeed = true
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	// read all the IDs before deleting anything, "del status=seeding ratio>5" takes the
+	// torrents that match
+	ids, isFilter, err := filteredIDs(tokens)
+	if err != nil {
+		sendErr(cmd, err, ud.Message.Chat.ID)
+		return
+	}
 	for _, id := range tokens {
+		if isFilter {
+			break
+		}
 		num, err := strconv.Atoi(id)
 		if err != nil {
-			send(fmt.Sprintf("*del:* %s is not an ID", id), ud.Message.Chat.ID, false)
+			send(fmt.Sprintf("*%s:* %s is not an ID", cmd, id), ud.Message.Chat.ID, false)
 			return
 		}
+		ids = append(ids, num)
+	}
 
-		name, err := Client.DeleteTorrent(num, false)
-		if err != nil {
-			send("*del:* "+err.Error(), ud.Message.Chat.ID, false)
-			return
-		}
+	if afterSeed && len(ids) == 0 {
+		send(fmt.Sprintf("*%s:* needs an ID", cmd), ud.Message.Chat.ID, false)
+		return
+	}
 
-		send("*Deleted:* "+name, ud.Message.Chat.ID, false)
+	// big deletes, and the ones picked by a filter, have to be confirmed first, the ones
+	// waiting for the seed target too
+	if confirmDelete(ud.Message.Chat.ID, ids, cmd, withData, isFilter, afterSeed) {
+		return
 	}
-}
 
-// deldata takes an id or more, and delete the corresponding torrent/s with their data
-func deldata(ud tgbotapi.Update, tokens []string) {
-	// make sure that we got an argument
-	if len(tokens) == 0 {
-		send("*deldata:* needs an ID", ud.Message.Chat.ID, false)
+	if afterSeed {
+		deleteAfterSeed(ud.Message.Chat.ID, ids, cmd, withData)
 		return
 	}
-	// loop over tokens to read each potential id
-	for _, id := range tokens {
-		num, err := strconv.Atoi(id)
+
+	removeTorrents(ud.Message.Chat.ID, ids, cmd, withData)
+}
+
+// removeTorrents deletes the torrents with ids, and reports the result to chat
+func removeTorrents(chat int64, ids []int, cmd string, withData bool) {
+	deleted := "*Deleted:* "
+	if withData {
+		deleted = "Deleted with data: "
+	}
+
+	if len(ids) == 1 {
+		name, err := rpcClient().DeleteTorrent(ids[0], withData)
 		if err != nil {
-			send(fmt.Sprintf("*deldata:* %s is not an ID", id), ud.Message.Chat.ID, false)
+			sendErr(cmd, err, chat)
 			return
 		}
+		send(deleted+name, chat, false)
+		return
+	}
 
-		name, err := Client.DeleteTorrent(num, true)
-		if err != nil {
-			send("*deldata:* "+err.Error(), ud.Message.Chat.ID, false)
-			return
+	ctx, finish := startOp(chat)
+	defer finish()
+
+	p := newProgress(chat, "Deleting", len(ids))
+	buf := new(bytes.Buffer)
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			buf.WriteString(fmt.Sprintf("Cancelled, %d torrents were not deleted\n", len(ids)-i))
+			break
 		}
 
-		send("Deleted with data: "+name, ud.Message.Chat.ID, false)
+		name, err := rpcClient().DeleteTorrent(id, withData)
+		if err != nil {
+			buf.WriteString(fmt.Sprintf("*%s:* %s\n", cmd, err))
+		} else {
+			buf.WriteString(deleted + name + "\n")
+		}
+		p.update(i+1, len(ids))
 	}
+	p.finish(buf.String())
 }
 
 // getVersion sends transmission version + transmission-telegram version
 func getVersion(ud tgbotapi.Update) {
-	send(fmt.Sprintf("Transmission *%s*\nTransmission-telegram *%s*", Client.Version(), VERSION), ud.Message.Chat.ID, true)
+	send(fmt.Sprintf("Transmission *%s*\nTransmission-telegram *%s*", rpcClient().Version(), VERSION), ud.Message.Chat.ID, true)
+}
+
+// torrentLine formats a torrent for the markdown listings of chat, the ID is a code entity so
+// it can be copied with a tap, and the /info_ID link runs info on the torrent.
+func torrentLine(chat int64, id int, name string) string {
+	return fmt.Sprintf("`<%d>` %s /info\\_%d\n", id, mdReplacer.Replace(displayName(chat, name)), id)
 }
 
-// send takes a chat id and a message to send, returns the message id of the send message
+// send takes a chat id and a message to send, returns the message id of the send message.
+// messages that would take more than -max-messages chunks are sent as a text file instead.
 func send(text string, chatID int64, markdown bool) int {
+	configMu.RLock()
+	limit := MaxMessages
+	configMu.RUnlock()
+
+	if limit > 0 {
+		if n := messageCount(text); n > limit {
+			if markdown {
+				text = plainMarkdown.Replace(text)
+			}
+			sendFile(chatID, "message.txt", text, fmt.Sprintf("That's %d messages long, here it is as a file", n))
+			return 0
+		}
+	}
+
+	return sendChunks(text, chatID, markdown)
+}
+
+// sendChunks sends text in as many messages as it takes, returns the message id of the last one
+func sendChunks(text string, chatID int64, markdown bool) int {
 	// set typing action
 	action := tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)
-	Bot.Send(action)
-
-	// check the rune count, telegram is limited to 4096 chars per message;
-	// so if our message is > 4096, split it in chunks the send them.
-	msgRuneCount := utf8.RuneCountInString(text)
-LenCheck:
-	stop := 4095
-	if msgRuneCount > 4096 {
-		for text[stop] != 10 { // '\n'
-			stop--
-		}
-		msg := tgbotapi.NewMessage(chatID, text[:stop])
+	botSend(action)
+
+	// telegram is limited to 4096 chars per message, so longer ones are sent in chunks
+	// and the id of the last one is returned
+	var resp tgbotapi.Message
+	for _, chunk := range splitMessage(text, markdown) {
+		msg := tgbotapi.NewMessage(chatID, chunk)
 		msg.DisableWebPagePreview = true
 		if markdown {
 			msg.ParseMode = tgbotapi.ModeMarkdown
 		}
 
-		// send current chunk
-		if _, err := Bot.Send(msg); err != nil {
+		var err error
+		if resp, err = sendMarkdown(msg); err != nil {
 			logger.Printf("[ERROR] Send: %s", err)
 		}
-		// move to the next chunk
-		text = text[stop:]
-		msgRuneCount = utf8.RuneCountInString(text)
-		goto LenCheck
-	}
-
-	// if msgRuneCount < 4096, send it normally
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.DisableWebPagePreview = true
-	if markdown {
-		msg.ParseMode = tgbotapi.ModeMarkdown
-	}
-
-	resp, err := Bot.Send(msg)
-	if err != nil {
-		logger.Printf("[ERROR] Send: %s", err)
 	}
 
 	return resp.MessageID
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// messageRunes is the most telegram takes in a message
+const messageRunes = 4096
+
+var (
+	// plainMarkdown turns the markdown of the bot's messages into plain text, for files and
+	// for when telegram can't parse it
+	plainMarkdown = strings.NewReplacer("`", "", "*", "", "\\_", "_")
+
+	// entityOffsetRegex finds where telegram stopped parsing, e.g. "can't parse entities:
+	// Can't find end of the entity starting at byte offset 123"
+	entityOffsetRegex = regexp.MustCompile(`byte offset (\d+)`)
+)
+
+// parseFailed returns true if err is telegram refusing the markdown of a message
+func parseFailed(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't parse entities")
+}
+
+// logParseError logs err with the part of text telegram couldn't parse
+func logParseError(text string, err error) {
+	snippet := text
+	if sm := entityOffsetRegex.FindStringSubmatch(err.Error()); len(sm) > 1 {
+		if offset, convErr := strconv.Atoi(sm[1]); convErr == nil && offset <= len(text) {
+			start, end := offset-20, offset+20
+			if start < 0 {
+				start = 0
+			}
+			if end > len(text) {
+				end = len(text)
+			}
+			snippet = text[start:end]
+		}
+	}
+	if len(snippet) > 80 {
+		snippet = snippet[:80]
+	}
+	logger.Printf("[ERROR] Send: %s, sending it as plain text, near %q", err, snippet)
+}
+
+// sendMarkdown sends msg, when telegram can't parse its markdown it's sent again as plain text
+func sendMarkdown(msg tgbotapi.MessageConfig) (tgbotapi.Message, error) {
+	resp, err := botSend(msg)
+	if msg.ParseMode == "" || !parseFailed(err) {
+		return resp, err
+	}
+
+	logParseError(msg.Text, err)
+	msg.ParseMode = ""
+	msg.Text = plainMarkdown.Replace(msg.Text)
+	return botSend(msg)
+}
+
+// editMarkdown is sendMarkdown for edits
+func editMarkdown(edit tgbotapi.EditMessageTextConfig) (tgbotapi.Message, error) {
+	resp, err := botSend(edit)
+	if edit.ParseMode == "" || !parseFailed(err) {
+		return resp, err
+	}
+
+	logParseError(edit.Text, err)
+	edit.ParseMode = ""
+	edit.Text = plainMarkdown.Replace(edit.Text)
+	return botSend(edit)
+}
+
+// splitMessage splits text in chunks telegram takes, at the last newline that fits or at a
+// rune when a line is too long. with markdown, an entity that's still open at the end of a chunk
+// is closed there and opened again in the next one, and links aren't cut.
+func splitMessage(text string, markdown bool) []string {
+	var chunks []string
+	for {
+		if utf8.RuneCountInString(text) <= messageRunes {
+			return append(chunks, text)
+		}
+
+		// leave room to close "```" at the end
+		cut := runeOffset(text, messageRunes-4)
+		if nl := strings.LastIndexByte(text[:cut], '\n'); nl > 0 {
+			cut = nl
+		} else if strings.HasSuffix(text[:cut], "\\") {
+			cut--
+		}
+
+		var open string
+		if markdown {
+			var start int
+			if open, start = openEntity(text[:cut]); open == "[" && start > 0 {
+				cut, open = start, ""
+			}
+		}
+
+		chunk, rest := text[:cut], strings.TrimPrefix(text[cut:], "\n")
+		switch open {
+		case "", "[":
+		case "```":
+			chunk += "\n```"
+			rest = "```\n" + rest
+		default:
+			chunk += open
+			rest = open + rest
+		}
+		chunks = append(chunks, chunk)
+		text = rest
+	}
+}
+
+// runeOffset returns the byte offset of the nth rune of text
+func runeOffset(text string, n int) int {
+	for i := range text {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(text)
+}
+
+// openEntity returns the markdown entity that's open at the end of text, "*", "_", "`",
+// "```" or "[" for a link, and where it starts
+func openEntity(text string) (string, int) {
+	var open string
+	var start int
+	for i := 0; i < len(text); i++ {
+		switch {
+		case open == "```":
+			if strings.HasPrefix(text[i:], "```") {
+				open = ""
+				i += 2
+			}
+		case open == "`":
+			if text[i] == '`' {
+				open = ""
+			}
+		case text[i] == '\\':
+			i++
+		case open == "[":
+			if text[i] == ')' {
+				open = ""
+			}
+		case open != "":
+			if text[i] == open[0] {
+				open = ""
+			}
+		case strings.HasPrefix(text[i:], "```"):
+			open, start = "```", i
+			i += 2
+		case text[i] == '`' || text[i] == '*' || text[i] == '_' || text[i] == '[':
+			open, start = text[i:i+1], i
+		}
+	}
+	return open, start
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// rememberChat adds chat to the chats that get the notifications, with the master who talked
+// there. they are kept in the state file so the notifications keep working after a restart.
+func rememberChat(chat int64, username string) {
+	username = strings.ToLower(username)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	var changed bool
+	if !containsChat(state.Chats, chat) {
+		state.Chats = append(state.Chats, chat)
+		changed = true
+	}
+
+	if state.ChatMasters == nil {
+		state.ChatMasters = make(map[int64][]string)
+	}
+	if username != "" && !containsString(state.ChatMasters[chat], username) {
+		state.ChatMasters[chat] = append(state.ChatMasters[chat], username)
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
+
+// notifyChats returns the chats that get the notifications, NotifyChat if it's set,
+// otherwise all the chats where a master talked to the bot. the chats of revoked masters
+// don't get them anymore.
+func notifyChats() []int64 {
+	configMu.RLock()
+	fixed := NotifyChat
+	configMu.RUnlock()
+	if fixed != 0 {
+		return []int64{fixed}
+	}
+
+	stateMu.Lock()
+	chats := append([]int64{}, state.Chats...)
+	masters := make(map[int64][]string, len(state.ChatMasters))
+	for chat, usernames := range state.ChatMasters {
+		masters[chat] = append([]string{}, usernames...)
+	}
+	stateMu.Unlock()
+
+	var active []int64
+	for _, chat := range chats {
+		// the chats from before the masters were recorded are kept
+		if len(masters[chat]) == 0 {
+			active = append(active, chat)
+			continue
+		}
+		for _, username := range masters[chat] {
+			if isMaster(username) {
+				active = append(active, chat)
+				break
+			}
+		}
+	}
+	return active
+}
+
+// containsChat returns true if chats has chat
+func containsChat(chats []int64, chat int64) bool {
+	for _, known := range chats {
+		if known == chat {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if list has s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// notify sends text to all the notification chats
+func notify(text string, markdown bool) {
+	for _, chat := range notifyChats() {
+		send(text, chat, markdown)
+	}
+}
+
+// notifyWithMarkup is like notify, with a keyboard under the message
+func notifyWithMarkup(text string, markup tgbotapi.InlineKeyboardMarkup) {
+	for _, chat := range notifyChats() {
+		msg := tgbotapi.NewMessage(chat, text)
+		msg.ReplyMarkup = markup
+		if _, err := botSend(msg); err != nil {
+			logger.Printf("[ERROR] Send: %s", err)
+		}
+	}
+}
+
+// mirrorCompletion posts a card about a completed torrent to Channel, so the channel
+// becomes a searchable archive of everything that finished. the bot must be an admin there.
+func mirrorCompletion(t *transmission.Torrent) {
+	configMu.RLock()
+	channel := Channel
+	configMu.RUnlock()
+	if channel == 0 {
+		return
+	}
+
+	took := "-"
+	if t.AddedDate > 0 {
+		took = time.Since(time.Unix(t.AddedDate, 0)).Round(time.Minute).String()
+	}
+
+	card := fmt.Sprintf("✅ *%s*\nSize: %s\nTook: %s\nFinished: %s",
+		mdReplacer.Replace(t.Name), chatLocale(0).bytes(t.SizeWhenDone), took, time.Now().Format("2006-01-02 15:04"))
+	if fields := customFields(t.ID); fields != "" {
+		card += "\n" + mdReplacer.Replace(fields)
+	}
+	send(card, channel, true)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strconv"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// maxPeers is the most peers listed, so the list fits in one message that can be kept live
+const maxPeers = 30
+
+// peers lists the peers a torrent is connected to, and keeps the list live like info
+func peers(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*peers:* needs a torrent ID", ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*peers:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	text, err := peersText(ud.Message.Chat.ID, id)
+	if err != nil {
+		sendErr("peers", err, ud.Message.Chat.ID)
+		return
+	}
+	msgID := send(text, ud.Message.Chat.ID, true)
+
+	if NoLive {
+		return
+	}
+
+	// peers aren't in the torrents of the ticks, they're fetched on each
+	render := func(transmission.Torrents) string {
+		text, err := peersText(ud.Message.Chat.ID, id)
+		if err != nil {
+			return "" // try again on the next one
+		}
+		return text
+	}
+	if err := startLive(ud.Message.Chat.ID, msgID, true, render, nil); err != nil {
+		sendErr("peers", err, ud.Message.Chat.ID)
+	}
+}
+
+// peersText formats the peers of the torrent with id for chat, the fastest first
+func peersText(chat int64, id int) (string, error) {
+	loc := chatLocale(chat)
+
+	torrent, err := getTorrentExtra(id, "name", "peers")
+	if err != nil {
+		return "", err
+	}
+
+	list := torrent.Peers
+	gosort.Slice(list, func(i, j int) bool {
+		return list[i].RateToClient+list[i].RateToPeer > list[j].RateToClient+list[j].RateToPeer
+	})
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%d peers\n\n", torrent.ID, mdReplacer.Replace(torrent.Name), len(list)))
+	if len(list) > maxPeers {
+		list = list[:maxPeers]
+	}
+	for _, peer := range list {
+		// the flags explain the connection, e.g. D = downloading from it, E = encrypted
+		buf.WriteString(fmt.Sprintf("`%s` %s (%.0f%%)\n↓ %s ↑ %s `%s`\n",
+			peer.Address, mdReplacer.Replace(peer.ClientName), peer.Progress*100,
+			loc.bytes(peer.RateToClient), loc.bytes(peer.RateToPeer), peer.FlagStr))
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+var (
+	// lastPoll is when a background loop last did its job successfully
+	lastPoll   time.Time
+	lastPollMu sync.Mutex
+)
+
+// markPoll records a successful run of a background loop
+func markPoll() {
+	lastPollMu.Lock()
+	lastPoll = time.Now()
+	lastPollMu.Unlock()
+}
+
+// ping reports the round trip time to transmission and telegram, and when the last background poll happened
+func ping(ud tgbotapi.Update) {
+	rpc := "error: "
+	begin := time.Now()
+	if err := rpcCall("session-stats", nil, nil); err != nil {
+		rpc += err.Error()
+	} else {
+		rpc = time.Since(begin).Round(time.Millisecond).String()
+	}
+
+	telegram := "error: "
+	begin = time.Now()
+	if _, err := Bot.GetMe(); err != nil {
+		telegram += err.Error()
+	} else {
+		telegram = time.Since(begin).Round(time.Millisecond).String()
+	}
+
+	poll := "never"
+	lastPollMu.Lock()
+	if !lastPoll.IsZero() {
+		poll = time.Since(lastPoll).Round(time.Second).String() + " ago"
+	}
+	lastPollMu.Unlock()
+
+	send(fmt.Sprintf("Transmission: %s\nTelegram: %s\nLast poll: %s", rpc, telegram, poll), ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// preallocCheck is how often a magnet's metadata is checked for, it's stopped as soon as its
+// size is known, before it got far enough to allocate much
+const preallocCheck = time.Second
+
+// the preallocation modes of transmission
+const (
+	preallocOff = iota
+	preallocSparse
+	preallocFull
+)
+
+// preallocModes are the names of the preallocation modes
+var preallocModes = []string{"off", "sparse", "full"}
+
+// prealloc shows or sets how transmission allocates the files of new torrents, "full" writes
+// them out completely before downloading, which keeps a disk busy for a long time on big torrents.
+func prealloc(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		session, err := sessionGet()
+		if err != nil {
+			sendErr("prealloc", err, ud.Message.Chat.ID)
+			return
+		}
+		send("*prealloc:* "+preallocName(session.Preallocation), ud.Message.Chat.ID, false)
+		return
+	}
+
+	mode := -1
+	for i, name := range preallocModes {
+		if strings.ToLower(tokens[0]) == name {
+			mode = i
+		}
+	}
+	if mode == -1 {
+		send("*prealloc:* takes off, sparse or full", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if err := sessionSet(map[string]interface{}{"preallocation": mode}); err != nil {
+		sendErr("prealloc", err, ud.Message.Chat.ID)
+		return
+	}
+	send("*prealloc:* "+preallocModes[mode], ud.Message.Chat.ID, false)
+}
+
+// preallocName is the name of mode, transmission might have modes this doesn't know
+func preallocName(mode int) string {
+	if mode < 0 || mode >= len(preallocModes) {
+		return strconv.Itoa(mode)
+	}
+	return preallocModes[mode]
+}
+
+// preallocGuard returns true if new torrents should be added paused to check their size first,
+// transmission allocates the files when a torrent starts so a paused one is harmless.
+func preallocGuard() bool {
+	configMu.RLock()
+	limit := PreallocWarn
+	configMu.RUnlock()
+
+	if limit == 0 {
+		return false
+	}
+
+	session, err := sessionGet()
+	if err != nil {
+		return false
+	}
+	return session.Preallocation == preallocFull
+}
+
+// checkPrealloc starts a torrent that preallocGuard had added paused, unless it's bigger than
+// PreallocWarn, then it asks whether to switch to sparse files first.
+func checkPrealloc(chat int64, id int) {
+	configMu.RLock()
+	limit := PreallocWarn
+	configMu.RUnlock()
+
+	torrent, err := getTorrentExtra(id, "name", "totalSize", "metadataPercentComplete", "hashString")
+	if err != nil {
+		sendErr("add", err, chat)
+		return
+	}
+
+	if torrent.MetadataPercentComplete == 1 && torrent.TotalSize <= limit {
+		if err := rpcCall("torrent-start", map[string]interface{}{"ids": []int{id}}, nil); err != nil {
+			sendErr("add", err, chat)
+		}
+		return
+	}
+
+	// magnets have no size until they get the metadata, which they only get while started,
+	// the files are only allocated once it's there.
+	if torrent.MetadataPercentComplete < 1 {
+		if err := rpcCall("torrent-start", map[string]interface{}{"ids": []int{id}}, nil); err != nil {
+			sendErr("add", err, chat)
+			return
+		}
+
+		for start := time.Now(); torrent.MetadataPercentComplete < 1; time.Sleep(preallocCheck) {
+			if time.Since(start) > confirmSizeWait {
+				if err := rpcCall("torrent-stop", map[string]interface{}{"ids": []int{id}}, nil); err != nil {
+					sendErr("add", err, chat)
+					return
+				}
+				send(fmt.Sprintf("*add:* %s got no metadata in %s, it's stopped so it can't be preallocated unchecked",
+					torrent.Name, confirmSizeWait), chat, false)
+				return
+			}
+
+			if torrent, err = getTorrentExtra(id, "name", "totalSize", "metadataPercentComplete", "hashString"); err != nil {
+				return // removed
+			}
+		}
+
+		if torrent.TotalSize <= limit {
+			return
+		}
+		if err := rpcCall("torrent-stop", map[string]interface{}{"ids": []int{id}}, nil); err != nil {
+			sendErr("add", err, chat)
+			return
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chat, fmt.Sprintf("%s is %s and files are fully preallocated, "+
+		"writing it out first will keep the disk busy for a long time. It's paused until you choose.",
+		torrent.Name, chatLocale(chat).bytes(torrent.TotalSize)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Switch to sparse and start", "prealloc:sparse:"+strings.ToLower(torrent.HashString)),
+			tgbotapi.NewInlineKeyboardButtonData("Start anyway", "prealloc:start:"+strings.ToLower(torrent.HashString)),
+		),
+	)
+	if _, err := botSend(msg); err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+	}
+}
+
+// preallocCallback handles the buttons of checkPrealloc
+func preallocCallback(cq *tgbotapi.CallbackQuery, args []string) {
+	if !isMaster(cq.From.UserName) {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Only masters can do that"))
+		return
+	}
+
+	if len(args) != 2 {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Invalid request"))
+		return
+	}
+
+	// the button may be from before a restart, the hash makes sure it's still the same torrent
+	torrent, err := getTorrentByHash(args[1])
+	if err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+
+	text := "Started, with full preallocation"
+	if args[0] == "sparse" {
+		if err := sessionSet(map[string]interface{}{"preallocation": preallocSparse}); err != nil {
+			Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+			return
+		}
+		text = "Switched to sparse files and started"
+	}
+
+	if err := rpcCall("torrent-start", map[string]interface{}{"ids": []int{torrent.ID}}, nil); err != nil {
+		Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, err.Error()))
+		return
+	}
+	Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "Started"))
+	botSend(tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, text))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// preset is a named bundle of session settings from the config, unset fields are left untouched
+type preset struct {
+	DownLimit     *int  `yaml:"downlimit"` // KB/s, 0 for unlimited
+	UpLimit       *int  `yaml:"uplimit"`   // KB/s, 0 for unlimited
+	Turtle        *bool `yaml:"turtle"`
+	DownloadQueue *int  `yaml:"download_queue"` // 0 to disable the queue
+	SeedQueue     *int  `yaml:"seed_queue"`     // 0 to disable the queue
+
+	// Session holds any other session-set field as is, e.g. "peer-limit-global: 200"
+	Session map[string]interface{} `yaml:"session"`
+}
+
+// fields returns the preset as session-set arguments
+func (p preset) fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for k, v := range p.Session {
+		fields[k] = v
+	}
+
+	if p.DownLimit != nil {
+		fields["speed-limit-down-enabled"] = *p.DownLimit > 0
+		if *p.DownLimit > 0 {
+			fields["speed-limit-down"] = *p.DownLimit
+		}
+	}
+	if p.UpLimit != nil {
+		fields["speed-limit-up-enabled"] = *p.UpLimit > 0
+		if *p.UpLimit > 0 {
+			fields["speed-limit-up"] = *p.UpLimit
+		}
+	}
+	if p.Turtle != nil {
+		fields["alt-speed-enabled"] = *p.Turtle
+	}
+	if p.DownloadQueue != nil {
+		fields["download-queue-enabled"] = *p.DownloadQueue > 0
+		if *p.DownloadQueue > 0 {
+			fields["download-queue-size"] = *p.DownloadQueue
+		}
+	}
+	if p.SeedQueue != nil {
+		fields["seed-queue-enabled"] = *p.SeedQueue > 0
+		if *p.SeedQueue > 0 {
+			fields["seed-queue-size"] = *p.SeedQueue
+		}
+	}
+	return fields
+}
+
+// Presets are loaded from the config file, name => preset
+var Presets map[string]preset
+
+// applyPreset takes a preset's name and applies its settings, lists the presets without arguments
+func applyPreset(ud tgbotapi.Update, tokens []string) {
+	configMu.RLock()
+	presets := Presets
+	configMu.RUnlock()
+
+	if len(tokens) == 0 {
+		if len(presets) == 0 {
+			send("*preset:* no presets, define them under _presets_ in the config file", ud.Message.Chat.ID, true)
+			return
+		}
+
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		gosort.Strings(names)
+
+		buf := new(bytes.Buffer)
+		for _, name := range names {
+			buf.WriteString(name + "\n")
+		}
+		send(buf.String(), ud.Message.Chat.ID, false)
+		return
+	}
+
+	name := strings.ToLower(tokens[0])
+	p, ok := presets[name]
+	if !ok {
+		send(fmt.Sprintf("*preset:* no preset named %s", name), ud.Message.Chat.ID, false)
+		return
+	}
+
+	if err := sessionSet(p.fields()); err != nil {
+		sendErr("preset", err, ud.Message.Chat.ID)
+		return
+	}
+	send("*preset:* switched to "+name, ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// verifyWatchFailures is how many times in a row watchVerify can fail to get the torrents
+// before it gives up
+const verifyWatchFailures = 5
+
+// progress is a message that keeps getting edited to show the progress of a long operation
+type progress struct {
+	chat   int64
+	msgID  int
+	label  string
+	edited time.Time
+}
+
+// newProgress sends the initial progress message, e.g. "Verifying 0/87…"
+func newProgress(chat int64, label string, total int) *progress {
+	p := &progress{chat: chat, label: label, edited: time.Now()}
+	p.msgID = send(fmt.Sprintf("%s 0/%d…", label, total), chat, false)
+	return p
+}
+
+// update edits the message with the current progress, it edits at most once every 2 seconds
+// to stay below telegram's limits.
+func (p *progress) update(done, total int) {
+	if time.Since(p.edited) < 2*time.Second {
+		return
+	}
+	p.edited = time.Now()
+
+	botSend(tgbotapi.NewEditMessageText(p.chat, p.msgID, fmt.Sprintf("%s %d/%d…", p.label, done, total)))
+}
+
+// finish replaces the progress message with text. text that's too long for one message, or
+// that can't be edited in, goes in new messages and the progress message just says it's done.
+func (p *progress) finish(text string) {
+	if p.msgID != 0 && utf8.RuneCountInString(text) <= messageRunes {
+		_, err := botSend(tgbotapi.NewEditMessageText(p.chat, p.msgID, text))
+		if err == nil || strings.Contains(err.Error(), "message is not modified") {
+			return
+		}
+	}
+
+	if p.msgID != 0 {
+		botSend(tgbotapi.NewEditMessageText(p.chat, p.msgID, p.label+" done"))
+	}
+	send(text, p.chat, false)
+}
+
+// watchVerify keeps a progress message updated until no torrent is verifying or waiting to
+func watchVerify(chat int64, total int) {
+	ctx, finish := startOp(chat)
+	defer finish()
+
+	p := newProgress(chat, "Verifying", total)
+
+	var failures int
+	for {
+		every, _ := liveTiming()
+		select {
+		case <-ctx.Done():
+			p.finish("Stopped watching the verification, it goes on in transmission")
+			return
+		case <-time.After(every):
+		}
+
+		torrents, err := getTorrents(statsFields...)
+		if err != nil {
+			// try again if some error heppened, but not forever
+			if failures++; failures >= verifyWatchFailures {
+				p.finish("Stopped watching the verification, transmission isn't answering: " + err.Error())
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		var verifying int
+		for i := range torrents {
+			if isChecking(torrents[i]) {
+				verifying++
+			}
+		}
+
+		if verifying == 0 {
+			p.finish(fmt.Sprintf("Verified %d torrents", total))
+			return
+		}
+		p.update(total-verifying, total)
+	}
+}
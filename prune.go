@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// orphanAge is how old a file has to be to be an orphan, transmission writes the files of
+	// a torrent that is being added before it lists it.
+	orphanAge = 10 * time.Minute
+
+	// pruneCheck is how often the disabled pruning checks whether it got enabled by a reload
+	pruneCheck = time.Hour
+)
+
+// orphan is a .torrent or .resume file of a torrent that transmission doesn't have anymore
+type orphan struct {
+	path string
+	hash string
+	size int64
+}
+
+// findOrphans returns the files in TransDir's torrents and resume folders that don't
+// belong to any of transmission's torrents.
+func findOrphans() ([]orphan, error) {
+	configMu.RLock()
+	dir := TransDir
+	configMu.RUnlock()
+
+	if dir == "" {
+		return nil, fmt.Errorf("transmission's config dir is not set, see -transmission-dir")
+	}
+
+	hashes, err := torrentHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []orphan
+	for sub, ext := range map[string]string{"torrents": ".torrent", "resume": ".resume"} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, sub))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ext) || time.Since(file.ModTime()) < orphanAge {
+				continue
+			}
+
+			hash := fileHash(strings.TrimSuffix(file.Name(), ext))
+			if hash == "" || hasHash(hashes, hash) {
+				continue
+			}
+			orphans = append(orphans, orphan{path: filepath.Join(dir, sub, file.Name()), hash: hash, size: file.Size()})
+		}
+	}
+	return orphans, nil
+}
+
+// torrentHashes returns the lower case info hashes of transmission's torrents
+func torrentHashes() (map[string]bool, error) {
+	torrents, err := getTorrentFields(nil, "hashString")
+	if err != nil {
+		return nil, err
+	}
+	// an empty or failing transmission would look like every file is orphaned
+	if len(torrents) == 0 {
+		return nil, fmt.Errorf("transmission has no torrents, not pruning anything")
+	}
+
+	hashes := make(map[string]bool)
+	for _, torrent := range torrents {
+		hashes[strings.ToLower(torrent.HashString)] = true
+	}
+	return hashes, nil
+}
+
+// fileHash returns the info hash, or its first 16 characters, that transmission names
+// its files by: "<hash>.torrent" since 4.0 and "<name>.<hash[:16]>.torrent" before it.
+func fileHash(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(name)
+
+	if len(name) != 40 && len(name) != 16 {
+		return ""
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+	return name
+}
+
+// hasHash returns true if hash, full or a prefix, is one of hashes
+func hasHash(hashes map[string]bool, hash string) bool {
+	if len(hash) == 40 {
+		return hashes[hash]
+	}
+	for h := range hashes {
+		if strings.HasPrefix(h, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOrphans deletes orphans, it returns how many were deleted and the space reclaimed.
+// the hashes are checked again right before, in case one of them got added back meanwhile.
+func removeOrphans(orphans []orphan) (int, uint64, error) {
+	var (
+		n     int
+		freed uint64
+	)
+
+	hashes, err := torrentHashes()
+	if err != nil {
+		return n, freed, err
+	}
+
+	for _, o := range orphans {
+		if hasHash(hashes, o.hash) {
+			continue
+		}
+		if err := os.Remove(o.path); err != nil {
+			return n, freed, err
+		}
+		n++
+		freed += uint64(o.size)
+	}
+	return n, freed, nil
+}
+
+// prune lists the orphaned .torrent and .resume files, "prune delete" deletes them
+func prune(ud tgbotapi.Update, tokens []string) {
+	orphans, err := findOrphans()
+	if err != nil {
+		sendErr("prune", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if len(orphans) == 0 {
+		send("*prune:* no orphaned files", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) > 0 && strings.ToLower(tokens[0]) == "delete" {
+		n, freed, err := removeOrphans(orphans)
+		if err != nil {
+			send(fmt.Sprintf("*prune:* deleted %d files before failing: %s", n, err), ud.Message.Chat.ID, false)
+			return
+		}
+		send(fmt.Sprintf("*prune:* deleted %d files, reclaimed %s", n, chatLocale(ud.Message.Chat.ID).bytes(freed)), ud.Message.Chat.ID, false)
+		return
+	}
+
+	var size uint64
+	buf := new(bytes.Buffer)
+	for _, o := range orphans {
+		size += uint64(o.size)
+		buf.WriteString(filepath.Base(o.path) + "\n")
+	}
+	buf.WriteString(fmt.Sprintf("\n%d orphaned files, %s. Send \"prune delete\" to delete them.", len(orphans), chatLocale(ud.Message.Chat.ID).bytes(size)))
+	send(buf.String(), ud.Message.Chat.ID, false)
+}
+
+var pruneOnce sync.Once
+
+// startPrune starts pruning the orphaned files every PruneInterval if it's set, only once
+func startPrune() {
+	configMu.RLock()
+	enabled := PruneInterval > 0 && TransDir != ""
+	configMu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	pruneOnce.Do(func() {
+		go runLoop("prune", func() time.Duration {
+			configMu.RLock()
+			defer configMu.RUnlock()
+
+			// disabled by a reload, a zero interval would spin
+			if PruneInterval <= 0 {
+				return pruneCheck
+			}
+			return PruneInterval
+		}, autoPrune)
+	})
+}
+
+// autoPrune deletes the orphaned files and tells the masters about it
+func autoPrune() error {
+	configMu.RLock()
+	enabled := PruneInterval > 0
+	configMu.RUnlock()
+
+	// disabled by a reload
+	if !enabled {
+		return nil
+	}
+
+	orphans, err := findOrphans()
+	if err != nil || len(orphans) == 0 {
+		return err
+	}
+
+	n, freed, err := removeOrphans(orphans)
+	if n > 0 {
+		notify(fmt.Sprintf("🧹 Pruned %d orphaned .torrent/.resume files, reclaimed %s", n, chatLocale(0).bytes(freed)), false)
+	}
+	return err
+}
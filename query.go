@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	// maxQueryLen is the longest query list and search accept
+	maxQueryLen = 256
+
+	// maxQueryInsts caps the size of a compiled query, a{1000}{1000} style patterns blow up
+	maxQueryInsts = 5000
+)
+
+// compileQuery compiles a user's query into a case insensitive regexp, go's regexp
+// matches in linear time, so limiting the size of the pattern is enough to bound the work.
+func compileQuery(query string) (*regexp.Regexp, error) {
+	if len(query) > maxQueryLen {
+		return nil, fmt.Errorf("the query is too long, the limit is %d characters", maxQueryLen)
+	}
+
+	re, err := syntax.Parse("(?i)"+query, syntax.Perl)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, queryError(err)
+	}
+	if len(prog.Inst) > maxQueryInsts {
+		return nil, fmt.Errorf("the query is too complex, try something simpler")
+	}
+
+	regx, err := regexp.Compile("(?i)" + query)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return regx, nil
+}
+
+// queryError makes the regexp errors readable for someone who didn't mean to write a regexp,
+// e.g. "missing closing ): `(1080p`".
+func queryError(err error) error {
+	if serr, ok := err.(*syntax.Error); ok {
+		return fmt.Errorf("invalid query, %s: %s (use \\ before characters like ( [ + * ?)",
+			serr.Code, strings.TrimPrefix(serr.Expr, "(?i)"))
+	}
+	return err
+}
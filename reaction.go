@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// maxCards is how many info cards are remembered for the reactions, the oldest are forgotten first
+const maxCards = 1000
+
+// allowedUpdates are the updates asked from telegram, message_reaction only comes when it's asked for
+var allowedUpdates = []string{"message", "edited_message", "channel_post", "edited_channel_post",
+	"inline_query", "chosen_inline_result", "callback_query", "message_reaction"}
+
+// defaultReactions are used without a 'reactions' in the config. telegram's reactions don't
+// have ⏸ and 🗑 unless they're custom emoji, so 😴 and 💔 do the same.
+var defaultReactions = map[string]string{
+	"👍": "start",
+	"⏸": "stop",
+	"😴": "stop",
+	"🗑": "del",
+	"💔": "del",
+}
+
+// Reactions are loaded from the config file, emoji => start, stop, del or deldata
+var Reactions map[string]string
+
+// cardKey is an info card, a message in a chat
+type cardKey struct {
+	chat int64
+	msg  int
+}
+
+var (
+	// cards are the torrent IDs of the info cards, so reacting to one knows what to act on
+	cards      = make(map[cardKey]int)
+	cardsOrder []cardKey
+	cardsMu    sync.Mutex
+)
+
+var (
+	// threads are the topics of the messages sent in one, telegram-bot-api.v4 doesn't know
+	// message_thread_id either
+	threads      = make(map[cardKey]int)
+	threadsOrder []cardKey
+	threadsMu    sync.Mutex
+)
+
+// messageReaction is telegram's message_reaction update, which telegram-bot-api.v4 doesn't know
+type messageReaction struct {
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	MessageID   int             `json:"message_id"`
+	User        *tgbotapi.User  `json:"user"`
+	OldReaction []reactionEmoji `json:"old_reaction"`
+	NewReaction []reactionEmoji `json:"new_reaction"`
+}
+
+// reactionEmoji is a reaction, Emoji is empty for the custom ones
+type reactionEmoji struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji"`
+}
+
+// getUpdatesChan is Bot.GetUpdatesChan, but it asks for the reactions too and handles them
+// itself, the other updates go to the channel.
+func getUpdatesChan(timeout int) <-chan tgbotapi.Update {
+	updates := make(chan tgbotapi.Update, 100)
+	allowed, _ := json.Marshal(allowedUpdates)
+
+	go func() {
+		var offset int
+		for {
+			params := url.Values{}
+			params.Set("offset", strconv.Itoa(offset))
+			params.Set("timeout", strconv.Itoa(timeout))
+			params.Set("allowed_updates", string(allowed))
+
+			resp, err := Bot.MakeRequest("getUpdates", params)
+			if err != nil {
+				logger.Printf("[ERROR] Telegram: %s", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+
+			var raws []json.RawMessage
+			if err := json.Unmarshal(resp.Result, &raws); err != nil {
+				logger.Printf("[ERROR] Telegram: %s", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+
+			for _, raw := range raws {
+				var extra struct {
+					UpdateID        int              `json:"update_id"`
+					MessageReaction *messageReaction `json:"message_reaction"`
+					Message         *struct {
+						MessageID int `json:"message_id"`
+						Chat      struct {
+							ID int64 `json:"id"`
+						} `json:"chat"`
+						ThreadID int `json:"message_thread_id"`
+					} `json:"message"`
+				}
+				if err := json.Unmarshal(raw, &extra); err != nil {
+					logger.Printf("[ERROR] Telegram: %s", err)
+					continue
+				}
+				if extra.UpdateID >= offset {
+					offset = extra.UpdateID + 1
+				}
+
+				if extra.MessageReaction != nil {
+					go reaction(extra.MessageReaction)
+					continue
+				}
+				if m := extra.Message; m != nil && m.ThreadID != 0 {
+					rememberThread(m.Chat.ID, m.MessageID, m.ThreadID)
+				}
+
+				var update tgbotapi.Update
+				if err := json.Unmarshal(raw, &update); err != nil {
+					logger.Printf("[ERROR] Telegram: %s", err)
+					continue
+				}
+				updates <- update
+			}
+		}
+	}()
+
+	return updates
+}
+
+// rememberCard records that msg in chat is the info card of the torrent with id
+func rememberCard(chat int64, msg, id int) {
+	if msg == 0 {
+		return
+	}
+
+	cardsMu.Lock()
+	defer cardsMu.Unlock()
+
+	key := cardKey{chat, msg}
+	if _, ok := cards[key]; !ok {
+		cardsOrder = append(cardsOrder, key)
+	}
+	cards[key] = id
+
+	if len(cardsOrder) > maxCards {
+		delete(cards, cardsOrder[0])
+		cardsOrder = cardsOrder[1:]
+	}
+}
+
+// rememberThread records that msg in chat was sent in the topic thread
+func rememberThread(chat int64, msg, thread int) {
+	threadsMu.Lock()
+	defer threadsMu.Unlock()
+
+	key := cardKey{chat, msg}
+	if _, ok := threads[key]; !ok {
+		threadsOrder = append(threadsOrder, key)
+	}
+	threads[key] = thread
+
+	if len(threadsOrder) > maxCards {
+		delete(threads, threadsOrder[0])
+		threadsOrder = threadsOrder[1:]
+	}
+}
+
+// messageThread returns the topic msg was sent in, 0 outside of topics
+func messageThread(chat int64, msg int) int {
+	threadsMu.Lock()
+	defer threadsMu.Unlock()
+	return threads[cardKey{chat, msg}]
+}
+
+// reactionCommand returns the command that emoji runs, if any
+func reactionCommand(emoji string) (string, bool) {
+	configMu.RLock()
+	mapping := Reactions
+	configMu.RUnlock()
+	if mapping == nil {
+		mapping = defaultReactions
+	}
+
+	// "❤️" and "❤" are the same reaction, telegram sends it without the variation selector
+	emoji = strings.Replace(emoji, "\ufe0f", "", -1)
+	for e, cmd := range mapping {
+		if strings.Replace(e, "\ufe0f", "", -1) == emoji {
+			return strings.ToLower(cmd), true
+		}
+	}
+	return "", false
+}
+
+// reaction runs the command of the emojis that were added to an info card
+func reaction(r *messageReaction) {
+	// anonymous reactions don't say who reacted
+	if r.User == nil || !isMaster(r.User.UserName) {
+		return
+	}
+
+	cardsMu.Lock()
+	id, ok := cards[cardKey{r.Chat.ID, r.MessageID}]
+	cardsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	old := make(map[string]bool)
+	for _, e := range r.OldReaction {
+		old[e.Emoji] = true
+	}
+
+	for _, e := range r.NewReaction {
+		if e.Type != "emoji" || old[e.Emoji] {
+			continue
+		}
+		cmd, ok := reactionCommand(e.Emoji)
+		if !ok {
+			continue
+		}
+		reactionAction(r.Chat.ID, id, cmd)
+	}
+}
+
+// reactionAction runs cmd on the torrent with id, deletes always ask first
+func reactionAction(chat int64, id int, cmd string) {
+	switch cmd {
+	case "start", "stop":
+		var status string
+		var err error
+		if cmd == "start" {
+			status, err = rpcClient().StartTorrent(id)
+		} else {
+			status, err = rpcClient().StopTorrent(id)
+		}
+		if err != nil {
+			sendErr(cmd, err, chat)
+			return
+		}
+
+		torrent, err := rpcClient().GetTorrent(id)
+		if err != nil {
+			send(fmt.Sprintf("[fail] *%s:* No torrent with an ID of %d", cmd, id), chat, false)
+			return
+		}
+		send(fmt.Sprintf("[%s] *%s:* %s", status, cmd, torrent.Name), chat, false)
+	case "del", "deldata":
+		confirmDelete(chat, []int{id}, cmd, cmd == "deldata", true, false)
+	default:
+		logger.Printf("[ERROR] Reactions: unknown command %q", cmd)
+	}
+}
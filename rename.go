@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// rename renames a torrent, "rename <id> <new name>"
+func rename(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) < 2 {
+		send("*rename:* needs a torrent ID and a new name", ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*rename:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrent, err := getTorrentExtra(id, "name")
+	if err != nil {
+		sendErr("rename", err, ud.Message.Chat.ID)
+		return
+	}
+
+	name := strings.Join(tokens[1:], " ")
+	if err := renamePath(id, torrent.Name, name); err != nil {
+		sendErr("rename", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("Renamed %s to %s", torrent.Name, name), ud.Message.Chat.ID, false)
+}
+
+// renamefile renames a file or folder inside a torrent, "renamefile <id> <path> <new name>",
+// path can also be the file's number as shown by 'files', for paths with spaces.
+func renamefile(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) < 3 {
+		send("*renamefile:* needs a torrent ID, a path or file number, and a new name", ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*renamefile:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	path := tokens[1]
+	if n, err := strconv.Atoi(path); err == nil {
+		torrent, err := getTorrentExtra(id, "files")
+		if err != nil {
+			sendErr("renamefile", err, ud.Message.Chat.ID)
+			return
+		}
+		if n < 1 || n > len(torrent.Files) {
+			send(fmt.Sprintf("*renamefile:* no file number %d", n), ud.Message.Chat.ID, false)
+			return
+		}
+		path = torrent.Files[n-1].Name
+	}
+
+	name := strings.Join(tokens[2:], " ")
+	if err := renamePath(id, path, name); err != nil {
+		sendErr("renamefile", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("Renamed %s to %s", path, name), ud.Message.Chat.ID, false)
+}
+
+// renamePath renames the last part of path inside the torrent with id to name
+func renamePath(id int, path, name string) error {
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("the new name can't have a /")
+	}
+
+	args := map[string]interface{}{
+		"ids":  []int{id},
+		"path": path,
+		"name": name,
+	}
+	return rpcCall("torrent-rename-path", args, nil)
+}
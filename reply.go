@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// replyIDRegex matches the "<id> name" lines of the bot's messages, the listings and the rest
+var replyIDRegex = regexp.MustCompile(`(?m)^<(\d+)>`)
+
+// replyCommands are the commands that act on the torrents of the message they reply to, the
+// ones that take a single torrent are true
+var replyCommands = map[string]bool{
+	"stop": false, "sp": false,
+	"start": false, "st": false,
+	"check": false, "ck": false,
+	"del": false, "rm": false,
+	"deldata": false,
+	"info":    true, "in": true,
+	"files": true, "fi": true,
+	"peers": true, "pe": true,
+	"detail": true,
+	"magnet": true,
+	"source": true,
+	"swarm":  true,
+}
+
+// replyDeletes are the reply commands that need the numbers of the torrents
+var replyDeletes = map[string]bool{"del": true, "rm": true, "deldata": true}
+
+// replyTargets fills in the IDs when a command replies to a message of the bot with torrents
+// in it, "stop" takes all of them and "del 2" the second one, so they don't have to be typed
+// again. the tokens are left as they are for anything else.
+func replyTargets(ud tgbotapi.Update, command string, tokens []string) ([]string, error) {
+	reply := ud.Message.ReplyToMessage
+	if reply == nil || reply.From == nil || reply.From.ID != Bot.Self.ID {
+		return tokens, nil
+	}
+
+	single, ok := replyCommands[strings.TrimPrefix(command, "/")]
+	if !ok {
+		return tokens, nil
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, sm := range replyIDRegex.FindAllStringSubmatch(reply.Text, -1) {
+		if !seen[sm[1]] {
+			seen[sm[1]] = true
+			ids = append(ids, sm[1])
+		}
+	}
+	if len(ids) == 0 {
+		return tokens, nil
+	}
+
+	// the numbers are the positions in the message, the rest is kept, e.g. "del 2 after:seedtarget".
+	// the ones that take a single torrent only take the first, e.g. "files 2 want 3 5-9".
+	var picked, rest []string
+	for i, token := range tokens[1:] {
+		n, err := strconv.Atoi(token)
+		if err != nil || (single && i > 0) {
+			rest = append(rest, token)
+			continue
+		}
+		if n < 1 || n > len(ids) {
+			return nil, fmt.Errorf("there's no torrent %d in that message, it has %d", n, len(ids))
+		}
+		picked = append(picked, ids[n-1])
+	}
+	if len(picked) == 0 {
+		// a bare "del" would take a whole listing along, the deletes need the numbers
+		if name := strings.TrimPrefix(command, "/"); len(ids) > 1 && replyDeletes[name] {
+			return nil, fmt.Errorf("which ones? e.g. %s 2 3", name)
+		}
+		picked = ids
+	}
+
+	if single && len(picked) > 1 {
+		return nil, fmt.Errorf("which one? e.g. %s 2", strings.TrimPrefix(command, "/"))
+	}
+
+	return append(append([]string{tokens[0]}, picked...), rest...), nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strings"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// reportCheck is how often watchReports checks if a report is due
+const reportCheck = time.Minute
+
+// reportMark is where the last report left off
+type reportMark struct {
+	Time time.Time `json:"time"`
+	Up   uint64    `json:"up"`   // transmission's cumulative uploaded bytes at the time
+	Down uint64    `json:"down"` // and downloaded
+}
+
+// reportSchedule is a parsed "daily 09:00" or "weekly 09:00", weekly reports go out on mondays
+type reportSchedule struct {
+	weekly       bool
+	hour, minute int
+}
+
+// parseReportSchedule parses s, "off" and "" are a nil schedule
+func parseReportSchedule(s string) (*reportSchedule, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || fields[0] == "off" {
+		return nil, nil
+	}
+
+	sched := &reportSchedule{hour: 9}
+	switch fields[0] {
+	case "daily":
+	case "weekly":
+		sched.weekly = true
+	default:
+		return nil, fmt.Errorf("%q is not daily, weekly or off", fields[0])
+	}
+
+	if len(fields) > 1 {
+		at, err := time.Parse("15:04", fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a time like 09:00", fields[1])
+		}
+		sched.hour, sched.minute = at.Hour(), at.Minute()
+	}
+	return sched, nil
+}
+
+// next is the first time the report is due after t
+func (r *reportSchedule) next(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), r.hour, r.minute, 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	for r.weekly && next.Weekday() != time.Monday {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (r *reportSchedule) String() string {
+	every := "daily"
+	if r.weekly {
+		every = "weekly, on mondays,"
+	}
+	return fmt.Sprintf("%s at %02d:%02d", every, r.hour, r.minute)
+}
+
+// currentReportSchedule is the schedule set with 'report', or -report when there's none
+func currentReportSchedule() (*reportSchedule, error) {
+	stateMu.Lock()
+	s := state.Report
+	stateMu.Unlock()
+
+	if s == "" {
+		configMu.RLock()
+		s = Report
+		configMu.RUnlock()
+	}
+	return parseReportSchedule(s)
+}
+
+// report sends the report now, or sets its schedule, e.g. "report daily 09:00" or "report off"
+func report(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		stateMu.Lock()
+		since := state.LastReport
+		stateMu.Unlock()
+
+		text, _, err := buildReport(chatLocale(ud.Message.Chat.ID), since)
+		if err != nil {
+			sendErr("report", err, ud.Message.Chat.ID)
+			return
+		}
+		send(text, ud.Message.Chat.ID, true)
+		return
+	}
+
+	schedule := strings.Join(tokens, " ")
+	sched, err := parseReportSchedule(schedule)
+	if err != nil {
+		sendErr("report", err, ud.Message.Chat.ID)
+		return
+	}
+
+	stateMu.Lock()
+	state.Report = strings.ToLower(schedule)
+	if sched != nil && state.LastReport.Time.IsZero() {
+		// the first report covers the time since it got scheduled
+		state.LastReport = reportMark{Time: time.Now()}
+		if stats, err := rpcClient().GetStats(); err == nil {
+			state.LastReport.Up = stats.CumulativeStats.UploadedBytes
+			state.LastReport.Down = stats.CumulativeStats.DownloadedBytes
+		}
+	}
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		sendErr("report", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if sched == nil {
+		send("Reports are off", ud.Message.Chat.ID, false)
+		return
+	}
+	send(fmt.Sprintf("Sending a report %s, next one %s", sched, sched.next(time.Now()).Format("Mon Jan 2 15:04")),
+		ud.Message.Chat.ID, false)
+}
+
+// watchReports sends the report to the notification chats whenever it's due
+func watchReports() {
+	runLoop("report", func() time.Duration { return reportCheck }, func() error {
+		sched, err := currentReportSchedule()
+		if err != nil || sched == nil {
+			return err
+		}
+
+		stateMu.Lock()
+		since := state.LastReport
+		stateMu.Unlock()
+
+		// scheduled through the config, start counting now
+		if since.Time.IsZero() {
+			_, mark, err := buildReport(chatLocale(0), since)
+			if err != nil {
+				return err
+			}
+			return saveReportMark(mark)
+		}
+
+		if time.Now().Before(sched.next(since.Time)) {
+			return nil
+		}
+
+		text, mark, err := buildReport(chatLocale(0), since)
+		if err != nil {
+			return err
+		}
+		if err := saveReportMark(mark); err != nil {
+			return err
+		}
+		notify(text, true)
+		return nil
+	})
+}
+
+// saveReportMark persists where the last report left off
+func saveReportMark(mark reportMark) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	state.LastReport = mark
+	return saveState()
+}
+
+// buildReport summarizes what happened since the last report: the completed torrents, the data
+// transferred, the current counts, the free space and the errors. it returns the mark for the next one.
+func buildReport(loc locale, since reportMark) (string, reportMark, error) {
+	stats, err := rpcClient().GetStats()
+	if err != nil {
+		return "", reportMark{}, err
+	}
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		return "", reportMark{}, err
+	}
+
+	mark := reportMark{
+		Time: time.Now(),
+		Up:   stats.CumulativeStats.UploadedBytes,
+		Down: stats.CumulativeStats.DownloadedBytes,
+	}
+
+	buf := new(bytes.Buffer)
+	if since.Time.IsZero() {
+		buf.WriteString("*Report*\n\n")
+	} else {
+		buf.WriteString(fmt.Sprintf("*Report since %s*\n\n", loc.time(since.Time)))
+	}
+
+	// the cumulative stats start over when transmission's stats get reset
+	up, down := mark.Up, mark.Down
+	if up >= since.Up && down >= since.Down {
+		up, down = up-since.Up, down-since.Down
+	}
+	if !since.Time.IsZero() {
+		buf.WriteString(fmt.Sprintf("Downloaded: *%s*\nUploaded: *%s*\n\n", loc.bytes(down), loc.bytes(up)))
+	}
+
+	var completed []torrentRecord
+	err = historyEach(func(hash string, record torrentRecord) {
+		if !since.Time.IsZero() && record.Done > since.Time.Unix() {
+			completed = append(completed, record)
+		}
+	})
+	if err != nil {
+		return "", reportMark{}, err
+	}
+	gosort.Slice(completed, func(i, j int) bool { return completed[i].Done < completed[j].Done })
+
+	if len(completed) > 0 {
+		buf.WriteString(fmt.Sprintf("_Completed %d_\n", len(completed)))
+		for _, record := range completed {
+			buf.WriteString(fmt.Sprintf("%s (%s)\n", mdReplacer.Replace(record.Name), loc.bytes(record.Size)))
+		}
+		buf.WriteString("\n")
+	}
+
+	var downloading, seeding, paused int
+	var errored []string
+	for i := range torrents {
+		switch {
+		case isDownloading(torrents[i]):
+			downloading++
+		case isSeeding(torrents[i]):
+			seeding++
+		case isPaused(torrents[i]):
+			paused++
+		}
+		if hasError(torrents[i]) {
+			errored = append(errored, fmt.Sprintf("`<%d>` %s: %s", torrents[i].ID,
+				mdReplacer.Replace(torrents[i].Name), mdReplacer.Replace(torrents[i].ErrorString)))
+		}
+	}
+	buf.WriteString(fmt.Sprintf("Torrents: *%d*, downloading *%d*, seeding *%d*, paused *%d*\n",
+		len(torrents), downloading, seeding, paused))
+
+	if session, err := sessionGet(); err == nil {
+		if free, err := freeSpace(session.DownloadDir); err == nil {
+			buf.WriteString(fmt.Sprintf("Free space: *%s*\n", loc.bytes(free)))
+		}
+	}
+
+	if len(errored) > 0 {
+		buf.WriteString(fmt.Sprintf("\n_Errors %d_\n%s\n", len(errored), strings.Join(errored, "\n")))
+	}
+
+	return buf.String(), mark, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// requestKeep is how long an approved request waits for its download
+const requestKeep = 30 * 24 * time.Hour
+
+// yearRegex finds the year that overseerr adds to titles, e.g. "Dune (2021)"
+var yearRegex = regexp.MustCompile(`\(\d{4}\)`)
+
+// mediaRequest is a request approved in overseerr or ombi, it's kept until a completed
+// torrent matches its title.
+type mediaRequest struct {
+	Title       string    `json:"title"`
+	RequestedBy string    `json:"requested_by"`
+	Approved    time.Time `json:"approved"`
+}
+
+func init() {
+	apiMux.HandleFunc("/api/webhook/overseerr", apiRequestWebhook)
+	apiMux.HandleFunc("/api/webhook/ombi", apiRequestWebhook)
+}
+
+// apiRequestWebhook takes overseerr's and ombi's webhooks, and tells the masters about
+// the approved requests. the other notifications are ignored.
+func apiRequestWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apiError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	// the fields of overseerr's default payload, and ombi's
+	var payload struct {
+		NotificationType string `json:"notification_type"`
+		Subject          string `json:"subject"`
+		Request          struct {
+			RequestedBy string `json:"requestedBy_username"`
+		} `json:"request"`
+
+		OmbiType      string `json:"notificationType"`
+		Title         string `json:"title"`
+		RequestedUser string `json:"requestedUser"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	kind := payload.NotificationType + payload.OmbiType
+	title := payload.Subject + payload.Title
+	by := payload.Request.RequestedBy + payload.RequestedUser
+
+	switch kind {
+	case "MEDIA_APPROVED", "MEDIA_AUTO_APPROVED", "RequestApproved":
+	case "TEST_NOTIFICATION", "Test":
+		notify("Request webhook works", false)
+		apiReply(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	default:
+		apiReply(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	if title == "" {
+		apiError(w, http.StatusBadRequest, "no title")
+		return
+	}
+
+	stateMu.Lock()
+	state.Requests = append(state.Requests, mediaRequest{Title: title, RequestedBy: by, Approved: time.Now()})
+	err := saveState()
+	stateMu.Unlock()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	text := "Request approved: " + title
+	if by != "" {
+		text += fmt.Sprintf(" (by %s)", by)
+	}
+	notify(text, false)
+	apiReply(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// fulfillRequest finds the approved request that t downloaded, by title, it removes the
+// request and keeps who asked for it as the torrent's requested_by field.
+func fulfillRequest(t *transmission.Torrent) *mediaRequest {
+	name := normalizeTitle(t.Name)
+	oldest := time.Now().Add(-requestKeep)
+
+	stateMu.Lock()
+	var (
+		found *mediaRequest
+		kept  []mediaRequest
+	)
+	for i := range state.Requests {
+		req := state.Requests[i]
+		if req.Approved.Before(oldest) {
+			continue
+		}
+		title := normalizeTitle(yearRegex.ReplaceAllString(req.Title, ""))
+		if found == nil && title != "" && strings.Contains(" "+name+" ", " "+title+" ") {
+			found = &req
+			continue
+		}
+		kept = append(kept, req)
+	}
+	changed := len(kept) != len(state.Requests)
+	state.Requests = kept
+	if changed {
+		if err := saveState(); err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+	}
+	stateMu.Unlock()
+
+	if found == nil {
+		return nil
+	}
+
+	if found.RequestedBy != "" {
+		if hash, err := torrentHash(fmt.Sprint(t.ID)); err == nil {
+			if err := setFields(hash, map[string]string{"requested_by": found.RequestedBy}); err != nil {
+				logger.Printf("[ERROR] State: %s", err)
+			}
+		}
+	}
+	return found
+}
+
+// normalizeTitle lowercases s and turns everything but letters and digits into single
+// spaces, so "The.Mandalorian.S02" and "The Mandalorian" can be compared.
+func normalizeTitle(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), " ")
+}
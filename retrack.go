@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// retrack moves the torrents of a tracker that changed its domain, "retrack old.org new.org"
+// lists the torrents that would change, and "retrack old.org new.org apply" changes them.
+func retrack(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) < 2 || len(tokens) > 3 {
+		send("*retrack:* needs the old and the new domains, e.g. _retrack old.org new.org_, end with _apply_ to change them", ud.Message.Chat.ID, true)
+		return
+	}
+
+	from, to := strings.ToLower(tokens[0]), strings.ToLower(tokens[1])
+	apply := len(tokens) == 3 && strings.ToLower(tokens[2]) == "apply"
+
+	torrents, err := getTorrentFields(nil, "id", "name", "trackers")
+	if err != nil {
+		sendErr("retrack", err, ud.Message.Chat.ID)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	var changed, failed int
+	for _, torrent := range torrents {
+		var replace []interface{}
+		for _, tracker := range torrent.Announces {
+			if announce, ok := replaceDomain(tracker.Announce, from, to); ok {
+				replace = append(replace, tracker.ID, announce)
+			}
+		}
+		if len(replace) == 0 {
+			continue
+		}
+
+		if apply {
+			if err := torrentSet([]int{torrent.ID}, map[string]interface{}{"trackerReplace": replace}); err != nil {
+				buf.WriteString(fmt.Sprintf("<%d> %s: %s\n", torrent.ID, torrent.Name, err))
+				failed++
+				continue
+			}
+		}
+		buf.WriteString(fmt.Sprintf("<%d> %s\n", torrent.ID, torrent.Name))
+		changed++
+	}
+
+	switch {
+	case changed == 0 && failed == 0:
+		send(fmt.Sprintf("*retrack:* no torrent has a tracker on %s", from), ud.Message.Chat.ID, false)
+	case apply:
+		buf.WriteString(fmt.Sprintf("\nMoved %d torrents from %s to %s", changed, from, to))
+		if failed > 0 {
+			buf.WriteString(fmt.Sprintf(", %d failed", failed))
+		}
+		send(buf.String(), ud.Message.Chat.ID, false)
+	default:
+		buf.WriteString(fmt.Sprintf("\n%d torrents would move from %s to %s, send \"retrack %s %s apply\" to do it",
+			changed, from, to, from, to))
+		send(buf.String(), ud.Message.Chat.ID, false)
+	}
+}
+
+// replaceDomain replaces the host of announce with to if it's from or a subdomain of it,
+// e.g. tracker.old.org becomes tracker.new.org.
+func replaceDomain(announce, from, to string) (string, bool) {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return "", false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	var newHost string
+	switch {
+	case host == from:
+		newHost = to
+	case strings.HasSuffix(host, "."+from):
+		newHost = strings.TrimSuffix(host, from) + to
+	default:
+		return "", false
+	}
+
+	if port := u.Port(); port != "" {
+		newHost += ":" + port
+	}
+	u.Host = newHost
+	return u.String(), true
+}
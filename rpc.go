@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pyed/transmission"
+)
+
+// the transmission package only covers a subset of the RPC protocol,
+// rpcCall is used for everything else (session-set fields, torrent-set, ...)
+
+// rpcRequest is the body of a Transmission RPC call
+type rpcRequest struct {
+	Method    string      `json:"method"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// rpcResponse is the body of a Transmission RPC reply
+type rpcResponse struct {
+	Result    string          `json:"result"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+var (
+	// rpcSessionID holds the value of the 'X-Transmission-Session-Id' header
+	rpcSessionID string
+	rpcMu        sync.Mutex
+
+	// the calls get -timeout to answer from rpcDeadline
+	rpcHTTPClient = &http.Client{}
+)
+
+// errNotResponding is returned by the calls to transmission that took longer than -timeout
+var errNotResponding = fmt.Errorf("transmission is not responding")
+
+func init() {
+	// the transmission package has no timeout of its own, and no way to give it a client
+	http.DefaultTransport = rpcDeadline{http.DefaultTransport}
+}
+
+// rpcDeadline gives the requests to transmission -timeout to answer, the other requests
+// go through as they are.
+type rpcDeadline struct {
+	base http.RoundTripper
+}
+
+func (t rpcDeadline) RoundTrip(req *http.Request) (*http.Response, error) {
+	configMu.RLock()
+	timeout := CommandTimeout
+	configMu.RUnlock()
+
+	if timeout <= 0 || !isEndpoint(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errNotResponding
+		}
+		return nil, err
+	}
+
+	// the deadline covers reading the body too
+	resp.Body = cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelBody cancels the context of its request once it's closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// isEndpoint returns true if u is on the host of the RPC URL in use
+func isEndpoint(u *url.URL) bool {
+	active, err := url.Parse(activeEndpoint())
+	if err != nil {
+		return false
+	}
+	return u.Scheme == active.Scheme && u.Host == active.Host
+}
+
+// rpcCall executes method with args against transmission and decodes the returned
+// arguments into out, out can be nil if the caller doesn't care about them
+func rpcCall(method string, args interface{}, out interface{}) error {
+	// the torrents changed, the cached ones are stale
+	if method != "torrent-get" && strings.HasPrefix(method, "torrent-") {
+		defer forgetTorrents()
+	}
+
+	body, err := json.Marshal(rpcRequest{Method: method, Arguments: args})
+	if err != nil {
+		return err
+	}
+
+	rpcMu.Lock()
+	sessionID := rpcSessionID
+	rpcMu.Unlock()
+
+	// transmission answers with 409 and a new session id when ours is missing or stale,
+	// in that case try once more with the new one.
+	var resp *http.Response
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", activeEndpoint(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Transmission-Session-Id", sessionID)
+		if Username != "" {
+			req.SetBasicAuth(Username, Password)
+		}
+
+		resp, err = rpcHTTPClient.Do(req)
+		if err != nil {
+			// the endpoint is unreachable, try again on whichever answers
+			if i > 0 || len(FallbackURLs) == 0 || connect() != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusConflict {
+			break
+		}
+		resp.Body.Close()
+
+		sessionID = resp.Header.Get("X-Transmission-Session-Id")
+		rpcMu.Lock()
+		rpcSessionID = sessionID
+		rpcMu.Unlock()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(data, &rpcResp); err != nil {
+		return err
+	}
+	if rpcResp.Result != "success" {
+		return fmt.Errorf("%s: %s", method, rpcResp.Result)
+	}
+
+	if out == nil || len(rpcResp.Arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rpcResp.Arguments, out)
+}
+
+// sessionSet sets the given session fields, e.g. {"alt-speed-enabled": true}
+func sessionSet(fields map[string]interface{}) error {
+	return rpcCall("session-set", fields, nil)
+}
+
+// rpcSession holds the session fields that the transmission package doesn't expose
+type rpcSession struct {
+	DownloadDir string `json:"download-dir"`
+
+	// Preallocation is how files are allocated, see preallocModes
+	Preallocation int `json:"preallocation"`
+
+	AltSpeedEnabled     bool `json:"alt-speed-enabled"`
+	AltSpeedDown        int  `json:"alt-speed-down"` // KB/s
+	AltSpeedUp          int  `json:"alt-speed-up"`   // KB/s
+	AltSpeedTimeEnabled bool `json:"alt-speed-time-enabled"`
+	AltSpeedTimeBegin   int  `json:"alt-speed-time-begin"` // minutes after midnight
+	AltSpeedTimeEnd     int  `json:"alt-speed-time-end"`
+	AltSpeedTimeDay     int  `json:"alt-speed-time-day"` // bits, sunday = 1 to saturday = 64
+
+	SpeedLimitUp        int  `json:"speed-limit-up"` // KB/s
+	SpeedLimitUpEnabled bool `json:"speed-limit-up-enabled"`
+}
+
+// sessionGet gets transmission's session fields
+func sessionGet() (*rpcSession, error) {
+	var session rpcSession
+	if err := rpcCall("session-get", nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// freeSpace returns the free space on the disk of path, as seen by transmission
+func freeSpace(path string) (uint64, error) {
+	var out struct {
+		SizeBytes int64 `json:"size-bytes"`
+	}
+	if err := rpcCall("free-space", map[string]string{"path": path}, &out); err != nil {
+		return 0, err
+	}
+	// transmission answers -1 when it can't tell
+	if out.SizeBytes < 0 {
+		return 0, fmt.Errorf("can't get the free space of %s", path)
+	}
+	return uint64(out.SizeBytes), nil
+}
+
+// torrentSet sets the given fields of the torrents with ids, e.g. {"labels": []string{"tv"}}
+func torrentSet(ids []int, fields map[string]interface{}) error {
+	args := map[string]interface{}{"ids": ids}
+	for k, v := range fields {
+		args[k] = v
+	}
+	return rpcCall("torrent-set", args, nil)
+}
+
+// rpcTorrent holds the torrent fields that the transmission package doesn't expose,
+// only the fields that were asked for will be filled.
+type rpcTorrent struct {
+	ID         int              `json:"id"`
+	Name       string           `json:"name"`
+	HashString string           `json:"hashString"`
+	IsPrivate  bool             `json:"isPrivate"`
+	Webseeds   []string         `json:"webseeds"`
+	Labels     []string         `json:"labels"`
+	Files      []rpcFile        `json:"files"`
+	FileStats  []rpcFileStat    `json:"fileStats"`
+	Trackers   []rpcTrackerStat `json:"trackerStats"`
+	Announces  []rpcTracker     `json:"trackers"`
+	File       string           `json:"torrentFile"`
+	Peers      []rpcPeer        `json:"peers"`
+
+	// the metadata of the .torrent
+	Comment     string `json:"comment"`
+	Creator     string `json:"creator"`
+	DateCreated int64  `json:"dateCreated"`
+	PieceSize   uint64 `json:"pieceSize"`
+	PieceCount  int    `json:"pieceCount"`
+	TotalSize   uint64 `json:"totalSize"`
+	AddedDate   int64  `json:"addedDate"`
+	DoneDate    int64  `json:"doneDate"`
+
+	// MetadataPercentComplete is below 1 while a magnet is getting its metadata
+	MetadataPercentComplete float64 `json:"metadataPercentComplete"`
+	DownloadDir             string  `json:"downloadDir"`
+
+	// Pieces is a base64 bitfield of the pieces that are complete
+	Pieces string `json:"pieces"`
+
+	// the seeding so far, for 'goals'
+	PercentDone    float64 `json:"percentDone"`
+	UploadRatio    float64 `json:"uploadRatio"`
+	SecondsSeeding int64   `json:"secondsSeeding"`
+
+	// SequentialDownload is only there since transmission 4.1
+	SequentialDownload bool `json:"sequentialDownload"`
+
+	// IsFinished is set once the torrent reached its seed ratio or idle limit
+	IsFinished    bool `json:"isFinished"`
+	SeedRatioMode int  `json:"seedRatioMode"`
+
+	// Status is one of transmission.Status*
+	Status int `json:"status"`
+}
+
+// rpcPeer is a peer the torrent is connected to
+type rpcPeer struct {
+	Address      string  `json:"address"`
+	Port         int     `json:"port"`
+	ClientName   string  `json:"clientName"`
+	Progress     float64 `json:"progress"`
+	RateToClient uint64  `json:"rateToClient"`
+	RateToPeer   uint64  `json:"rateToPeer"`
+	FlagStr      string  `json:"flagStr"`
+}
+
+// rpcTracker is one of the trackers of a torrent
+type rpcTracker struct {
+	ID       int    `json:"id"`
+	Announce string `json:"announce"`
+}
+
+// rpcTrackerStat is the announce state of one of the trackers of a torrent
+type rpcTrackerStat struct {
+	Host                  string `json:"host"`
+	LastAnnounceResult    string `json:"lastAnnounceResult"`
+	LastAnnounceSucceeded bool   `json:"lastAnnounceSucceeded"`
+	LastAnnounceTime      int64  `json:"lastAnnounceTime"`
+	NextAnnounceTime      int64  `json:"nextAnnounceTime"`
+	LastScrapeResult      string `json:"lastScrapeResult"`
+	LastScrapeSucceeded   bool   `json:"lastScrapeSucceeded"`
+	LastScrapeTime        int64  `json:"lastScrapeTime"`
+
+	// SeederCount and LeecherCount are -1 when the tracker didn't say
+	SeederCount  int `json:"seederCount"`
+	LeecherCount int `json:"leecherCount"`
+}
+
+// rpcFile is a file inside a torrent
+type rpcFile struct {
+	Name           string `json:"name"`
+	Length         uint64 `json:"length"`
+	BytesCompleted uint64 `json:"bytesCompleted"`
+}
+
+// rpcFileStat is the state of a file inside a torrent, in the same order as the files
+type rpcFileStat struct {
+	Wanted   bool `json:"wanted"`
+	Priority int  `json:"priority"`
+}
+
+// getTorrentFields gets the given fields of the torrents with ids, or of all torrents if ids is empty
+func getTorrentFields(ids []int, fields ...string) ([]rpcTorrent, error) {
+	args := map[string]interface{}{"fields": fields}
+	if len(ids) > 0 {
+		args["ids"] = ids
+	}
+
+	var out struct {
+		Torrents []rpcTorrent `json:"torrents"`
+	}
+	if err := rpcCall("torrent-get", args, &out); err != nil {
+		return nil, err
+	}
+	return out.Torrents, nil
+}
+
+// rpcClient().GetTorrents asks for every field, the files, peers and trackers too, that's a lot
+// for a listing of 2000 torrents every few seconds. getTorrents asks for just the fields in:
+var (
+	// nameFields are enough for the listings that show the names and the status
+	nameFields = []string{"id", "name", "status", "error", "errorString", "addedDate"}
+
+	// statsFields are enough for the speeds, the progress and the methods of transmission.Torrent
+	statsFields = append(nameFields, "sizeWhenDone", "leftUntilDone", "percentDone", "eta",
+		"uploadRatio", "rateDownload", "rateUpload", "downloadedEver", "uploadedEver",
+		"isFinished", "seedRatioMode", "downloadDir", "trackers")
+)
+
+// getTorrents is Client.GetTorrents with only fields filled, e.g. getTorrents(nameFields...),
+// in the order set with 'sort'. the answers are shared for a moment, see cachedTorrents.
+func getTorrents(fields ...string) (transmission.Torrents, error) {
+	sorting := currentSort()
+
+	// the order needs its field too
+	if field := sortFields[sorting]; !hasFields(toSet(fields), []string{field}) {
+		fields = append(append([]string{}, fields...), field)
+	}
+
+	torrents, err := cachedTorrents(fields, func() (transmission.Torrents, error) {
+		var out struct {
+			Torrents transmission.Torrents `json:"torrents"`
+		}
+		if err := rpcCall("torrent-get", map[string]interface{}{"fields": fields}, &out); err != nil {
+			return nil, err
+		}
+		return out.Torrents, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortTorrents(torrents, sorting)
+	return torrents, nil
+}
+
+var (
+	// torrentSort is the order set with 'sort', getTorrents and the client keep to it
+	torrentSort   = transmission.SortID
+	torrentSortMu sync.Mutex
+)
+
+// sortFields is the field each order sorts by
+var sortFields = map[transmission.SortType]string{
+	transmission.SortID: "id", transmission.SortRevID: "id",
+	transmission.SortName: "name", transmission.SortRevName: "name",
+	transmission.SortAge: "addedDate", transmission.SortRevAge: "addedDate",
+	transmission.SortSize: "sizeWhenDone", transmission.SortRevSize: "sizeWhenDone",
+	transmission.SortProgress: "percentDone", transmission.SortRevProgress: "percentDone",
+	transmission.SortDownSpeed: "rateDownload", transmission.SortRevDownSpeed: "rateDownload",
+	transmission.SortUpSpeed: "rateUpload", transmission.SortRevUpSpeed: "rateUpload",
+	transmission.SortDownloaded: "downloadedEver", transmission.SortRevDownloaded: "downloadedEver",
+	transmission.SortUploaded: "uploadedEver", transmission.SortRevUploaded: "uploadedEver",
+	transmission.SortRatio: "uploadRatio", transmission.SortRevRatio: "uploadRatio",
+}
+
+// setSort sets the order of the torrents, for getTorrents and the client
+func setSort(sorting transmission.SortType) {
+	torrentSortMu.Lock()
+	torrentSort = sorting
+	torrentSortMu.Unlock()
+
+	rpcClient().SetSort(sorting)
+}
+
+// currentSort returns the order set with 'sort'
+func currentSort() transmission.SortType {
+	torrentSortMu.Lock()
+	defer torrentSortMu.Unlock()
+	return torrentSort
+}
+
+// sortTorrents sorts torrents the way the client would
+func sortTorrents(torrents transmission.Torrents, sorting transmission.SortType) {
+	switch sorting {
+	case transmission.SortID, transmission.SortRevID:
+		torrents.SortID(sorting == transmission.SortRevID)
+	case transmission.SortName, transmission.SortRevName:
+		torrents.SortName(sorting == transmission.SortRevName)
+	case transmission.SortAge, transmission.SortRevAge:
+		torrents.SortAge(sorting == transmission.SortRevAge)
+	case transmission.SortSize, transmission.SortRevSize:
+		torrents.SortSize(sorting == transmission.SortRevSize)
+	case transmission.SortProgress, transmission.SortRevProgress:
+		torrents.SortProgress(sorting == transmission.SortRevProgress)
+	case transmission.SortDownSpeed, transmission.SortRevDownSpeed:
+		torrents.SortDownSpeed(sorting == transmission.SortRevDownSpeed)
+	case transmission.SortUpSpeed, transmission.SortRevUpSpeed:
+		torrents.SortUpSpeed(sorting == transmission.SortRevUpSpeed)
+	case transmission.SortDownloaded, transmission.SortRevDownloaded:
+		torrents.SortDownloaded(sorting == transmission.SortRevDownloaded)
+	case transmission.SortUploaded, transmission.SortRevUploaded:
+		torrents.SortUploaded(sorting == transmission.SortRevUploaded)
+	case transmission.SortRatio, transmission.SortRevRatio:
+		torrents.SortRatio(sorting == transmission.SortRevRatio)
+	}
+}
+
+// getTorrentExtra is like getTorrentFields for a single torrent
+func getTorrentExtra(id int, fields ...string) (*rpcTorrent, error) {
+	torrents, err := getTorrentFields([]int{id}, append(fields, "id")...)
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return nil, fmt.Errorf("no torrent with an ID of %d", id)
+	}
+	return &torrents[0], nil
+}
+
+// getTorrentByHash is getTorrentExtra by the info hash. the IDs are handed out again when
+// transmission restarts, so buttons that outlive a message keep the hash instead.
+func getTorrentByHash(hash string, fields ...string) (*rpcTorrent, error) {
+	// transmission takes "recently-active" in ids too, only real hashes get through
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 40 {
+		return nil, fmt.Errorf("invalid hash %q", hash)
+	}
+
+	var out struct {
+		Torrents []rpcTorrent `json:"torrents"`
+	}
+	args := map[string]interface{}{"ids": []string{hash}, "fields": append(fields, "id")}
+	if err := rpcCall("torrent-get", args, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Torrents) == 0 {
+		return nil, fmt.Errorf("that torrent is gone")
+	}
+	return &out.Torrents[0], nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pyed/transmission"
+)
+
+// seedDelete is a torrent marked for deletion once it reaches its seed target, it's
+// kept by hash since the IDs change when transmission restarts.
+type seedDelete struct {
+	Hash     string `json:"hash"`
+	Name     string `json:"name"`
+	WithData bool   `json:"with_data"`
+}
+
+func init() {
+	onPoll(deleteSeeded)
+}
+
+// deleteAfterSeed marks the torrents with ids for deletion once they reach their seed
+// ratio or idle target, "del 42 after:seedtarget".
+func deleteAfterSeed(chat int64, ids []int, cmd string, withData bool) {
+	torrents, err := getTorrentFields(ids, "id", "name", "hashString", "seedRatioMode")
+	if err != nil {
+		sendErr(cmd, err, chat)
+		return
+	}
+	if len(torrents) == 0 {
+		send(fmt.Sprintf("*%s:* no torrents with those IDs", cmd), chat, false)
+		return
+	}
+
+	stateMu.Lock()
+	marked := make(map[string]bool)
+	for _, sd := range state.SeedDeletes {
+		marked[sd.Hash] = true
+	}
+
+	buf := new(strings.Builder)
+	for _, torrent := range torrents {
+		if !marked[torrent.HashString] {
+			state.SeedDeletes = append(state.SeedDeletes, seedDelete{
+				Hash:     torrent.HashString,
+				Name:     torrent.Name,
+				WithData: withData,
+			})
+		}
+
+		buf.WriteString(fmt.Sprintf("<%d> %s will be deleted once it reaches its seed target", torrent.ID, torrent.Name))
+		if torrent.SeedRatioMode == ratioUnlimited {
+			buf.WriteString(", but its ratio is unlimited, see tratio")
+		}
+		buf.WriteString("\n")
+	}
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		sendErr(cmd, err, chat)
+		return
+	}
+	send(buf.String(), chat, false)
+}
+
+// deleteSeeded deletes the marked torrents that transmission considers finished, which
+// is when they stop after reaching their seed ratio or idle limit.
+func deleteSeeded(transmission.Torrents) {
+	stateMu.Lock()
+	pending := len(state.SeedDeletes)
+	stateMu.Unlock()
+	if pending == 0 {
+		return
+	}
+
+	torrents, err := getTorrentFields(nil, "id", "hashString", "isFinished")
+	if err != nil {
+		logger.Printf("[ERROR] Seed target: %s", err)
+		return
+	}
+
+	present := make(map[string]rpcTorrent)
+	for _, torrent := range torrents {
+		present[torrent.HashString] = torrent
+	}
+
+	stateMu.Lock()
+	var (
+		kept []seedDelete
+		done []string
+	)
+	for _, sd := range state.SeedDeletes {
+		torrent, ok := present[sd.Hash]
+		if !ok {
+			continue // deleted by someone else
+		}
+		if !torrent.IsFinished {
+			kept = append(kept, sd)
+			continue
+		}
+
+		if _, err := rpcClient().DeleteTorrent(torrent.ID, sd.WithData); err != nil {
+			logger.Printf("[ERROR] Seed target: deleting %s: %s", sd.Name, err)
+			kept = append(kept, sd)
+			continue
+		}
+
+		if sd.WithData {
+			done = append(done, "🗑 Reached its seed target, deleted with data: "+sd.Name)
+		} else {
+			done = append(done, "🗑 Reached its seed target, deleted: "+sd.Name)
+		}
+	}
+
+	if len(kept) != len(state.SeedDeletes) {
+		state.SeedDeletes = kept
+		if err := saveState(); err != nil {
+			logger.Printf("[ERROR] State: %s", err)
+		}
+	}
+	stateMu.Unlock()
+
+	for _, text := range done {
+		notify(text, false)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// chatGap is how long to wait between two messages to a chat, telegram allows about one
+	// a second, and 20 a minute in groups
+	chatGap  = time.Second
+	groupGap = 3 * time.Second
+
+	// sendRetries is how many times a send is retried when telegram is busy or failing
+	sendRetries = 3
+)
+
+// chatQueue makes the sends to a chat go one at a time, chatGap apart
+type chatQueue struct {
+	sync.Mutex
+	last time.Time
+}
+
+var (
+	chatQueues   = make(map[int64]*chatQueue)
+	chatQueuesMu sync.Mutex
+)
+
+// botSend is Bot.Send through the queue of the chat, spaced out to stay under telegram's
+// limits. it's retried after telegram's retry_after when it says there are too many requests,
+// and with backoff when it fails on its end.
+func botSend(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if chat, ok := chattableChat(c); ok {
+		chatQueuesMu.Lock()
+		q := chatQueues[chat]
+		if q == nil {
+			q = &chatQueue{}
+			chatQueues[chat] = q
+		}
+		chatQueuesMu.Unlock()
+
+		gap := chatGap
+		if chat < 0 {
+			gap = groupGap
+		}
+
+		q.Lock()
+		defer q.Unlock()
+		if wait := time.Until(q.last.Add(gap)); wait > 0 {
+			time.Sleep(wait)
+		}
+		defer func() { q.last = time.Now() }()
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		resp, err := Bot.Send(c)
+		if err == nil || attempt == sendRetries {
+			return resp, err
+		}
+
+		wait, retry := retryDelay(err, backoff)
+		if !retry {
+			return resp, err
+		}
+		logger.Printf("[INFO] Send: %s, retrying in %s", err, wait)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// chattableChat returns the chat of the messages and edits that count against the limits,
+// chat actions like "typing" don't.
+func chattableChat(c tgbotapi.Chattable) (int64, bool) {
+	switch v := c.(type) {
+	case tgbotapi.MessageConfig:
+		return v.ChatID, true
+	case tgbotapi.EditMessageTextConfig:
+		return v.ChatID, true
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return v.ChatID, true
+	case tgbotapi.DocumentConfig:
+		return v.ChatID, true
+	case tgbotapi.PhotoConfig:
+		return v.ChatID, true
+	}
+	return 0, false
+}
+
+// retryDelay returns how long to wait before sending again after err, and false if
+// it's not worth it, e.g. the message itself is wrong
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if tgErr, ok := err.(tgbotapi.Error); ok && tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second, true
+	}
+
+	for _, busy := range []string{"Internal Server Error", "Bad Gateway", "Service Unavailable", "Gateway Timeout"} {
+		if strings.Contains(err.Error(), busy) {
+			return backoff, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// defaultRPCURL is what "default" means in the setup
+const defaultRPCURL = "http://localhost:9091/transmission/rpc"
+
+// setupState is what the setup through the chat saved, the flags take precedence over it
+type setupState struct {
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// the steps of the setup, each one waits for an answer
+const (
+	setupURL = iota
+	setupUsername
+	setupPassword
+	setupDir
+)
+
+// setup is the setup in progress, it's active when the bot starts without any master
+var setup struct {
+	sync.Mutex
+	active bool
+	owner  string // the first user who talked to the bot, becomes an admin
+	step   int
+
+	url, username, password string
+}
+
+// applySetup uses the RPC URL and credentials of a previous setup, unless they were passed
+// as flags. it starts the setup if there's no master to talk to. must be called after loadState.
+func applySetup() {
+	stateMu.Lock()
+	saved := state.Setup
+	var admins int
+	for _, role := range state.Masters {
+		if role == roleAdmin {
+			admins++
+		}
+	}
+	stateMu.Unlock()
+
+	if saved != nil {
+		configMu.Lock()
+		if !setFlags["url"] {
+			RPCURL = saved.URL
+		}
+		if !setFlags["username"] && !setFlags["password"] {
+			Username, Password = saved.Username, saved.Password
+		}
+		configMu.Unlock()
+	}
+
+	if len(Masters) == 0 && admins == 0 {
+		setup.active = true
+	}
+}
+
+// setupPending returns true while the setup is waiting for someone to finish it
+func setupPending() bool {
+	setup.Lock()
+	defer setup.Unlock()
+	return setup.active
+}
+
+// setupStep walks the first user who talks to the bot through claiming it, connecting to
+// transmission and picking the download directory.
+func setupStep(ud tgbotapi.Update) {
+	setup.Lock()
+	defer setup.Unlock()
+
+	chat := ud.Message.Chat.ID
+	username := strings.ToLower(ud.Message.From.UserName)
+
+	if setup.owner == "" {
+		if username == "" {
+			send("*setup:* set a Telegram username first, the bot knows its masters by it", chat, false)
+			return
+		}
+		setup.owner = username
+		setup.step = setupURL
+		send(fmt.Sprintf("Hi @%s, you're the first one here so you'll be my admin.\n\n"+
+			"What's transmission's RPC URL? Send 'default' for %s", username, defaultRPCURL), chat, false)
+		return
+	}
+
+	if username != setup.owner {
+		send(fmt.Sprintf("The bot is being set up by @%s, try again later", setup.owner), chat, false)
+		return
+	}
+
+	answer := strings.TrimSpace(ud.Message.Text)
+	switch setup.step {
+	case setupURL:
+		if strings.ToLower(answer) == "default" {
+			answer = defaultRPCURL
+		}
+		u, err := url.Parse(answer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			send("*setup:* that's not an http(s) URL, e.g. "+defaultRPCURL, chat, false)
+			return
+		}
+		setup.url = answer
+		setup.step = setupUsername
+		send("What's transmission's username? Send 'none' if it doesn't ask for one", chat, false)
+
+	case setupUsername:
+		if strings.ToLower(answer) == "none" {
+			setup.username, setup.password = "", ""
+			testSetup(chat)
+			return
+		}
+		setup.username = answer
+		setup.step = setupPassword
+		send("And the password? I'll delete your message", chat, false)
+
+	case setupPassword:
+		setup.password = answer
+		Bot.DeleteMessage(tgbotapi.DeleteMessageConfig{ChatID: chat, MessageID: ud.Message.MessageID})
+		testSetup(chat)
+
+	case setupDir:
+		if strings.ToLower(answer) != "keep" {
+			if err := sessionSet(map[string]interface{}{"download-dir": answer}); err != nil {
+				send("*setup:* "+err.Error()+", send another directory or 'keep'", chat, false)
+				return
+			}
+		}
+		setup.active = false
+		send("All set! Send 'help' to see what I can do", chat, false)
+	}
+}
+
+// testSetup connects to transmission with what the setup got so far, saves it if it works and
+// asks for the download directory, or starts over from the URL. setup must be locked.
+func testSetup(chat int64) {
+	client, err := transmission.New(setup.url, setup.username, setup.password)
+	if err == nil {
+		_, err = client.GetStats()
+	}
+	if err != nil {
+		setup.step = setupURL
+		send(fmt.Sprintf("*setup:* couldn't connect to %s: %s\n\nSend the RPC URL again", setup.url, err), chat, false)
+		return
+	}
+
+	configMu.Lock()
+	RPCURL, Username, Password = setup.url, setup.username, setup.password
+	configMu.Unlock()
+	endpointMu.Lock()
+	endpoint = setup.url
+	transmissionClient = client
+	endpointMu.Unlock()
+
+	stateMu.Lock()
+	state.Setup = &setupState{URL: setup.url, Username: setup.username, Password: setup.password}
+	state.Masters[setup.owner] = roleAdmin
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		sendErr("setup", err, chat)
+		return
+	}
+	rememberChat(chat, setup.owner)
+	logger.Printf("[INFO] Setup: @%s is the admin, connected to %s", setup.owner, setup.url)
+
+	// they waited for a client if the bot started without one
+	go startServices()
+
+	dir := "transmission's default"
+	if session, err := sessionGet(); err == nil {
+		dir = session.DownloadDir
+	}
+	setup.step = setupDir
+	send(fmt.Sprintf("Connected! Torrents go to %s, send another directory or 'keep'", dir), chat, false)
+}
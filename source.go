@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// sourceUpload is the source of the torrents added from a .torrent sent to the bot, the link
+// of the file has the bot's token and expires anyway
+const sourceUpload = "a .torrent file sent to the bot"
+
+// recordSource remembers the URL or magnet torrent was added from in its history record
+func recordSource(torrent transmission.TorrentAdded, url string) {
+	if strings.Contains(url, BotToken) {
+		url = sourceUpload
+	}
+
+	// the record is made on the next poll otherwise
+	if _, err := recordTorrents([]int{torrent.ID}); err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+		return
+	}
+
+	err := historyUpdate(strings.ToLower(torrent.HashString), func(record *torrentRecord) bool {
+		if record.Source != "" {
+			return false
+		}
+		record.Source = url
+		return true
+	})
+	if err != nil {
+		logger.Printf("[ERROR] History: %s", err)
+	}
+}
+
+// source shows where a torrent was added from, to add it again if its data is lost, it takes
+// the ID of a torrent or words of the name of one that was removed, e.g. "source 12" or
+// "source ubuntu 24.04".
+func source(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*source:* needs a torrent's ID, or words of its name", ud.Message.Chat.ID, false)
+		return
+	}
+
+	var records []torrentRecord
+	if id, err := strconv.Atoi(tokens[0]); err == nil && len(tokens) == 1 {
+		torrent, err := getTorrentExtra(id, "hashString")
+		if err != nil {
+			sendErr("source", err, ud.Message.Chat.ID)
+			return
+		}
+
+		record, ok, err := historyGet(strings.ToLower(torrent.HashString))
+		if err != nil {
+			sendErr("source", err, ud.Message.Chat.ID)
+			return
+		}
+		if ok {
+			records = append(records, record)
+		}
+	} else {
+		words := strings.ToLower(strings.Join(tokens, " "))
+		err := historyEach(func(hash string, record torrentRecord) {
+			if strings.Contains(strings.ToLower(record.Name), words) {
+				records = append(records, record)
+			}
+		})
+		if err != nil {
+			sendErr("source", err, ud.Message.Chat.ID)
+			return
+		}
+	}
+
+	if len(records) == 0 {
+		send("*source:* no such torrent in the history", ud.Message.Chat.ID, false)
+		return
+	}
+
+	loc := chatLocale(ud.Message.Chat.ID)
+	buf := new(bytes.Buffer)
+	for _, record := range records {
+		buf.WriteString(fmt.Sprintf("*%s*\n", mdReplacer.Replace(displayName(ud.Message.Chat.ID, record.Name))))
+		buf.WriteString(fmt.Sprintf("Added %s\n", loc.time(time.Unix(record.Added, 0))))
+		switch record.Source {
+		case "":
+			buf.WriteString("_Added before the bot recorded sources, or not through it_\n\n")
+		case sourceUpload:
+			buf.WriteString("From " + sourceUpload + "\n\n")
+		default:
+			// send the link back to the bot to add it again
+			buf.WriteString(fmt.Sprintf("`%s`\n\n", strings.Replace(record.Source, "`", "%60", -1)))
+		}
+	}
+
+	send(buf.String(), ud.Message.Chat.ID, true)
+}
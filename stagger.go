@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pyed/transmission"
+)
+
+// staggerMin is the size from which a batch of adds gets spread over AddStagger
+const staggerMin = 3
+
+// staggerDelay is the pause between the adds of a batch of n, so that the batch takes
+// AddStagger and the trackers don't get all the announces at once. 0 for small batches.
+func staggerDelay(n int) time.Duration {
+	configMu.RLock()
+	window := AddStagger
+	configMu.RUnlock()
+
+	if window <= 0 || n < staggerMin {
+		return 0
+	}
+	return window / time.Duration(n)
+}
+
+// staggerWait waits delay, it returns false if ctx got cancelled meanwhile
+func staggerWait(ctx context.Context, delay time.Duration) bool {
+	if delay == 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// addBatch adds the groups of mirrors one after the other, spread over AddStagger, and reports
+// the progress in a single message instead of one message per torrent. the failures are told
+// by names, or by the first link of their group without them.
+func addBatch(chat int64, groups [][]string, names []string, opts addOptions) {
+	// add them paused to check their size before transmission writes it all out
+	guard := !opts.Paused && preallocGuard()
+	if guard {
+		opts.Paused = true
+	}
+
+	ctx, finish := startOp(chat)
+	defer finish()
+
+	delay := staggerDelay(len(groups))
+	label := "Adding"
+	if delay > 0 {
+		label = fmt.Sprintf("Adding one every %s,", delay.Round(time.Second))
+	}
+	p := newProgress(chat, label, len(groups))
+
+	var added []transmission.TorrentAdded
+	failed := new(bytes.Buffer)
+	for i, urls := range groups {
+		if i > 0 && !staggerWait(ctx, delay) {
+			p.finish(fmt.Sprintf("Cancelled, added %d of %d\n%s", len(added), len(groups), failed))
+			return
+		}
+
+		var torrent transmission.TorrentAdded
+		var err error
+		for _, url := range urls {
+			if torrent, err = addOne(url, opts); err == nil || torrent.ID != 0 {
+				break
+			}
+		}
+		if err != nil {
+			name := linkNames(urls[:1])[0]
+			if i < len(names) {
+				name = names[i]
+			}
+			failed.WriteString(fmt.Sprintf("%s: %s\n", name, err))
+		} else {
+			added = append(added, torrent)
+			if guard {
+				go checkPrealloc(chat, torrent.ID)
+			}
+			go confirmSize(chat, torrent.ID)
+		}
+		p.update(i+1, len(groups))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("Added %d of %d\n", len(added), len(groups)))
+	for _, torrent := range added {
+		buf.WriteString(fmt.Sprintf("<%d> %s\n", torrent.ID, torrent.Name))
+	}
+	if failed.Len() > 0 {
+		buf.WriteString("\nFailed:\n")
+		buf.Write(failed.Bytes())
+	}
+
+	// too long to fit in the progress message
+	if utf8.RuneCountInString(buf.String()) > 4096 {
+		p.finish(fmt.Sprintf("Added %d of %d, %d failed", len(added), len(groups), len(groups)-len(added)))
+		send(buf.String(), chat, false)
+		return
+	}
+	p.finish(buf.String())
+}
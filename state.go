@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// botState is what the bot keeps between restarts, it gets written to StateFile
+type botState struct {
+	// Masters are the users that got approved through an access request, username => role
+	Masters map[string]string `json:"masters"`
+
+	// Chats are the chats where masters talked to the bot, they get the notifications
+	Chats []int64 `json:"chats"`
+
+	// ChatMasters are the masters who talked to the bot in each chat, a chat stops getting the
+	// notifications once none of them is a master
+	ChatMasters map[int64][]string `json:"chat_masters,omitempty"`
+
+	// Activity is the hourly transfer rate, for 'heatmap'
+	Activity []activitySample `json:"activity,omitempty"`
+
+	// SeedDeletes are the torrents to delete once they reach their seed target
+	SeedDeletes []seedDelete `json:"seed_deletes,omitempty"`
+
+	// Fields are the custom fields that other tools set through the API, hash => name => value
+	Fields map[string]map[string]string `json:"fields,omitempty"`
+
+	// Requests are the approved overseerr/ombi requests that haven't been downloaded yet
+	Requests []mediaRequest `json:"requests,omitempty"`
+
+	// Chains are the torrents waiting for others to complete, see 'after'
+	Chains []chain `json:"chains,omitempty"`
+
+	// VerifyLimit is how many torrents can verify at once, VerifyQueue are the hashes waiting to
+	VerifyLimit int      `json:"verify_limit,omitempty"`
+	VerifyQueue []string `json:"verify_queue,omitempty"`
+
+	// History is where the history used to be kept, it's moved to HistoryDB on the start.
+	// Backfilled is set once the torrents that were there before the bot got recorded
+	History    map[string]torrentRecord `json:"history,omitempty"`
+	Backfilled bool                     `json:"backfilled,omitempty"`
+
+	// Translit are the chats that want the names transliterated
+	Translit map[int64]bool `json:"translit,omitempty"`
+
+	// Setup is the RPC URL and credentials given through the chat on the first run
+	Setup *setupState `json:"setup,omitempty"`
+
+	// Report is the schedule set with 'report', it overrides -report. LastReport is where the
+	// last report left off
+	Report     string     `json:"report,omitempty"`
+	LastReport reportMark `json:"last_report"`
+
+	// TrackerPaused are the hashes of the torrents 'tracker pause' stopped, by host, so that
+	// 'tracker resume' only starts those
+	TrackerPaused map[string][]string `json:"tracker_paused,omitempty"`
+
+	// LastCommand is when a master last sent a command in each chat, unix time, for the idle hints
+	LastCommand map[int64]int64 `json:"last_command,omitempty"`
+
+	// Dashboards are the pinned messages 'dashboard' keeps up to date, chat id => message id
+	Dashboards map[int64]int `json:"dashboards,omitempty"`
+
+	// Aliases are the commands saved with 'alias', name => command
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// UploadOnly are the hashes of the torrents enforceUploadOnly stopped downloading, so that
+	// wanting their files again isn't undone on the next poll
+	UploadOnly []string `json:"upload_only,omitempty"`
+
+	// StreamPreps are the videos streamprep is getting the ends of, see streamPrep
+	StreamPreps []streamPrep `json:"stream_preps,omitempty"`
+
+	// DonorPrev is the upload limit from before donor capped it, restored once it lifts the cap
+	DonorPrev *donorLimit `json:"donor_prev,omitempty"`
+}
+
+var (
+	state   = botState{Masters: make(map[string]string)}
+	stateMu sync.Mutex
+)
+
+// loadState reads StateFile into state, a missing file is not an error
+func loadState() error {
+	if StateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var loaded botState
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	if loaded.Masters == nil {
+		loaded.Masters = make(map[string]string)
+	}
+
+	stateMu.Lock()
+	state = loaded
+	stateMu.Unlock()
+	return nil
+}
+
+// saveState writes state to StateFile, callers must hold stateMu
+func saveState() error {
+	if StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a crash won't leave us with half a state
+	tmp := StateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, StateFile)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// statusEvery is how often a chat can get a status, so a busy group can't flood itself
+const statusEvery = time.Minute
+
+var (
+	// statusSent is when each chat last got a status
+	statusSent   = make(map[int64]time.Time)
+	statusSentMu sync.Mutex
+)
+
+// status sends a one line summary, meant for groups, e.g.
+// "↓ 3.2 MB/s ↑ 450 kB/s · 2 downloading · 14 seeding"
+func status(ud tgbotapi.Update) {
+	statusSentMu.Lock()
+	if time.Since(statusSent[ud.Message.Chat.ID]) < statusEvery {
+		statusSentMu.Unlock()
+		return
+	}
+	statusSent[ud.Message.Chat.ID] = time.Now()
+	statusSentMu.Unlock()
+
+	stats, err := rpcClient().GetStats()
+	if err != nil {
+		sendErr("status", err, ud.Message.Chat.ID)
+		return
+	}
+
+	torrents, err := getTorrents(statsFields...)
+	if err != nil {
+		sendErr("status", err, ud.Message.Chat.ID)
+		return
+	}
+
+	loc := chatLocale(ud.Message.Chat.ID)
+	text := fmt.Sprintf("↓ %s/s ↑ %s/s · %d downloading · %d seeding",
+		loc.bytes(stats.DownloadSpeed), loc.bytes(stats.UploadSpeed),
+		len(filterTorrents(torrents, isDownloading)), len(filterTorrents(torrents, isSeeding)))
+	send(text, ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// streamEdge is how much of the start and the end of a video players need before they
+// can play it, the container's header and index are there.
+const streamEdge = 8 << 20
+
+// videoExts are the extensions of the files streamprep looks for
+var videoExts = map[string]bool{
+	".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".mov": true,
+	".wmv": true, ".ts": true, ".webm": true, ".mpg": true, ".mpeg": true,
+}
+
+// streamPrep is a video that streamprep gets the ends of, with the settings to put back
+// once they're complete. it's kept in the state so a restart doesn't leave the priorities
+// changed for good.
+type streamPrep struct {
+	Hash       string           `json:"hash"`
+	Name       string           `json:"name"`
+	File       string           `json:"file"`
+	Chat       int64            `json:"chat"`
+	Edges      []int            `json:"edges"`
+	Priorities map[string][]int `json:"priorities"` // torrent-set field => file indexes
+	Sequential bool             `json:"sequential"`
+}
+
+// streamprep gets the start and the end of the largest video of a torrent first so it can be
+// previewed while the rest downloads, the priorities are restored once they're complete.
+// transmission has no priorities for pieces, so the video gets a high priority and the
+// rest of the files a low one, and sequential download is turned on where it's supported (4.1+).
+func streamprep(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*streamprep:* needs a torrent ID number", ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*streamprep:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrent, err := getTorrentExtra(id, "name", "hashString", "files", "fileStats", "pieceSize", "pieces", "sequentialDownload")
+	if err != nil {
+		sendErr("streamprep", err, ud.Message.Chat.ID)
+		return
+	}
+
+	video := -1
+	for i, file := range torrent.Files {
+		if !videoExts[strings.ToLower(path.Ext(file.Name))] {
+			continue
+		}
+		if video == -1 || file.Length > torrent.Files[video].Length {
+			video = i
+		}
+	}
+	if video == -1 {
+		send(fmt.Sprintf("*streamprep:* %s has no video files", torrent.Name), ud.Message.Chat.ID, false)
+		return
+	}
+
+	edges := edgePieces(torrent, video)
+	if piecesComplete(torrent.Pieces, edges) {
+		send(fmt.Sprintf("*streamprep:* %s can already be previewed", path.Base(torrent.Files[video].Name)), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// remember the priorities to put them back after
+	p := streamPrep{
+		Hash:       strings.ToLower(torrent.HashString),
+		Name:       torrent.Name,
+		File:       path.Base(torrent.Files[video].Name),
+		Chat:       ud.Message.Chat.ID,
+		Edges:      edges,
+		Priorities: make(map[string][]int),
+		Sequential: torrent.SequentialDownload,
+	}
+	var others []int
+	for i, stat := range torrent.FileStats {
+		p.Priorities[priorityField(stat.Priority)] = append(p.Priorities[priorityField(stat.Priority)], i)
+		if i != video {
+			others = append(others, i)
+		}
+	}
+
+	// a second streamprep would remember the priorities of the first as the ones to go back to
+	stateMu.Lock()
+	for _, prep := range state.StreamPreps {
+		if prep.Hash == p.Hash {
+			stateMu.Unlock()
+			send(fmt.Sprintf("*streamprep:* already getting %s ready", prep.File), ud.Message.Chat.ID, false)
+			return
+		}
+	}
+	state.StreamPreps = append(state.StreamPreps, p)
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+	stateMu.Unlock()
+
+	fields := map[string]interface{}{
+		"files-wanted":       []int{video},
+		"priority-high":      []int{video},
+		"sequentialDownload": true,
+	}
+	if len(others) > 0 {
+		fields["priority-low"] = others
+	}
+	if err := torrentSet([]int{id}, fields); err != nil {
+		forgetStreamPrep(p.Hash)
+		sendErr("streamprep", err, ud.Message.Chat.ID)
+		return
+	}
+
+	send(fmt.Sprintf("*streamprep:* getting the start and the end of %s first, I'll tell you when it can be previewed", p.File),
+		ud.Message.Chat.ID, false)
+	watchStreamPrep(p)
+}
+
+// resumeStreamPreps goes back to watching the videos that streamprep was getting before a restart
+func resumeStreamPreps() {
+	stateMu.Lock()
+	preps := append([]streamPrep(nil), state.StreamPreps...)
+	stateMu.Unlock()
+
+	for _, p := range preps {
+		go watchStreamPrep(p)
+	}
+}
+
+// watchStreamPrep waits for the ends of p's video, then puts back the priorities and
+// sequential download the torrent had before. 'cancel' puts them back right away.
+func watchStreamPrep(p streamPrep) {
+	ctx, finish := startOp(p.Chat)
+	defer finish()
+
+	for {
+		every, _ := liveTiming()
+		select {
+		case <-ctx.Done():
+			if err := restoreStreamPrep(p); err != nil {
+				sendErr("streamprep", err, p.Chat)
+				return
+			}
+			send(fmt.Sprintf("*streamprep:* stopped, the priorities of %s are back to how they were", p.Name), p.Chat, false)
+			return
+		case <-time.After(every):
+		}
+
+		var out struct {
+			Torrents []rpcTorrent `json:"torrents"`
+		}
+		args := map[string]interface{}{"ids": []string{p.Hash}, "fields": []string{"id", "pieces"}}
+		if err := rpcCall("torrent-get", args, &out); err != nil {
+			continue // try again if some error happened
+		}
+
+		// the torrent is gone
+		if len(out.Torrents) == 0 {
+			forgetStreamPrep(p.Hash)
+			return
+		}
+
+		if !piecesComplete(out.Torrents[0].Pieces, p.Edges) {
+			continue
+		}
+
+		if err := restoreStreamPrep(p); err != nil {
+			sendErr("streamprep", err, p.Chat)
+			return
+		}
+		send(fmt.Sprintf("*streamprep:* %s can be previewed now, the priorities are back to how they were", p.File), p.Chat, false)
+		return
+	}
+}
+
+// restoreStreamPrep puts back the settings p's torrent had before streamprep
+func restoreStreamPrep(p streamPrep) error {
+	args := map[string]interface{}{"ids": []string{p.Hash}, "sequentialDownload": p.Sequential}
+	for field, indexes := range p.Priorities {
+		args[field] = indexes
+	}
+	if err := rpcCall("torrent-set", args, nil); err != nil {
+		return err
+	}
+	forgetStreamPrep(p.Hash)
+	return nil
+}
+
+// forgetStreamPrep removes the streamprep of the torrent with hash from the state
+func forgetStreamPrep(hash string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	var kept []streamPrep
+	for _, p := range state.StreamPreps {
+		if p.Hash != hash {
+			kept = append(kept, p)
+		}
+	}
+	state.StreamPreps = kept
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
+
+// edgePieces returns the pieces that hold the first and the last streamEdge bytes of
+// the file at index, files are laid out one after the other in the torrent's pieces.
+func edgePieces(torrent *rpcTorrent, index int) []int {
+	if torrent.PieceSize == 0 {
+		return nil
+	}
+
+	var start uint64
+	for _, file := range torrent.Files[:index] {
+		start += file.Length
+	}
+	length := torrent.Files[index].Length
+	if length == 0 {
+		return nil
+	}
+	end := start + length - 1
+
+	pieces := make(map[int]bool)
+	add := func(from, to uint64) {
+		for p := from / torrent.PieceSize; p <= to/torrent.PieceSize; p++ {
+			pieces[int(p)] = true
+		}
+	}
+
+	if length <= 2*streamEdge {
+		add(start, end)
+	} else {
+		add(start, start+streamEdge-1)
+		add(end-streamEdge+1, end)
+	}
+
+	list := make([]int, 0, len(pieces))
+	for p := range pieces {
+		list = append(list, p)
+	}
+	return list
+}
+
+// piecesComplete returns true if all of the pieces are set in the base64 bitfield
+func piecesComplete(bitfield string, pieces []int) bool {
+	bits, err := base64.StdEncoding.DecodeString(bitfield)
+	if err != nil {
+		return false
+	}
+
+	for _, p := range pieces {
+		if p/8 >= len(bits) || bits[p/8]&(0x80>>uint(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// priorityField is the torrent-set field that gives a file priority
+func priorityField(priority int) string {
+	switch {
+	case priority < 0:
+		return "priority-low"
+	case priority > 0:
+		return "priority-high"
+	}
+	return "priority-normal"
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strconv"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// trackerstat shows what each tracker of a torrent says about its swarm, and how the
+// last announce and scrape went.
+func trackerstat(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		send("*trackerstat:* needs a torrent ID number", ud.Message.Chat.ID, false)
+		return
+	}
+
+	id, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		send(fmt.Sprintf("*trackerstat:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	torrent, err := getTorrentExtra(id, "name", "trackerStats")
+	if err != nil {
+		sendErr("trackerstat", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if len(torrent.Trackers) == 0 {
+		send(fmt.Sprintf("*trackerstat:* %s has no trackers", mdReplacer.Replace(torrent.Name)), ud.Message.Chat.ID, true)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n", torrent.ID, mdReplacer.Replace(displayName(ud.Message.Chat.ID, torrent.Name))))
+	for _, tracker := range torrent.Trackers {
+		buf.WriteString(fmt.Sprintf("\n*%s*\nSeeders: *%s* Leechers: *%s*\n", mdReplacer.Replace(tracker.Host),
+			swarmCount(tracker.SeederCount), swarmCount(tracker.LeecherCount)))
+		buf.WriteString(fmt.Sprintf("Announce: %s\n", trackerResult(tracker.LastAnnounceTime,
+			tracker.LastAnnounceSucceeded, tracker.LastAnnounceResult)))
+		buf.WriteString(fmt.Sprintf("Scrape: %s\n", trackerResult(tracker.LastScrapeTime,
+			tracker.LastScrapeSucceeded, tracker.LastScrapeResult)))
+	}
+
+	send(buf.String(), ud.Message.Chat.ID, true)
+}
+
+// swarm lists the torrents by the size of their swarm, the best count any of their trackers
+// gives, smallest first so the dead ones are on top.
+func swarm(ud tgbotapi.Update, tokens []string) {
+	torrents, err := getTorrentFields(nil, "id", "name", "trackerStats")
+	if err != nil {
+		sendErr("swarm", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if len(torrents) == 0 {
+		send("*swarm:* no torrents", ud.Message.Chat.ID, false)
+		return
+	}
+
+	type swarmSize struct {
+		id       int
+		name     string
+		seeders  int
+		leechers int
+		failing  bool // no tracker announced successfully
+	}
+
+	sizes := make([]swarmSize, 0, len(torrents))
+	for _, torrent := range torrents {
+		size := swarmSize{id: torrent.ID, name: torrent.Name, seeders: -1, leechers: -1, failing: true}
+		for _, tracker := range torrent.Trackers {
+			if tracker.SeederCount > size.seeders {
+				size.seeders = tracker.SeederCount
+			}
+			if tracker.LeecherCount > size.leechers {
+				size.leechers = tracker.LeecherCount
+			}
+			if tracker.LastAnnounceSucceeded {
+				size.failing = false
+			}
+		}
+		sizes = append(sizes, size)
+	}
+
+	gosort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].seeders < sizes[j].seeders
+	})
+
+	buf := new(bytes.Buffer)
+	for _, size := range sizes {
+		buf.WriteString(fmt.Sprintf("`<%d>` S: *%s* L: *%s* %s", size.id, swarmCount(size.seeders),
+			swarmCount(size.leechers), mdReplacer.Replace(displayName(ud.Message.Chat.ID, size.name))))
+		if size.failing {
+			buf.WriteString(" ⚠️")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n⚠️ no tracker answered the last announce")
+
+	send(buf.String(), ud.Message.Chat.ID, true)
+}
+
+// swarmCount formats a seeder or leecher count, trackers that didn't give one report -1
+func swarmCount(n int) string {
+	if n < 0 {
+		return "?"
+	}
+	return strconv.Itoa(n)
+}
+
+// trackerResult describes an announce or a scrape that happened at unix time at
+func trackerResult(at int64, succeeded bool, result string) string {
+	if at <= 0 {
+		return "never"
+	}
+
+	ago := time.Since(time.Unix(at, 0)).Round(time.Second).String() + " ago"
+	if succeeded {
+		return ago + ", ok"
+	}
+	if result == "" {
+		result = "failed"
+	}
+	return ago + ", " + mdReplacer.Replace(result)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// torrentsTTL is how long an answer of getTorrents is reused, the commands and live messages
+// that come within it share one torrent-get
+const torrentsTTL = 2 * time.Second
+
+// torrentsEntry is a torrent-get answer for a set of fields, done is closed once it's in
+type torrentsEntry struct {
+	fields   map[string]bool
+	at       time.Time
+	torrents transmission.Torrents
+	err      error
+	done     chan struct{}
+}
+
+var (
+	// torrentsCache are the recent answers of getTorrents, by their fields
+	torrentsCache   = make(map[string]*torrentsEntry)
+	torrentsCacheMu sync.Mutex
+)
+
+// cachedTorrents returns the torrents with fields from an answer of the last torrentsTTL
+// that had them all, or waits for the same call that's still going. get makes the call
+// when there's none.
+func cachedTorrents(fields []string, get func() (transmission.Torrents, error)) (transmission.Torrents, error) {
+	key := strings.Join(fields, ",")
+
+	torrentsCacheMu.Lock()
+	entry := torrentsCache[key]
+	if entry == nil || (isClosed(entry.done) && time.Since(entry.at) > torrentsTTL) {
+		entry = nil
+		for _, e := range torrentsCache {
+			if isClosed(e.done) && e.err == nil && time.Since(e.at) <= torrentsTTL && hasFields(e.fields, fields) {
+				entry = e
+				break
+			}
+		}
+	}
+
+	if entry == nil {
+		entry = &torrentsEntry{fields: toSet(fields), done: make(chan struct{})}
+		for k, e := range torrentsCache {
+			if isClosed(e.done) && time.Since(e.at) > torrentsTTL {
+				delete(torrentsCache, k)
+			}
+		}
+		torrentsCache[key] = entry
+		torrentsCacheMu.Unlock()
+
+		entry.torrents, entry.err = get()
+		entry.at = time.Now()
+		close(entry.done)
+
+		// the errors aren't worth keeping
+		if entry.err != nil {
+			torrentsCacheMu.Lock()
+			if torrentsCache[key] == entry {
+				delete(torrentsCache, key)
+			}
+			torrentsCacheMu.Unlock()
+		}
+	} else {
+		torrentsCacheMu.Unlock()
+		<-entry.done
+	}
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	// the callers sort them, e.g. latest
+	return append(transmission.Torrents{}, entry.torrents...), nil
+}
+
+// forgetTorrents drops the cached answers, after something changed the torrents
+func forgetTorrents() {
+	torrentsCacheMu.Lock()
+	for key, entry := range torrentsCache {
+		if isClosed(entry.done) {
+			delete(torrentsCache, key)
+		}
+	}
+	torrentsCacheMu.Unlock()
+}
+
+// hasFields returns true if have has all the fields
+func hasFields(have map[string]bool, fields []string) bool {
+	for _, f := range fields {
+		if !have[f] {
+			return false
+		}
+	}
+	return true
+}
+
+// toSet returns fields as a set
+func toSet(fields []string) map[string]bool {
+	set := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		set[f] = true
+	}
+	return set
+}
+
+// isClosed returns true if ch is closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// trackerDefault are the options for the torrents of a tracker, applied after adding them
+// unless the add gave its own, e.g. "add -dir" wins over Dir.
+type trackerDefault struct {
+	Dir    string   `yaml:"dir"`
+	Label  string   `yaml:"label"`
+	Ratio  *float64 `yaml:"ratio"`
+	Paused bool     `yaml:"paused"`
+}
+
+// TrackerDefaults are loaded from the config file, by tracker host
+var TrackerDefaults map[string]trackerDefault
+
+// trackerDefaultFor returns the defaults of the first tracker of announces that has some,
+// "example.org" matches "tracker.example.org" too, see hostMatches.
+func trackerDefaultFor(announces []rpcTracker) (trackerDefault, bool) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	for _, announce := range announces {
+		u, err := url.Parse(announce.Announce)
+		if err != nil {
+			continue
+		}
+		for name, def := range TrackerDefaults {
+			if hostMatches(u.Hostname(), name) {
+				return def, true
+			}
+		}
+	}
+	return trackerDefault{}, false
+}
+
+// hostMatches returns true if host is the tracker name or one of its subdomains
+func hostMatches(host, name string) bool {
+	host, name = strings.ToLower(host), strings.ToLower(name)
+	return host == name || strings.HasSuffix(host, "."+name)
+}
+
+// applyTrackerDefaults applies the defaults of the trackers of the torrent with id, opts are
+// the options it was added with.
+func applyTrackerDefaults(id int, opts addOptions) error {
+	configMu.RLock()
+	none := len(TrackerDefaults) == 0
+	configMu.RUnlock()
+	if none {
+		return nil
+	}
+
+	torrent, err := getTorrentExtra(id, "trackers")
+	if err != nil {
+		return err
+	}
+
+	def, ok := trackerDefaultFor(torrent.Announces)
+	if !ok {
+		return nil
+	}
+
+	if def.Dir != "" && opts.Dir == "" {
+		args := map[string]interface{}{"ids": []int{id}, "location": def.Dir, "move": true}
+		if err := rpcCall("torrent-set-location", args, nil); err != nil {
+			return fmt.Errorf("couldn't move it to %s: %s", def.Dir, err)
+		}
+	}
+	if def.Label != "" {
+		if _, err := changeLabels([]int{id}, func(labels []string) []string {
+			return append(labels, def.Label)
+		}); err != nil {
+			return fmt.Errorf("couldn't label it: %s", err)
+		}
+	}
+	if def.Ratio != nil {
+		fields := map[string]interface{}{"seedRatioMode": ratioSingle, "seedRatioLimit": *def.Ratio}
+		if err := torrentSet([]int{id}, fields); err != nil {
+			return fmt.Errorf("couldn't set its seed ratio: %s", err)
+		}
+	}
+	if def.Paused && !opts.Paused {
+		if err := rpcCall("torrent-stop", map[string]interface{}{"ids": []int{id}}, nil); err != nil {
+			return fmt.Errorf("couldn't pause it: %s", err)
+		}
+	}
+	return nil
+}
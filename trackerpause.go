@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// tracker stops the torrents announcing to a tracker for its maintenance windows, where
+// the announces would count against you, "tracker pause host" and "tracker resume host".
+// resume only starts the torrents that pause stopped.
+func tracker(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) > 0 {
+		tokens[0] = strings.ToLower(tokens[0])
+	}
+	if len(tokens) != 2 || (tokens[0] != "pause" && tokens[0] != "resume") {
+		send("*tracker:* needs pause or resume and a tracker's host, e.g. _tracker pause example.org_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	host := strings.ToLower(tokens[1])
+	if tokens[0] == "pause" {
+		trackerPause(ud.Message.Chat.ID, host)
+		return
+	}
+	trackerResume(ud.Message.Chat.ID, host)
+}
+
+// trackerPause stops the running torrents with a tracker on host and remembers them
+func trackerPause(chat int64, host string) {
+	torrents, err := getTorrentFields(nil, "id", "hashString", "trackers", "status")
+	if err != nil {
+		sendErr("tracker", err, chat)
+		return
+	}
+
+	var ids []int
+	var hashes []string
+	for _, t := range torrents {
+		if t.Status != transmission.StatusStopped && announcesTo(t.Announces, host) {
+			ids = append(ids, t.ID)
+			hashes = append(hashes, t.HashString)
+		}
+	}
+
+	if len(ids) == 0 {
+		send(fmt.Sprintf("*tracker:* no running torrent announces to %s", host), chat, false)
+		return
+	}
+
+	if err := rpcCall("torrent-stop", map[string]interface{}{"ids": ids}, nil); err != nil {
+		sendErr("tracker", err, chat)
+		return
+	}
+
+	stateMu.Lock()
+	if state.TrackerPaused == nil {
+		state.TrackerPaused = make(map[string][]string)
+	}
+	state.TrackerPaused[host] = append(state.TrackerPaused[host], hashes...)
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+
+	send(fmt.Sprintf("Paused %d torrents of %s, send \"tracker resume %s\" to start them again", len(ids), host, host), chat, false)
+}
+
+// trackerResume starts the torrents that trackerPause stopped for host
+func trackerResume(chat int64, host string) {
+	stateMu.Lock()
+	hashes := state.TrackerPaused[host]
+	stateMu.Unlock()
+
+	if len(hashes) == 0 {
+		send(fmt.Sprintf("*tracker:* %s wasn't paused", host), chat, false)
+		return
+	}
+
+	// the hashes are the ids, transmission takes them too
+	if err := rpcCall("torrent-start", map[string]interface{}{"ids": hashes}, nil); err != nil {
+		sendErr("tracker", err, chat)
+		return
+	}
+
+	stateMu.Lock()
+	delete(state.TrackerPaused, host)
+	err := saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+
+	send(fmt.Sprintf("Resumed %d torrents of %s", len(hashes), host), chat, false)
+}
+
+// announcesTo returns true if one of announces is on host or one of its subdomains
+func announcesTo(announces []rpcTracker, host string) bool {
+	for _, announce := range announces {
+		u, err := url.Parse(announce.Announce)
+		if err == nil && hostMatches(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
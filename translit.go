@@ -0,0 +1,110 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// cyrillic maps the russian, ukrainian and belarusian letters to latin ones
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+}
+
+// displayName is how name is shown in chat, transliterated if the chat asked for it
+func displayName(chat int64, name string) string {
+	stateMu.Lock()
+	on := state.Translit[chat]
+	stateMu.Unlock()
+
+	if !on {
+		return name
+	}
+	return transliterate(name)
+}
+
+// matchName returns true if regx matches name, or the way name is shown in chat, so that a
+// search for "matritsa" finds "Матрица" where the names are transliterated.
+func matchName(chat int64, regx *regexp.Regexp, name string) bool {
+	if regx.MatchString(name) {
+		return true
+	}
+	shown := displayName(chat, name)
+	return shown != name && regx.MatchString(shown)
+}
+
+// transliterate turns cyrillic letters into latin ones and full-width characters
+// into their normal width, e.g. "Ｍａｔｒｉｘ" becomes "Matrix".
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E: // full-width ASCII
+			b.WriteRune(r - 0xFEE0)
+		case r == 0x3000: // ideographic space
+			b.WriteRune(' ')
+		default:
+			lower := []rune(strings.ToLower(string(r)))[0]
+			latin, ok := cyrillic[lower]
+			if !ok {
+				b.WriteRune(r)
+				continue
+			}
+			// keep the case of the first letter
+			if lower != r && latin != "" {
+				latin = strings.ToUpper(latin[:1]) + latin[1:]
+			}
+			b.WriteString(latin)
+		}
+	}
+	return b.String()
+}
+
+// translit turns transliteration of the torrent names in this chat's listings on or off
+func translit(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		stateMu.Lock()
+		on := state.Translit[ud.Message.Chat.ID]
+		stateMu.Unlock()
+
+		if on {
+			send("*translit:* on, names are transliterated in this chat", ud.Message.Chat.ID, false)
+			return
+		}
+		send("*translit:* off, send _translit on_ to transliterate names in this chat", ud.Message.Chat.ID, true)
+		return
+	}
+
+	var on bool
+	switch strings.ToLower(tokens[0]) {
+	case "on":
+		on = true
+	case "off":
+	default:
+		send("*translit:* takes on or off", ud.Message.Chat.ID, false)
+		return
+	}
+
+	stateMu.Lock()
+	if state.Translit == nil {
+		state.Translit = make(map[int64]bool)
+	}
+	if on {
+		state.Translit[ud.Message.Chat.ID] = true
+	} else {
+		delete(state.Translit, ud.Message.Chat.ID)
+	}
+	err := saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		sendErr("translit", err, ud.Message.Chat.ID)
+		return
+	}
+	send("*translit:* "+tokens[0], ud.Message.Chat.ID, false)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// turtleDays are the bits of transmission's alt-speed-time-day, in the order of time.Weekday
+var turtleDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var turtleAutoOnce sync.Once
+
+var (
+	// turtleAutoOn is true while the turtle mode is on because turtleAuto turned it on, a
+	// "turtle on" or "turtle off" takes it over
+	turtleAutoOn   bool
+	turtleAutoOnMu sync.Mutex
+)
+
+// startTurtleAuto starts turtleAuto if there's something to watch, only once
+func startTurtleAuto() {
+	configMu.RLock()
+	enabled := TurtlePing != "" || TurtlePlexURL != ""
+	configMu.RUnlock()
+
+	if enabled {
+		turtleAutoOnce.Do(func() { go turtleAuto() })
+	}
+}
+
+// turtleCheck returns how often the LAN is checked, TurtleInterval or a minute when it's not
+// set, a zero would spin the loops
+func turtleCheck() time.Duration {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if TurtleInterval <= 0 {
+		return time.Minute
+	}
+	return time.Second * time.Duration(TurtleInterval)
+}
+
+// turtleAuto watches the LAN for streaming activity, and keeps transmission's
+// alt-speed (turtle mode) enabled as long as someone is streaming. it only turns off what it
+// turned on, a "turtle on" stays on.
+func turtleAuto() {
+	var streaming bool
+
+	runLoop("turtle", turtleCheck, func() error {
+		busy, err := lanBusy()
+		if err != nil {
+			return err
+		}
+		if busy == streaming {
+			return nil
+		}
+
+		if busy {
+			session, err := sessionGet()
+			if err != nil {
+				return err
+			}
+
+			// already on, by hand or by the schedule
+			if session.AltSpeedEnabled {
+				streaming = true
+				return nil
+			}
+			if err := sessionSet(map[string]interface{}{"alt-speed-enabled": true}); err != nil {
+				return err
+			}
+			streaming = true
+			turtleAutoOnMu.Lock()
+			turtleAutoOn = true
+			turtleAutoOnMu.Unlock()
+			notify("🐢 Turtle mode enabled, someone is streaming", false)
+			return nil
+		}
+
+		turtleAutoOnMu.Lock()
+		ours := turtleAutoOn
+		turtleAutoOnMu.Unlock()
+
+		if ours {
+			if err := sessionSet(map[string]interface{}{"alt-speed-enabled": false}); err != nil {
+				return err
+			}
+			notify("🐇 Turtle mode disabled, streaming has stopped", false)
+		}
+
+		turtleAutoOnMu.Lock()
+		turtleAutoOn = false
+		turtleAutoOnMu.Unlock()
+		streaming = false
+		return nil
+	})
+}
+
+// lanBusy returns true if any of the configured checks says that someone is streaming
+func lanBusy() (bool, error) {
+	configMu.RLock()
+	host, plexURL, plexToken := TurtlePing, TurtlePlexURL, TurtlePlexToken
+	configMu.RUnlock()
+
+	if host != "" && pingHost(host) {
+		return true, nil
+	}
+
+	if plexURL != "" {
+		playing, err := plexPlaying(plexURL, plexToken)
+		if err != nil {
+			return false, fmt.Errorf("plex: %s", err)
+		}
+		return playing, nil
+	}
+
+	return false, nil
+}
+
+// pingHost sends a single ping to host and reports whether it answered
+func pingHost(host string) bool {
+	return exec.Command("ping", "-c", "1", "-W", "2", host).Run() == nil
+}
+
+// plexPlaying asks plex for its current sessions, and returns true if there's any
+func plexPlaying(url, token string) (bool, error) {
+	req, err := http.NewRequest("GET", url+"/status/sessions", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("X-Plex-Token", token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var sessions struct {
+		MediaContainer struct {
+			Size int `json:"size"`
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return false, err
+	}
+
+	return sessions.MediaContainer.Size > 0, nil
+}
+
+// turtle toggles transmission's alt-speed (turtle mode) and manages its schedule:
+// "turtle on|off|status", "turtle schedule 09:00 17:00 mon-fri" and "turtle schedule off".
+func turtle(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		tokens = []string{"status"}
+	}
+
+	switch strings.ToLower(tokens[0]) {
+	case "on", "off":
+		enable := strings.ToLower(tokens[0]) == "on"
+		if err := sessionSet(map[string]interface{}{"alt-speed-enabled": enable}); err != nil {
+			sendErr("turtle", err, ud.Message.Chat.ID)
+			return
+		}
+
+		// it's the user's now, turtleAuto leaves it alone
+		turtleAutoOnMu.Lock()
+		turtleAutoOn = false
+		turtleAutoOnMu.Unlock()
+
+		if enable {
+			send("🐢 Turtle mode enabled", ud.Message.Chat.ID, false)
+			return
+		}
+		send("🐇 Turtle mode disabled", ud.Message.Chat.ID, false)
+
+	case "status":
+		session, err := sessionGet()
+		if err != nil {
+			sendErr("turtle", err, ud.Message.Chat.ID)
+			return
+		}
+
+		buf := new(bytes.Buffer)
+		if session.AltSpeedEnabled {
+			buf.WriteString("🐢 Turtle mode is on")
+		} else {
+			buf.WriteString("🐇 Turtle mode is off")
+		}
+		buf.WriteString(fmt.Sprintf("\nLimits: ↓ %d KB/s ↑ %d KB/s", session.AltSpeedDown, session.AltSpeedUp))
+
+		if session.AltSpeedTimeEnabled {
+			buf.WriteString(fmt.Sprintf("\nSchedule: %s to %s on %s", clock(session.AltSpeedTimeBegin),
+				clock(session.AltSpeedTimeEnd), formatDays(session.AltSpeedTimeDay)))
+		} else {
+			buf.WriteString("\nSchedule: off")
+		}
+		send(buf.String(), ud.Message.Chat.ID, false)
+
+	case "schedule":
+		turtleSchedule(ud, tokens[1:])
+
+	default:
+		send("*turtle:* unknown subcommand "+tokens[0], ud.Message.Chat.ID, false)
+	}
+}
+
+// turtleSchedule sets transmission's alt-speed scheduler, e.g. "09:00 17:00 mon-fri", or "off"
+func turtleSchedule(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 1 && strings.ToLower(tokens[0]) == "off" {
+		if err := sessionSet(map[string]interface{}{"alt-speed-time-enabled": false}); err != nil {
+			sendErr("turtle", err, ud.Message.Chat.ID)
+			return
+		}
+		send("*turtle:* schedule disabled", ud.Message.Chat.ID, false)
+		return
+	}
+
+	if len(tokens) < 2 || len(tokens) > 3 {
+		send("*turtle:* schedule needs _<begin> <end> [days]_, e.g. _09:00 17:00 mon-fri_, or _off_", ud.Message.Chat.ID, true)
+		return
+	}
+
+	begin, err := parseClock(tokens[0])
+	if err != nil {
+		sendErr("turtle", err, ud.Message.Chat.ID)
+		return
+	}
+	end, err := parseClock(tokens[1])
+	if err != nil {
+		sendErr("turtle", err, ud.Message.Chat.ID)
+		return
+	}
+
+	days := 127 // every day
+	if len(tokens) == 3 {
+		if days, err = parseDays(tokens[2]); err != nil {
+			sendErr("turtle", err, ud.Message.Chat.ID)
+			return
+		}
+	}
+
+	err = sessionSet(map[string]interface{}{
+		"alt-speed-time-enabled": true,
+		"alt-speed-time-begin":   begin,
+		"alt-speed-time-end":     end,
+		"alt-speed-time-day":     days,
+	})
+	if err != nil {
+		sendErr("turtle", err, ud.Message.Chat.ID)
+		return
+	}
+	send(fmt.Sprintf("*turtle:* on from %s to %s on %s", clock(begin), clock(end), formatDays(days)), ud.Message.Chat.ID, false)
+}
+
+// parseClock parses "09:30" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a time, e.g. 09:30", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// clock formats minutes after midnight as "09:30"
+func clock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// parseDays parses days like "mon-fri", "sat,sun", "weekdays", "weekend" or "all"
+// into the bits of alt-speed-time-day.
+func parseDays(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "all", "everyday":
+		return 127, nil
+	case "weekdays":
+		return 62, nil
+	case "weekend", "weekends":
+		return 65, nil
+	}
+
+	day := func(name string) (int, error) {
+		for i, d := range turtleDays {
+			if strings.HasPrefix(strings.ToLower(name), d) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%s is not a day, e.g. mon", name)
+	}
+
+	var days int
+	for _, part := range strings.Split(s, ",") {
+		from, to := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			from, to = part[:i], part[i+1:]
+		}
+
+		start, err := day(from)
+		if err != nil {
+			return 0, err
+		}
+		end, err := day(to)
+		if err != nil {
+			return 0, err
+		}
+
+		// ranges can wrap around the week, e.g. fri-mon
+		for d := start; ; d = (d + 1) % 7 {
+			days |= 1 << uint(d)
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// formatDays formats the bits of alt-speed-time-day, e.g. "mon,tue,wed"
+func formatDays(days int) string {
+	switch days {
+	case 127:
+		return "every day"
+	case 62:
+		return "weekdays"
+	case 65:
+		return "weekends"
+	}
+
+	var names []string
+	for i, d := range turtleDays {
+		if days&(1<<uint(i)) != 0 {
+			names = append(names, d)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// reviewLabel marks the torrents that were made upload only, for someone to look at
+const reviewLabel = "review"
+
+func init() {
+	onPoll(enforceUploadOnly)
+}
+
+// enforceUploadOnly stops the downloading of torrents that didn't complete within UploadOnlyAfter
+// of being added, they keep seeding what they have. the files that aren't complete are unwanted,
+// which is what stops transmission from downloading them and frees their queue slots.
+func enforceUploadOnly(torrents transmission.Torrents) {
+	configMu.RLock()
+	window := UploadOnlyAfter
+	configMu.RUnlock()
+
+	if window <= 0 {
+		return
+	}
+
+	for _, t := range filterTorrents(torrents, isDownloading) {
+		if t.PercentDone == 1 || time.Since(time.Unix(t.AddedDate, 0)) < window {
+			continue
+		}
+
+		torrent, err := getTorrentExtra(t.ID, "files", "hashString")
+		if err != nil {
+			logger.Printf("[ERROR] Upload only: %s", err)
+			continue
+		}
+
+		// done once already, the user might have wanted the files again since
+		hash := strings.ToLower(torrent.HashString)
+		if uploadOnlyDone(hash) {
+			continue
+		}
+
+		var incomplete []int
+		for i, file := range torrent.Files {
+			if file.BytesCompleted < file.Length {
+				incomplete = append(incomplete, i)
+			}
+		}
+		if len(incomplete) == 0 {
+			continue
+		}
+
+		if err := torrentSet([]int{t.ID}, map[string]interface{}{"files-unwanted": incomplete}); err != nil {
+			logger.Printf("[ERROR] Upload only: %s", err)
+			continue
+		}
+		rememberUploadOnly(hash)
+		if _, err := changeLabels([]int{t.ID}, func(labels []string) []string {
+			return append(labels, reviewLabel)
+		}); err != nil {
+			logger.Printf("[ERROR] Upload only: %s", err)
+		}
+
+		notify(fmt.Sprintf("⏳ <%d> %s didn't complete in %s, it only seeds what it has now. "+
+			"It's labeled %s, \"files %d want\" the files to download them again.",
+			t.ID, t.Name, window, reviewLabel, t.ID), false)
+	}
+}
+
+// uploadOnlyDone returns true if the torrent with hash was made upload only before
+func uploadOnlyDone(hash string) bool {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return containsString(state.UploadOnly, hash)
+}
+
+// rememberUploadOnly records that the torrent with hash was made upload only, the torrents
+// that are gone are forgotten then.
+func rememberUploadOnly(hash string) {
+	hashes, err := torrentHashes()
+	if err != nil {
+		hashes = nil // keep them all
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	kept := []string{hash}
+	for _, h := range state.UploadOnly {
+		if h != hash && (hashes == nil || hashes[h]) {
+			kept = append(kept, h)
+		}
+	}
+	state.UploadOnly = kept
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
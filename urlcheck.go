@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// urlCheckClient checks the URLs before they're added, a redirect to a magnet is a good answer
+var urlCheckClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme == "magnet" {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	},
+}
+
+// checkURL makes sure url is reachable and isn't a web page, after transmission failed to add it,
+// its errors say what's wrong instead of transmission's "invalid or corrupt torrent file".
+func checkURL(url string) error {
+	resp, err := urlCheckClient.Head(url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		// some servers only answer GET, the body isn't read
+		resp.Body.Close()
+		resp, err = urlCheckClient.Get(url)
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not reachable: %s", url, err)
+	}
+	resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); strings.HasPrefix(location, "magnet:") {
+		return nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+
+	// a login or an error page instead of the torrent
+	if media, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && strings.HasPrefix(media, "text/html") {
+		return fmt.Errorf("%s is a web page, not a torrent, maybe it needs a login", url)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pyed/transmission"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+func init() {
+	onPoll(drainVerify)
+}
+
+// verifyqueue shows or sets how many torrents can verify at once, "verifyqueue 2". while it's
+// set, check holds back the torrents over the limit and the watcher sends them as slots free,
+// so a mass recheck after a move doesn't grind the disks. 0 turns it off.
+func verifyqueue(ud tgbotapi.Update, tokens []string) {
+	if len(tokens) == 0 {
+		stateMu.Lock()
+		limit, queued := state.VerifyLimit, len(state.VerifyQueue)
+		stateMu.Unlock()
+
+		if limit == 0 {
+			send("*verifyqueue:* off, checks go to transmission right away", ud.Message.Chat.ID, false)
+			return
+		}
+		send(fmt.Sprintf("*verifyqueue:* %d at a time, %d waiting", limit, queued), ud.Message.Chat.ID, false)
+		return
+	}
+
+	limit, err := strconv.Atoi(tokens[0])
+	if err != nil || limit < 0 {
+		send(fmt.Sprintf("*verifyqueue:* %s is not a number", tokens[0]), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// the watcher sends the queued torrents, without it they'd wait forever
+	if limit > 0 && !watcherRunning() {
+		send("*verifyqueue:* needs the watcher, it's off with -watch-interval 0", ud.Message.Chat.ID, false)
+		return
+	}
+
+	stateMu.Lock()
+	state.VerifyLimit = limit
+	waiting := state.VerifyQueue
+	if limit == 0 {
+		state.VerifyQueue = nil
+	}
+	err = saveState()
+	stateMu.Unlock()
+
+	if err != nil {
+		sendErr("verifyqueue", err, ud.Message.Chat.ID)
+		return
+	}
+
+	if limit > 0 {
+		send(fmt.Sprintf("*verifyqueue:* %d at a time", limit), ud.Message.Chat.ID, false)
+		return
+	}
+
+	// turned off, whatever was waiting goes now
+	if len(waiting) > 0 {
+		if err := rpcCall("torrent-verify", map[string]interface{}{"ids": waiting}, nil); err != nil {
+			sendErr("verifyqueue", err, ud.Message.Chat.ID)
+			return
+		}
+	}
+	send(fmt.Sprintf("*verifyqueue:* off, sent the %d waiting torrents to verify", len(waiting)), ud.Message.Chat.ID, false)
+}
+
+// verifyLimit returns the limit set with verifyqueue, 0 when it's off or there's no watcher
+// to drain the queue
+func verifyLimit() int {
+	if !watcherRunning() {
+		return 0
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return state.VerifyLimit
+}
+
+// queueVerify adds the torrents with ids to the verify queue, all of them if ids is empty.
+// they're kept by hash since the IDs change when transmission restarts.
+func queueVerify(ids []int) (int, error) {
+	torrents, err := getTorrentFields(ids, "id", "hashString")
+	if err != nil {
+		return 0, err
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	queued := make(map[string]bool)
+	for _, hash := range state.VerifyQueue {
+		queued[hash] = true
+	}
+
+	var n int
+	for _, torrent := range torrents {
+		hash := strings.ToLower(torrent.HashString)
+		if queued[hash] {
+			continue
+		}
+		queued[hash] = true
+		state.VerifyQueue = append(state.VerifyQueue, hash)
+		n++
+	}
+	return n, saveState()
+}
+
+// drainVerify sends the queued torrents to verify while there are free slots
+func drainVerify(torrents transmission.Torrents) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if state.VerifyLimit == 0 || len(state.VerifyQueue) == 0 {
+		return
+	}
+
+	free := state.VerifyLimit - len(filterTorrents(torrents, isChecking))
+	if free <= 0 {
+		return
+	}
+	if free > len(state.VerifyQueue) {
+		free = len(state.VerifyQueue)
+	}
+
+	// removed torrents are ignored by transmission
+	if err := rpcCall("torrent-verify", map[string]interface{}{"ids": state.VerifyQueue[:free]}, nil); err != nil {
+		logger.Printf("[ERROR] Verify queue: %s", err)
+		return
+	}
+	state.VerifyQueue = state.VerifyQueue[free:]
+	if err := saveState(); err != nil {
+		logger.Printf("[ERROR] State: %s", err)
+	}
+}
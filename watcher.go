@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pyed/transmission"
+)
+
+// torrentTrack is what the watcher remembers about a torrent between polls
+type torrentTrack struct {
+	name     string
+	status   int
+	since    time.Time // when the torrent entered status
+	complete bool
+	errored  bool
+	alerted  bool // already alerted about being stuck in status
+}
+
+var (
+	// tracked holds the state of every torrent as of the last poll, torrent id => track
+	tracked   = make(map[int]*torrentTrack)
+	trackedMu sync.Mutex
+
+	// completionHooks get called for every torrent that completes
+	completionHooks []func(t *transmission.Torrent)
+
+	// pollHooks get called after every poll with the polled torrents
+	pollHooks []func(torrents transmission.Torrents)
+
+	// addedHooks and errorHooks get called with the torrents that are new, or that got an
+	// error, since the last poll. the ones that are there on startup don't count.
+	addedHooks []func(torrents transmission.Torrents)
+	errorHooks []func(torrents transmission.Torrents)
+)
+
+// onCompletion registers fn to be called when a torrent completes downloading
+func onCompletion(fn func(t *transmission.Torrent)) {
+	completionHooks = append(completionHooks, fn)
+}
+
+// onPoll registers fn to be called after every poll of the watcher
+func onPoll(fn func(torrents transmission.Torrents)) {
+	pollHooks = append(pollHooks, fn)
+}
+
+// onAdded registers fn to be called with the torrents that were added since the last poll
+func onAdded(fn func(torrents transmission.Torrents)) {
+	addedHooks = append(addedHooks, fn)
+}
+
+// onError registers fn to be called with the torrents that got an error since the last poll
+func onError(fn func(torrents transmission.Torrents)) {
+	errorHooks = append(errorHooks, fn)
+}
+
+var (
+	watcherOnce sync.Once
+
+	// watching is set once the watcher runs, the features that act on its polls need it
+	watching   bool
+	watchingMu sync.Mutex
+)
+
+// watcherStart is when the bot started, the torrents added after it are new to the watcher
+var watcherStart = time.Now()
+
+// startWatcher starts watchTorrents if it's enabled, only once
+func startWatcher() {
+	configMu.RLock()
+	enabled := WatchInterval > 0
+	configMu.RUnlock()
+
+	if enabled {
+		watcherOnce.Do(func() {
+			watchingMu.Lock()
+			watching = true
+			watchingMu.Unlock()
+			go watchTorrents()
+		})
+	}
+}
+
+// watcherRunning returns true if the watcher polls transmission, see startWatcher
+func watcherRunning() bool {
+	watchingMu.Lock()
+	defer watchingMu.Unlock()
+	return watching
+}
+
+// watchTorrents polls transmission every WatchInterval seconds, and tracks the torrents' states
+// to notify about the ones that completed.
+func watchTorrents() {
+	interval := func() time.Duration {
+		configMu.RLock()
+		defer configMu.RUnlock()
+		return time.Second * time.Duration(WatchInterval)
+	}
+
+	// don't notify about the torrents that were complete before we started
+	var initialized bool
+
+	runLoop("watcher", interval, func() error {
+		torrents, err := getTorrents(statsFields...)
+		if err != nil {
+			return err
+		}
+
+		var completed, added, errored transmission.Torrents
+		now := time.Now()
+
+		trackedMu.Lock()
+		seen := make(map[int]bool)
+		for i := range torrents {
+			t := torrents[i]
+			seen[t.ID] = true
+			complete := t.PercentDone == 1
+			hasErr := hasError(t)
+
+			track, ok := tracked[t.ID]
+			if !ok {
+				tracked[t.ID] = &torrentTrack{name: t.Name, status: t.Status, since: now, complete: complete, errored: hasErr}
+				if initialized {
+					added = append(added, t)
+					if hasErr {
+						errored = append(errored, t)
+					}
+				}
+				// new torrents that are already complete, e.g. added for seeding, aren't news. the
+				// ones that were added and downloaded between two polls are.
+				if complete && initialized && t.DownloadedEver > 0 && time.Unix(t.AddedDate, 0).After(watcherStart) {
+					completed = append(completed, t)
+				}
+				continue
+			}
+
+			track.name = t.Name
+			if track.status != t.Status {
+				track.status = t.Status
+				track.since = now
+				track.alerted = false
+			}
+			if !track.complete && complete && initialized {
+				completed = append(completed, t)
+			}
+			if !track.errored && hasErr && initialized {
+				errored = append(errored, t)
+			}
+			track.complete = complete
+			track.errored = hasErr
+		}
+
+		// forget the removed torrents
+		for id := range tracked {
+			if !seen[id] {
+				delete(tracked, id)
+			}
+		}
+		trackedMu.Unlock()
+		initialized = true
+
+		for i := range completed {
+			for _, hook := range completionHooks {
+				hook(completed[i])
+			}
+		}
+		if len(added) > 0 {
+			for _, hook := range addedHooks {
+				hook(added)
+			}
+		}
+		if len(errored) > 0 {
+			for _, hook := range errorHooks {
+				hook(errored)
+			}
+		}
+		for _, hook := range pollHooks {
+			hook(torrents)
+		}
+		return nil
+	})
+}
+
+// notifyCompletion tells the notification chats about a completed torrent
+func notifyCompletion(t *transmission.Torrent) {
+	text := fmt.Sprintf("Completed: %s", t.Name)
+	if req := fulfillRequest(t); req != nil {
+		text += "\nRequest fulfilled: " + req.Title
+	}
+	if fields := customFields(t.ID); fields != "" {
+		text += "\n" + fields
+	}
+	if t.SizeWhenDone >= hintSize {
+		notifyHinted(text, "completed")
+		return
+	}
+	notify(text, false)
+}
+
+func init() {
+	onCompletion(notifyCompletion)
+	onCompletion(mirrorCompletion)
+	onPoll(checkStuck)
+}
+
+// checkStuck alerts about the torrents that have been verifying for longer than VerifyAlert,
+// which usually means a dying disk or a hung daemon.
+func checkStuck(torrents transmission.Torrents) {
+	configMu.RLock()
+	threshold := VerifyAlert
+	configMu.RUnlock()
+	if threshold <= 0 {
+		return
+	}
+
+	trackedMu.Lock()
+	var alerts []string
+	for id, track := range tracked {
+		if track.status != transmission.StatusChecking || track.alerted || time.Since(track.since) < threshold {
+			continue
+		}
+		track.alerted = true
+		alerts = append(alerts, fmt.Sprintf("⚠️ <%d> %s has been verifying for %s, the disk might be dying or the daemon hung.\n"+
+			"Try \"stop %d\", and restart transmission-daemon if it doesn't respond.",
+			id, track.name, time.Since(track.since).Round(time.Minute), id))
+	}
+	trackedMu.Unlock()
+
+	for _, alert := range alerts {
+		notify(alert, false)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pyed/transmission"
+)
+
+// webhook is an HTTP request sent when a torrent completes, the URL, headers and body
+// are templates executed with the torrent, e.g. `{"text": "Completed: {{json .Name}}"}`.
+type webhook struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+}
+
+// Webhooks are loaded from the config file
+var Webhooks []webhook
+
+// webhookFuncs are available in the webhooks' templates
+var webhookFuncs = template.FuncMap{
+	// json quotes a value to be safely put in a JSON body
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"bytes": humanize.Bytes,
+}
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// render executes the template text with data
+func render(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("").Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// fire sends the webhook's request for torrent t
+func (w webhook) fire(t *transmission.Torrent) error {
+	url, err := render(w.URL, t)
+	if err != nil {
+		return err
+	}
+
+	body, err := render(w.Body, t)
+	if err != nil {
+		return err
+	}
+
+	method := strings.ToUpper(w.Method)
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.Headers {
+		value, err := render(v, t)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(k, value)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// fireWebhooks sends all the webhooks for a completed torrent
+func fireWebhooks(t *transmission.Torrent) {
+	configMu.RLock()
+	webhooks := Webhooks
+	configMu.RUnlock()
+
+	for _, w := range webhooks {
+		go func(w webhook) {
+			if err := w.fire(t); err != nil {
+				logger.Printf("[ERROR] Webhook: %s", err)
+			}
+		}(w)
+	}
+}
+
+func init() {
+	onCompletion(fireWebhooks)
+}